@@ -0,0 +1,234 @@
+package businessLogic
+
+import (
+	"app/storage"
+	"fmt"
+	"math"
+	"sort"
+)
+
+const (
+	ACCOUNT_STATUS_ACTIVE = "active"
+	ACCOUNT_STATUS_FROZEN = "frozen"
+	ACCOUNT_STATUS_CLOSED = "closed"
+)
+
+/*
+		checkAccountIsActive returns an error if the account is frozen or closed.
+		New orders, withdrawals and outgoing transfers need an active account.
+*/
+func checkAccountIsActive(conn storage.Conn, uid string) error {
+	status, err := getAccountStatus(conn, uid)
+	if err != nil {
+		return fmt.Errorf("database error when retrieving the account status")
+	}
+	if status != ACCOUNT_STATUS_ACTIVE {
+		return fmt.Errorf("account is %s", status)
+	}
+	return nil
+}
+
+/*
+		checkAccountIsNotClosed returns an error if the account is closed.
+		Deposits, symbol positions and incoming transfers need an account which is not closed.
+*/
+func checkAccountIsNotClosed(conn storage.Conn, uid string) error {
+	status, err := getAccountStatus(conn, uid)
+	if err != nil {
+		return fmt.Errorf("database error when retrieving the account status")
+	}
+	if status == ACCOUNT_STATUS_CLOSED {
+		return fmt.Errorf("account is %s", status)
+	}
+	return nil
+}
+
+/*
+		checkAdminAndAccount returns an error if adminUid is not an admin account or uid does not exist.
+*/
+func checkAdminAndAccount(conn storage.Conn, adminUid string, uid string) error {
+	isAdmin, err := checkAdminAccount(conn, adminUid)
+	if err != nil {
+		return fmt.Errorf("database error when checking admin account")
+	}
+	if !isAdmin {
+		return fmt.Errorf("permission denied")
+	}
+
+	exists, err := checkAccountExists(conn, uid)
+	if err != nil || !exists {
+		return fmt.Errorf("user doesn't exist")
+	}
+	return nil
+}
+
+/*
+		FreezeAccount freezes an account: new orders, withdrawals and outgoing transfers of the account are rejected.
+		Resting orders stay in the order books and can still be matched or cancelled, unless cancelOrders is set.
+	input --
+		adminUid: user id of the requester, MUST BE an admin account
+		uid: user id of the account to freeze, should be active
+		cancelOrders: cancel every resting order of the account
+	output --
+		the ids of the cancelled orders, sorted by order id
+		err:
+		if adminUid is not an admin account, an error message will be returned
+		if uid does not exist or is not active, an error message will be returned
+		if database fails to change the status or to cancel an order, an error message will be returned
+*/
+func FreezeAccount(store storage.Storage, adminUid string, uid string, cancelOrders bool) ([]string, error) {
+	conn := store.Get()
+	defer conn.Close()
+
+	err := checkAdminAndAccount(conn, adminUid, uid)
+	if err != nil {
+		return []string{}, err
+	}
+	err = checkAccountIsActive(conn, uid)
+	if err != nil {
+		return []string{}, err
+	}
+
+	err = setAccountStatus(conn, uid, ACCOUNT_STATUS_FROZEN)
+	if err != nil {
+		return []string{}, fmt.Errorf("database error when freezing the account")
+	}
+
+	if !cancelOrders {
+		return []string{}, nil
+	}
+	return cancelAccountOpenOrders(conn, uid)
+}
+
+/*
+		cancelAccountOpenOrders cancels every open order of an account, from the oldest to the latest.
+		The ids of the cancelled orders are returned, if a cancel fails, with the ids of the orders cancelled before it.
+*/
+func cancelAccountOpenOrders(conn storage.Conn, uid string) ([]string, error) {
+	orderIds, err := getAccountOpenOrderIds(conn, uid)
+	if err != nil {
+		return []string{}, fmt.Errorf("database error when retrieving the open orders")
+	}
+	sortOrderIds(orderIds)
+
+	for i, orderId := range orderIds {
+		err = cancelOpenOrder(conn, orderId)
+		if err != nil {
+			return orderIds[:i], fmt.Errorf("cancelling order %s: %s", orderId, err)
+		}
+	}
+	return orderIds, nil
+}
+
+/*
+		UnfreezeAccount makes a frozen account active again.
+	input --
+		adminUid: user id of the requester, MUST BE an admin account
+		uid: user id of the account to unfreeze, should be frozen
+	output --
+		err:
+		if adminUid is not an admin account, an error message will be returned
+		if uid does not exist or is not frozen, an error message will be returned
+		if database fails to change the status, an error message will be returned
+*/
+func UnfreezeAccount(store storage.Storage, adminUid string, uid string) error {
+	conn := store.Get()
+	defer conn.Close()
+
+	err := checkAdminAndAccount(conn, adminUid, uid)
+	if err != nil {
+		return err
+	}
+
+	var status string
+	status, err = getAccountStatus(conn, uid)
+	if err != nil {
+		return fmt.Errorf("database error when retrieving the account status")
+	}
+	if status != ACCOUNT_STATUS_FROZEN {
+		return fmt.Errorf("account is %s", status)
+	}
+
+	err = setAccountStatus(conn, uid, ACCOUNT_STATUS_ACTIVE)
+	if err != nil {
+		return fmt.Errorf("database error when unfreezing the account")
+	}
+	return nil
+}
+
+/*
+		CloseAccount closes an active or frozen account for good, a closed account can not trade, deposit, withdraw or receive transfers.
+		The account can only be closed when it holds no cash, no symbol position and no open order.
+	input --
+		adminUid: user id of the requester, MUST BE an admin account
+		uid: user id of the account to close
+	output --
+		err:
+		if adminUid is not an admin account, an error message will be returned
+		if uid does not exist or is already closed, an error message will be returned
+		if the account still holds cash, symbol positions or open orders, an error message will be returned
+		if database fails to retrieve the account or change the status, an error message will be returned
+*/
+func CloseAccount(store storage.Storage, adminUid string, uid string) error {
+	conn := store.Get()
+	defer conn.Close()
+
+	err := checkAdminAndAccount(conn, adminUid, uid)
+	if err != nil {
+		return err
+	}
+	err = checkAccountIsNotClosed(conn, uid)
+	if err != nil {
+		return err
+	}
+
+	var orderIds []string
+	orderIds, err = getAccountOpenOrderIds(conn, uid)
+	if err != nil {
+		return fmt.Errorf("database error when retrieving the open orders")
+	}
+	if len(orderIds) > 0 {
+		return fmt.Errorf("account still has open orders")
+	}
+
+	var balance, reservedBalance float64
+	balance, reservedBalance, err = getAccountBalanceAndReservedBalance(conn, uid)
+	if err != nil {
+		return fmt.Errorf("database error when retrieving the balance")
+	}
+	if math.Abs(balance) > RECONCILIATION_TOLERANCE || math.Abs(reservedBalance) > RECONCILIATION_TOLERANCE {
+		return fmt.Errorf("account still holds cash")
+	}
+
+	var symbolNames []string
+	symbolNames, err = getAccountSymbols(conn, uid)
+	if err != nil {
+		return fmt.Errorf("database error when retrieving the symbol positions")
+	}
+	for _, symbolName := range symbolNames {
+		var amount, reservedAmount float64
+		amount, reservedAmount, err = getSymbolPositionAndReservedSymbolPosition(conn, uid, symbolName)
+		if err != nil {
+			return fmt.Errorf("database error when retrieving the symbol positions")
+		}
+		if math.Abs(amount) > RECONCILIATION_TOLERANCE || math.Abs(reservedAmount) > RECONCILIATION_TOLERANCE {
+			return fmt.Errorf("account still holds %s", symbolName)
+		}
+	}
+
+	err = setAccountStatus(conn, uid, ACCOUNT_STATUS_CLOSED)
+	if err != nil {
+		return fmt.Errorf("database error when closing the account")
+	}
+	return nil
+}
+
+// sortOrderIds sorts order ids numerically, from the oldest to the latest
+func sortOrderIds(orderIds []string) {
+	sort.Slice(orderIds, func(i, j int) bool {
+		if len(orderIds[i]) != len(orderIds[j]) {
+			return len(orderIds[i]) < len(orderIds[j])
+		}
+		return orderIds[i] < orderIds[j]
+	})
+}
@@ -0,0 +1,41 @@
+package businessLogic
+
+import (
+	"app/storage"
+)
+
+const (
+	DB_ACCOUNT_FIELD_STATUS = "status"
+)
+
+/*
+		Get the status of an account: active/frozen/closed. An account without status is active.
+		This function will NOT check if the account exists, User has to MAKE SURE that the account exists.
+	input --
+		uid: user id, no restriction on the length and characters
+	err --
+		from HMGet
+*/
+func getAccountStatus(conn storage.Conn, uid string) (string, error) {
+	values, err := conn.HMGet(DB_ACCOUNT_PREFIX+uid, []string{DB_ACCOUNT_FIELD_STATUS})
+	if err != nil {
+		return "", err
+	}
+	if values[0] == "" {
+		return ACCOUNT_STATUS_ACTIVE, nil
+	}
+	return values[0], nil
+}
+
+/*
+		Set the status of an account.
+		This function will NOT check if the account exists, User has to MAKE SURE that the account exists.
+	input --
+		uid: user id, no restriction on the length and characters
+		status: active/frozen/closed
+	err --
+		from HSet
+*/
+func setAccountStatus(conn storage.Conn, uid string, status string) error {
+	return conn.HSet(DB_ACCOUNT_PREFIX+uid, DB_ACCOUNT_FIELD_STATUS, status)
+}
@@ -0,0 +1,237 @@
+package businessLogic
+
+import (
+	"app/storage"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// a signed request is rejected if its timestamp is further than this from the server time
+	API_REQUEST_MAX_CLOCK_SKEW_SECONDS = 30
+)
+
+type ApiKeyTuple struct {
+	KeyId  string
+	Uid    string
+	Secret string
+	Admin  bool
+}
+
+/*
+		SignRequest computes the signature of a request: hex encoded HMAC-SHA256 with the api key secret
+		over the nonce, the timestamp and the xml body, separated by new lines.
+	input --
+		secret: the api key secret
+		nonce: a string used only once by the api key
+		timestamp: unix epoch in seconds
+		body: the xml body
+*/
+func SignRequest(secret string, nonce string, timestamp string, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(nonce + "\n" + timestamp + "\n" + body))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+/*
+		RegisterApiKey stores an api key with a given id and secret, used for the admin keys configured at startup.
+	input --
+		keyId: api key id, should not be empty
+		uid: user id of the account the key signs requests for, a base-10 digit sequence. The account does not need to exist.
+		secret: the api key secret, should not be empty
+		admin: if the key can sign admin requests
+	output --
+		err:
+		if keyId, uid or secret does not meet input restriction, an error message will be returned
+		if database fails to store the key, an error message will be returned
+*/
+func RegisterApiKey(store storage.Storage, keyId string, uid string, secret string, admin bool) error {
+	if keyId == "" || secret == "" || !isBase10NumberSequense(uid) {
+		return fmt.Errorf("invalid key, id or secret")
+	}
+
+	conn := store.Get()
+	defer conn.Close()
+
+	err := setApiKey(conn, keyId, uid, secret, admin)
+	if err != nil {
+		return fmt.Errorf("database error to register an api key")
+	}
+	return nil
+}
+
+/*
+		GenerateApiKey generates a random id and secret for a new api key, stored by CreateApiKey.
+		They are generated before the command is written to the command journal, so a replay creates the same key.
+	output --
+		key id, secret
+		err:
+		if the key can not be generated, an error message will be returned
+*/
+func GenerateApiKey() (string, string, error) {
+	keyId, err := generateRandomHex(API_KEY_ID_BYTES)
+	if err != nil {
+		return "", "", fmt.Errorf("error when generating the api key")
+	}
+	var secret string
+	secret, err = generateRandomHex(API_KEY_SECRET_BYTES)
+	if err != nil {
+		return "", "", fmt.Errorf("error when generating the api key")
+	}
+	return keyId, secret, nil
+}
+
+/*
+		CreateApiKey stores a new api key from GenerateApiKey for an account.
+		The secret is only returned here, it should be handed to the account's owner.
+	input --
+		adminUid: user id of the requester, MUST BE an admin account
+		uid: user id of the account the key signs requests for
+		keyId, secret: from GenerateApiKey
+	output --
+		the new api key tuple
+		err:
+		if adminUid is not an admin account, an error message will be returned
+		if uid does not exist, an error message will be returned
+		if database fails to store the key, an error message will be returned
+*/
+func CreateApiKey(store storage.Storage, adminUid string, uid string, keyId string, secret string) (ApiKeyTuple, error) {
+	conn := store.Get()
+	defer conn.Close()
+
+	err := checkAdminAndAccount(conn, adminUid, uid)
+	if err != nil {
+		return ApiKeyTuple{}, err
+	}
+
+	err = setApiKey(conn, keyId, uid, secret, false)
+	if err != nil {
+		return ApiKeyTuple{}, fmt.Errorf("database error when storing the api key")
+	}
+
+	return ApiKeyTuple{KeyId: keyId, Uid: uid, Secret: secret}, nil
+}
+
+/*
+		RevokeApiKey removes an api key, requests signed with it are rejected afterwards.
+	input --
+		adminUid: user id of the requester, MUST BE an admin account
+		keyId: the api key id
+	output --
+		err:
+		if adminUid is not an admin account, an error message will be returned
+		if the api key does not exist, an error message will be returned
+		if database fails to remove the key, an error message will be returned
+*/
+func RevokeApiKey(store storage.Storage, adminUid string, keyId string) error {
+	conn := store.Get()
+	defer conn.Close()
+
+	isAdmin, err := checkAdminAccount(conn, adminUid)
+	if err != nil {
+		return fmt.Errorf("database error when checking admin account")
+	}
+	if !isAdmin {
+		return fmt.Errorf("permission denied")
+	}
+
+	var uid string
+	uid, _, _, err = getApiKey(conn, keyId)
+	if err != nil {
+		return fmt.Errorf("database error when retrieving the api key")
+	}
+	if uid == "" {
+		return fmt.Errorf("no such api key")
+	}
+
+	err = removeApiKey(conn, keyId)
+	if err != nil {
+		return fmt.Errorf("database error when removing the api key")
+	}
+	return nil
+}
+
+/*
+		AuthenticateRequest verifies a signed request and returns the account it is signed for.
+		The signature should be SignRequest of the request with the api key secret.
+		The timestamp should be within API_REQUEST_MAX_CLOCK_SKEW_SECONDS of the server time,
+		and the nonce should not have been used by the api key in that window, so a captured request can not be replayed.
+	input --
+		keyId: the api key id
+		nonce: a string used only once by the api key
+		timestamp: unix epoch in seconds
+		signature: the hex encoded signature
+		body: the xml body
+	output --
+		the api key tuple of the request, without the secret
+		err:
+		if the api key does not exist, an error message will be returned
+		if the timestamp is invalid or too far from the server time, an error message will be returned
+		if the signature is not valid, an error message will be returned
+		if the nonce has been used, an error message will be returned
+		if database fails to retrieve the key or record the nonce, an error message will be returned
+*/
+func AuthenticateRequest(store storage.Storage, keyId string, nonce string, timestamp string, signature string, body string) (ApiKeyTuple, error) {
+	conn := store.Get()
+	defer conn.Close()
+
+	uid, secret, admin, err := getApiKey(conn, keyId)
+	if err != nil {
+		return ApiKeyTuple{}, fmt.Errorf("database error when retrieving the api key")
+	}
+	if uid == "" {
+		return ApiKeyTuple{}, fmt.Errorf("authentication failed")
+	}
+
+	var requestTime int64
+	requestTime, err = strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ApiKeyTuple{}, fmt.Errorf("authentication failed")
+	}
+	skew := time.Now().Unix() - requestTime
+	if skew > API_REQUEST_MAX_CLOCK_SKEW_SECONDS || skew < -API_REQUEST_MAX_CLOCK_SKEW_SECONDS {
+		return ApiKeyTuple{}, fmt.Errorf("request expired")
+	}
+
+	if !hmac.Equal([]byte(signature), []byte(SignRequest(secret, nonce, timestamp, body))) {
+		return ApiKeyTuple{}, fmt.Errorf("authentication failed")
+	}
+
+	// a nonce only needs to be remembered while a request using it can pass the timestamp check
+	var unused bool
+	unused, err = useApiNonce(conn, keyId, nonce, 2*API_REQUEST_MAX_CLOCK_SKEW_SECONDS)
+	if err != nil {
+		return ApiKeyTuple{}, fmt.Errorf("database error when recording the nonce")
+	}
+	if !unused {
+		return ApiKeyTuple{}, fmt.Errorf("nonce already used")
+	}
+
+	return ApiKeyTuple{KeyId: keyId, Uid: uid, Admin: admin}, nil
+}
+
+/*
+		SplitSignedRequest splits a signed request into its authentication line and its xml body.
+		The first line of a signed request is "<key id> <nonce> <timestamp> <signature>", the xml body follows it.
+	output --
+		keyId, nonce, timestamp, signature and the xml body
+		err:
+		if the authentication line is missing or malformed, an error message will be returned
+*/
+func SplitSignedRequest(request string) (string, string, string, string, string, error) {
+	lines := strings.SplitN(request, "\n", 2)
+	if len(lines) != 2 {
+		return "", "", "", "", "", fmt.Errorf("missing authentication line")
+	}
+
+	fields := strings.Fields(lines[0])
+	if len(fields) != 4 {
+		return "", "", "", "", "", fmt.Errorf("malformed authentication line")
+	}
+	return fields[0], fields[1], fields[2], fields[3], lines[1], nil
+}
@@ -0,0 +1,92 @@
+package businessLogic
+
+import (
+	"app/storage"
+	"crypto/rand"
+	"encoding/hex"
+)
+
+const (
+	DB_API_KEY_PREFIX        = "apiKey:"
+	DB_API_KEY_FIELD_ACCOUNT = "account"
+	DB_API_KEY_FIELD_SECRET  = "secret"
+	DB_API_KEY_FIELD_ADMIN   = "admin"
+	DB_API_NONCE_PREFIX      = "apiNonce:"
+
+	API_KEY_ID_BYTES     = 16
+	API_KEY_SECRET_BYTES = 32
+)
+
+/*
+		Store an api key of an account. If the key id exists, the key will be UPDATED.
+	input --
+		keyId: api key id, no restriction on the length and characters
+		uid: user id of the account the key signs requests for
+		secret: the secret shared with the client to sign requests
+		admin: if the key can sign admin requests
+	err --
+		from HMSet
+*/
+func setApiKey(conn storage.Conn, keyId string, uid string, secret string, admin bool) error {
+	return conn.HMSet(DB_API_KEY_PREFIX+keyId, map[string]interface{}{
+		DB_API_KEY_FIELD_ACCOUNT: uid,
+		DB_API_KEY_FIELD_SECRET:  secret,
+		DB_API_KEY_FIELD_ADMIN:   admin})
+}
+
+/*
+		Get the account, secret and admin flag of an api key.
+		If the api key does not exist, the account is empty.
+	input --
+		keyId: api key id, no restriction on the length and characters
+	err --
+		from HMGet
+*/
+func getApiKey(conn storage.Conn, keyId string) (string, string, bool, error) {
+	values, err := conn.HMGet(DB_API_KEY_PREFIX+keyId, []string{
+		DB_API_KEY_FIELD_ACCOUNT,
+		DB_API_KEY_FIELD_SECRET,
+		DB_API_KEY_FIELD_ADMIN})
+	if err != nil {
+		return "", "", false, err
+	}
+
+	// redis stores booleans as 1/0
+	return values[0], values[1], values[2] == "1", nil
+}
+
+/*
+		Remove an api key, requests signed with it are rejected afterwards.
+	input --
+		keyId: api key id, no restriction on the length and characters
+	err --
+		from Delete
+*/
+func removeApiKey(conn storage.Conn, keyId string) error {
+	return conn.Delete(DB_API_KEY_PREFIX+keyId)
+}
+
+/*
+		Record a nonce used by an api key, the nonce is forgotten after ttlSeconds.
+	output --
+		return false if the nonce has already been used
+	err --
+		from SetNXWithExpire
+*/
+func useApiNonce(conn storage.Conn, keyId string, nonce string, ttlSeconds int) (bool, error) {
+	return conn.SetNXWithExpire(DB_API_NONCE_PREFIX+keyId+":"+nonce, "1", ttlSeconds)
+}
+
+/*
+		Generate a random hex string from numberOfBytes random bytes.
+	err --
+		from crypto/rand.Read
+*/
+func generateRandomHex(numberOfBytes int) (string, error) {
+	randomBytes := make([]byte, numberOfBytes)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(randomBytes), nil
+}
@@ -1,15 +1,21 @@
 package businessLogic
 
 import (
+	"app/storage"
+	"app/uniqueKeyGenerator"
 	"fmt"
 	"math"
-
-	redigo "github.com/gomodule/redigo/redis"
+	"sort"
+	"strconv"
 )
 
 const (
 	ORDER_TYPE_BUY  = "buy"
 	ORDER_TYPE_SELL = "sell"
+
+	ORDER_STATUS_OPEN      = "open"
+	ORDER_STATUS_FILLED    = "filled"
+	ORDER_STATUS_CANCELLED = "cancelled"
 )
 
 type CancelledOrderHistoryTuple struct {
@@ -21,14 +27,73 @@ type ExecutedOrderHistoryTuple struct {
 	TransactionAmount string
 	TransactionPrice  string
 	TransactionTime   string
+	TradeId           string
 }
 
 type OpenOrderTuple struct {
 	CurrentAmount string
 }
 
+type OrderBookLevelTuple struct {
+	Price       string
+	TotalAmount string
+	OrderCount  string
+}
+
+type PositionTuple struct {
+	SymbolName      string
+	AvailableAmount string
+	ReservedAmount  string
+}
+
+type AccountTuple struct {
+	Status           string
+	AvailableBalance string
+	ReservedBalance  string
+	Positions        []PositionTuple
+}
+
+type AccountOrderTuple struct {
+	OrderId       string
+	SymbolName    string
+	OrderType     string
+	LimitPrice    string
+	InitialAmount string
+	EntryTime     string
+	Status        string
+}
+
+// empty string and 0 mean no filter
+type AccountOrderFilter struct {
+	Status     string
+	SymbolName string
+	OrderType  string
+	From       int64
+	To         int64
+}
+
+type OrderDetailTuple struct {
+	SymbolName    string
+	OrderType     string
+	LimitPrice    string
+	InitialAmount string
+	EntryTime     string
+	State         string
+	CloseTime     string
+}
+
+type RestingOrderTuple struct {
+	OrderId       string
+	OrderType     string
+	LimitPrice    string
+	CurrentAmount string
+	EntryTime     string
+	Uid           string
+}
+
 /*
 		CreateAccount will create an account in redis with uid and balance.
+		A positive initial balance is recorded as a deposit in the account's cash ledger.
 	input --
 		uid: user id, a base-10 digit sequence
 		balance: should be non-negative float(>= 0)
@@ -38,14 +103,13 @@ type OpenOrderTuple struct {
 		if database fails to create the account, an error message will be returned
 		if no error returns, an account is successfully created in redis
 */
-func CreateAccount(pool *redigo.Pool, uid string, balance float64) error {
+func CreateAccount(store storage.Storage, uid string, balance float64) error {
 	if !isBase10NumberSequense(uid) || balance < 0 {
 		return fmt.Errorf("invalid id or balance")
 	}
 
-	connection := pool.Get()
-	defer connection.Close()
-	conn := (&connection)
+	conn := store.Get()
+	defer conn.Close()
 
 	accountExists, err := checkAccountExists(conn, uid)
 	if err != nil || accountExists {
@@ -57,32 +121,56 @@ func CreateAccount(pool *redigo.Pool, uid string, balance float64) error {
 		return fmt.Errorf("database error to create an account")
 	}
 
+	if balance > 0 {
+		var movement CashMovementTuple
+		movement, err = insertCashMovementToCashLedger(conn, uid, CASH_MOVEMENT_DEPOSIT, balance, CASH_MOVEMENT_REASON_ACCOUNT_CREATED, balance)
+		if err != nil {
+			return fmt.Errorf("database error to record the initial balance")
+		}
+		err = postJournalEntry(conn, JOURNAL_KIND_DEPOSIT, movement.MovementId, movement.Time,
+			journalTransfer(JOURNAL_ASSET_CASH, JOURNAL_LEDGER_ACCOUNT_EXTERNAL, availableLedgerAccount(uid), balance))
+		if err != nil {
+			return fmt.Errorf("database error to post the initial balance to the journal")
+		}
+	}
+
 	return nil
 }
 
 /*
 		SetOrAddSymbolPositionToAccount will set an account's symbol position to the amount. Symbol is specified by symbolName.
 		If this account already has symbol position for this symbolName, then the amount will be added to the account's symbol position.
+		The amount is recorded as a symbol deposit, and posted to the journal with the symbol deposit id, together with the position change.
 	input --
 		uid: user id, a base-10 digit sequence
-		symbolName: string
+		symbolName: string, NOT "cash", the journal asset of cash
 		amount: should be non-negative float(>= 0)
 	output --
 		error:
+		if symbolName is "cash", an error message will be returned
 		if uid does not exist, an error message will be returned
+		if the account is closed, an error message will be returned
 		if amount does not meet input restriction, an error message will be returned
 		if database fails to create the symbol position, an error message will be returned
 		if no error returns, the symbol position is successfully created under the account in redis
 */
-func SetOrAddSymbolPositionToAccount(pool *redigo.Pool, uid string, symbolName string, amount float64) error {
-	connection := pool.Get()
-	defer connection.Close()
-	conn := (&connection)
+func SetOrAddSymbolPositionToAccount(store storage.Storage, uid string, symbolName string, amount float64) error {
+	err := checkSymbolName(symbolName)
+	if err != nil {
+		return err
+	}
+
+	conn := store.Get()
+	defer conn.Close()
 
 	exists, err := checkAccountExists(conn, uid)
 	if err != nil || !exists {
 		return fmt.Errorf("user doesn't exist")
 	}
+	err = checkAccountIsNotClosed(conn, uid)
+	if err != nil {
+		return err
+	}
 
 	if amount < 0 {
 		return fmt.Errorf("invalid amount")
@@ -93,16 +181,33 @@ func SetOrAddSymbolPositionToAccount(pool *redigo.Pool, uid string, symbolName s
 		return fmt.Errorf("database error to create/add symbol")
 	}
 
-	if exists {
-		_, err = increaseSymbolPosition(conn, uid, symbolName, amount)
+	// the position changes with its symbol deposit record and journal posting, or not at all
+	err = runAtomically(conn, func(conn storage.Conn) error {
+		if exists {
+			_, err := increaseSymbolPosition(conn, uid, symbolName, amount)
+			if err != nil {
+				return fmt.Errorf("database error to create/add symbol")
+			}
+		} else {
+			err := setSymbolPosition(conn, uid, symbolName, amount)
+			if err != nil {
+				return fmt.Errorf("database error to create/add symbol")
+			}
+		}
+
+		depositId, depositTime, err := insertSymbolDeposit(conn, uid, symbolName, amount)
 		if err != nil {
-			return fmt.Errorf("database error to create/add symbol")
+			return fmt.Errorf("database error to record the symbol deposit")
 		}
-	} else {
-		err = setSymbolPosition(conn, uid, symbolName, amount)
+		err = postJournalEntry(conn, JOURNAL_KIND_DEPOSIT, depositId, depositTime,
+			journalTransfer(symbolName, JOURNAL_LEDGER_ACCOUNT_EXTERNAL, availableLedgerAccount(uid), amount))
 		if err != nil {
-			return fmt.Errorf("database error to create/add symbol")
+			return fmt.Errorf("database error to post the symbol to the journal")
 		}
+		return nil
+	})
+	if err != nil {
+		return err
 	}
 
 	return nil
@@ -120,21 +225,50 @@ func SetOrAddSymbolPositionToAccount(pool *redigo.Pool, uid string, symbolName s
 		amount: should be non-negative float(> 0)
 	output --
 		error:
+		if symbolName is "cash", an error message will be returned
 		if uid does not exist, an error message will be returned
+		if the account is frozen or closed, an error message will be returned
+		if the kill switch of the account or its group is engaged, an error message will be returned
 		if amount or limitPrice does not meet input restriction, an error message will be returned
 		if the account's balance is insufficient to create the order, an error message will be returned
+		if the order breaks a risk limit, an error message naming the limit will be returned
 		if database fails to create the symbol position, an error message will be returned
 		if no error returns, the buy order is successfully created under the account in redis
 */
-func SetBuyOrder(pool *redigo.Pool, orderId string, uid string, symbolName string, limitPrice float64, amount float64) error {
-	connection := pool.Get()
-	defer connection.Close()
-	conn := (&connection)
+func SetBuyOrder(store storage.Storage, orderId string, uid string, symbolName string, limitPrice float64, amount float64) error {
+	return SetBuyOrderForClientOrder(store, orderId, uid, symbolName, limitPrice, amount, ClientOrderTuple{})
+}
+
+/*
+		SetBuyOrderForClientOrder is SetBuyOrder, which also records the client order id of the order
+		in the same atomic step as the order, so a placed order is never without its client order id.
+	input --
+		clientOrder: the client order id and the response recorded for it if the order is placed, empty ClOrdId for no client order id
+*/
+func SetBuyOrderForClientOrder(store storage.Storage, orderId string, uid string, symbolName string, limitPrice float64, amount float64, clientOrder ClientOrderTuple) error {
+	err := checkSymbolName(symbolName)
+	if err != nil {
+		return err
+	}
+
+	conn := store.Get()
+	defer conn.Close()
 
 	exists, err := checkAccountExists(conn, uid)
-	if err != nil || !exists {
+	if err != nil {
+		return fmt.Errorf("database error when checking the account")
+	}
+	if !exists {
 		return fmt.Errorf("user doesn't exist")
 	}
+	err = checkAccountIsActive(conn, uid)
+	if err != nil {
+		return err
+	}
+	err = checkKillSwitch(conn, uid)
+	if err != nil {
+		return err
+	}
 
 	if amount <= 0 || limitPrice <= 0 {
 		return fmt.Errorf("invalid amount or limit price")
@@ -142,23 +276,69 @@ func SetBuyOrder(pool *redigo.Pool, orderId string, uid string, symbolName strin
 
 	var accountBalance float64
 	accountBalance, err = GetAccountBalance(conn, uid)
+	if err != nil {
+		return fmt.Errorf("database error when retrieving the balance")
+	}
 	payment := limitPrice * amount
 	if accountBalance < payment {
 		return fmt.Errorf("insufficient fund")
 	}
 
-	err = createBuyOrder(conn, orderId, uid, symbolName, limitPrice, amount)
+	err = checkPreTradeRisk(conn, uid, symbolName, ORDER_TYPE_BUY, limitPrice, amount)
 	if err != nil {
-		return fmt.Errorf("database error to create buy order")
-	}
-	err = AddBuyOrderToBuyOrderBook(conn, symbolName, orderId, limitPrice)
-	if err != nil {
-		return fmt.Errorf("database error to add buy order to order book")
+		return err
 	}
 
-	_, err = decreaseAccountBalance(conn, uid, payment)
+	// the order enters the book with its reservation, or not at all
+	err = runAtomically(conn, func(conn storage.Conn) error {
+		current_time := getCurrentTimeInString()
+		err := createBuyOrder(conn, orderId, uid, symbolName, limitPrice, amount, current_time)
+		if err != nil {
+			return fmt.Errorf("database error to create buy order")
+		}
+		err = addOrderToAccountOrderIndex(conn, uid, AccountOrderTuple{
+			OrderId:       orderId,
+			SymbolName:    symbolName,
+			OrderType:     ORDER_TYPE_BUY,
+			LimitPrice:    formatPriceLevel(limitPrice),
+			InitialAmount: fmt.Sprintf("%f", amount),
+			EntryTime:     current_time,
+		})
+		if err != nil {
+			return fmt.Errorf("database error to add buy order to account order index")
+		}
+		err = AddBuyOrderToBuyOrderBook(conn, symbolName, orderId, limitPrice)
+		if err != nil {
+			return fmt.Errorf("database error to add buy order to order book")
+		}
+		err = updateOrderBookLevel(conn, ORDER_TYPE_BUY, symbolName, limitPrice, amount, 1)
+		if err != nil {
+			return fmt.Errorf("database error to add buy order to order book level")
+		}
+
+		_, err = decreaseAccountBalance(conn, uid, payment)
+		if err != nil {
+			return fmt.Errorf("database error when deducting balance from account")
+		}
+		err = increaseReservedBalance(conn, uid, payment)
+		if err != nil {
+			return fmt.Errorf("database error when reserving balance for buy order")
+		}
+		err = postJournalEntry(conn, JOURNAL_KIND_RESERVE, orderId, current_time,
+			journalTransfer(JOURNAL_ASSET_CASH, availableLedgerAccount(uid), reservedLedgerAccount(uid), payment))
+		if err != nil {
+			return fmt.Errorf("database error when posting the reserved balance to the journal")
+		}
+		if clientOrder.ClOrdId != "" {
+			err = setClientOrder(conn, uid, clientOrder.ClOrdId, orderId, clientOrder.Response)
+			if err != nil {
+				return fmt.Errorf("database error when recording the client order id")
+			}
+		}
+		return nil
+	})
 	if err != nil {
-		return fmt.Errorf("database error when deducting balance from account")
+		return err
 	}
 
 	MatchOrder(conn, orderId, uid, symbolName, limitPrice, amount, "buy")
@@ -178,24 +358,56 @@ func SetBuyOrder(pool *redigo.Pool, orderId string, uid string, symbolName strin
 		amount: should be non-negative float(> 0)
 	output --
 		error:
+		if symbolName is "cash", an error message will be returned
 		if uid does not exist, an error message will be returned
+		if the account is frozen or closed, an error message will be returned
+		if the kill switch of the account or its group is engaged, an error message will be returned
 		if amount or limitPrice does not meet input restriction, an error message will be returned
 		if the account's symbol position for this symbol is insufficient to create the order, an error message will be returned
+		if the order breaks a risk limit, an error message naming the limit will be returned
 		if database fails to create the symbol position, an error message will be returned
 		if no error returns, the buy order is successfully created under the account in redis
 */
-func SetSellOrder(pool *redigo.Pool, orderId string, uid string, symbolName string, limitPrice float64, amount float64) error {
-	connection := pool.Get()
-	defer connection.Close()
-	conn := (&connection)
+func SetSellOrder(store storage.Storage, orderId string, uid string, symbolName string, limitPrice float64, amount float64) error {
+	return SetSellOrderForClientOrder(store, orderId, uid, symbolName, limitPrice, amount, ClientOrderTuple{})
+}
+
+/*
+		SetSellOrderForClientOrder is SetSellOrder, which also records the client order id of the order
+		in the same atomic step as the order, so a placed order is never without its client order id.
+	input --
+		clientOrder: the client order id and the response recorded for it if the order is placed, empty ClOrdId for no client order id
+*/
+func SetSellOrderForClientOrder(store storage.Storage, orderId string, uid string, symbolName string, limitPrice float64, amount float64, clientOrder ClientOrderTuple) error {
+	err := checkSymbolName(symbolName)
+	if err != nil {
+		return err
+	}
+
+	conn := store.Get()
+	defer conn.Close()
 
 	exists, err := checkAccountExists(conn, uid)
-	if err != nil || !exists {
+	if err != nil {
+		return fmt.Errorf("database error when checking the account")
+	}
+	if !exists {
 		return fmt.Errorf("user doesn't exist")
 	}
+	err = checkAccountIsActive(conn, uid)
+	if err != nil {
+		return err
+	}
+	err = checkKillSwitch(conn, uid)
+	if err != nil {
+		return err
+	}
 
 	exists, err = checkSymbolPositionExists(conn, uid, symbolName)
-	if err != nil || !exists {
+	if err != nil {
+		return fmt.Errorf("database error when checking the symbol position")
+	}
+	if !exists {
 		return fmt.Errorf("symbol position doesn't exist under this account")
 	}
 
@@ -205,22 +417,68 @@ func SetSellOrder(pool *redigo.Pool, orderId string, uid string, symbolName stri
 
 	var symbolPositionInAccount float64
 	symbolPositionInAccount, err = GetSymbolPosition(conn, uid, symbolName)
-	if err != nil || symbolPositionInAccount < amount {
+	if err != nil {
+		return fmt.Errorf("database error when retrieving the symbol position")
+	}
+	if symbolPositionInAccount < amount {
 		return fmt.Errorf("insufficient symbols")
 	}
 
-	err = createSellOrder(conn, orderId, uid, symbolName, limitPrice, amount)
-	if err != nil {
-		return fmt.Errorf("database error to create sell order")
-	}
-	err = AddSellOrderToSellOrderBook(conn, symbolName, orderId, limitPrice)
+	err = checkPreTradeRisk(conn, uid, symbolName, ORDER_TYPE_SELL, limitPrice, amount)
 	if err != nil {
-		return fmt.Errorf("database error to add sell order to order book")
+		return err
 	}
 
-	_, err = decreaseSymbolPosition(conn, uid, symbolName, amount)
+	// the order enters the book with its reservation, or not at all
+	err = runAtomically(conn, func(conn storage.Conn) error {
+		current_time := getCurrentTimeInString()
+		err := createSellOrder(conn, orderId, uid, symbolName, limitPrice, amount, current_time)
+		if err != nil {
+			return fmt.Errorf("database error to create sell order")
+		}
+		err = addOrderToAccountOrderIndex(conn, uid, AccountOrderTuple{
+			OrderId:       orderId,
+			SymbolName:    symbolName,
+			OrderType:     ORDER_TYPE_SELL,
+			LimitPrice:    formatPriceLevel(limitPrice),
+			InitialAmount: fmt.Sprintf("%f", amount),
+			EntryTime:     current_time,
+		})
+		if err != nil {
+			return fmt.Errorf("database error to add sell order to account order index")
+		}
+		err = AddSellOrderToSellOrderBook(conn, symbolName, orderId, limitPrice)
+		if err != nil {
+			return fmt.Errorf("database error to add sell order to order book")
+		}
+		err = updateOrderBookLevel(conn, ORDER_TYPE_SELL, symbolName, limitPrice, amount, 1)
+		if err != nil {
+			return fmt.Errorf("database error to add sell order to order book level")
+		}
+
+		_, err = decreaseSymbolPosition(conn, uid, symbolName, amount)
+		if err != nil {
+			return fmt.Errorf("database error when deducting amount from symbol")
+		}
+		err = increaseReservedSymbolPosition(conn, uid, symbolName, amount)
+		if err != nil {
+			return fmt.Errorf("database error when reserving symbol for sell order")
+		}
+		err = postJournalEntry(conn, JOURNAL_KIND_RESERVE, orderId, current_time,
+			journalTransfer(symbolName, availableLedgerAccount(uid), reservedLedgerAccount(uid), amount))
+		if err != nil {
+			return fmt.Errorf("database error when posting the reserved symbol to the journal")
+		}
+		if clientOrder.ClOrdId != "" {
+			err = setClientOrder(conn, uid, clientOrder.ClOrdId, orderId, clientOrder.Response)
+			if err != nil {
+				return fmt.Errorf("database error when recording the client order id")
+			}
+		}
+		return nil
+	})
 	if err != nil {
-		return fmt.Errorf("database error when deducting amount from symbol")
+		return err
 	}
 
 	MatchOrder(conn, orderId, uid, symbolName, limitPrice, amount, "sell")
@@ -228,25 +486,76 @@ func SetSellOrder(pool *redigo.Pool, orderId string, uid string, symbolName stri
 	return nil
 }
 
+/*
+		checkOrderOwner returns an error if the order was not placed by requesterUid.
+		The owner is read from the open or archived order, or from the account's order index once the archived order has expired.
+*/
+func checkOrderOwner(conn storage.Conn, requesterUid string, orderId string) error {
+	uid, err := getOrderAccount(conn, orderId)
+	if err != nil {
+		return fmt.Errorf("database error when retrieving the order's account")
+	}
+	if uid != "" {
+		if uid != requesterUid {
+			return fmt.Errorf("not your order")
+		}
+		return nil
+	}
+
+	var inAccountOrderIndex bool
+	inAccountOrderIndex, err = checkOrderInAccountOrderIndex(conn, requesterUid, orderId)
+	if err != nil {
+		return fmt.Errorf("database error when retrieving the order's account")
+	}
+	if !inAccountOrderIndex {
+		return fmt.Errorf("not your order")
+	}
+	return nil
+}
+
 /*
 		CancelOpenOrder cancels an open order.
 	input --
+		requesterUid: user id of the requester, MUST BE the account which placed the order
 		orderId: order id.
 	output --
 		err:
 		If no open order with order id exists, an error message is returned
+		If requesterUid did not place the order, an error message is returned
 		if fails to retrieve order, remove open order, or insert order history from database, an error message will be returned
 */
-func CancelOpenOrder(pool *redigo.Pool, orderId string) error {
-	connection := pool.Get()
-	defer connection.Close()
-	conn := (&connection)
+func CancelOpenOrder(store storage.Storage, requesterUid string, orderId string) error {
+	conn := store.Get()
+	defer conn.Close()
+
 	exists, err := checkOrderExists(conn, orderId)
 	if err != nil || !exists {
 		return fmt.Errorf("open order with this order id does not exist")
 	}
+	err = checkOrderOwner(conn, requesterUid, orderId)
+	if err != nil {
+		return err
+	}
 
+	return cancelOpenOrder(conn, orderId)
+}
 
+/*
+		cancelOpenOrder cancels an open order on the caller's connection, see CancelOpenOrder.
+		The refund, the removal from the order book and the cancel history are committed atomically.
+*/
+func cancelOpenOrder(conn storage.Conn, orderId string) error {
+	return runAtomically(conn, func(conn storage.Conn) error {
+		return applyCancel(conn, orderId)
+	})
+}
+
+// applyCancel does the reads and writes of cancelOpenOrder, on the connection of a transaction
+func applyCancel(conn storage.Conn, orderId string) error {
+	exists, err := checkOrderExists(conn, orderId)
+	if err != nil || !exists {
+		return fmt.Errorf("open order with this order id does not exist")
+	}
 
 	var symbolName_n_orderType []string
 	symbolName_n_orderType, err = GetSymbolNameAndOrderType(conn, orderId)
@@ -272,35 +581,59 @@ func CancelOpenOrder(pool *redigo.Pool, orderId string) error {
 
 	symbolName := symbolName_n_orderType[0]
 	orderType := symbolName_n_orderType[1]
-
+	currentTimeInString := getCurrentTimeInString()
 
 	if orderType == ORDER_TYPE_BUY {
 		_, err = increaseAccountBalance(conn, uid, price * amount)
 		if err != nil {
 			return fmt.Errorf("database error when return money to buyer")
 		}
+		err = increaseReservedBalance(conn, uid, -price*amount)
+		if err != nil {
+			return fmt.Errorf("database error when releasing reserved balance of buyer")
+		}
+		err = postJournalEntry(conn, JOURNAL_KIND_CANCEL, orderId, currentTimeInString,
+			journalTransfer(JOURNAL_ASSET_CASH, reservedLedgerAccount(uid), availableLedgerAccount(uid), price*amount))
+		if err != nil {
+			return fmt.Errorf("database error when posting the released balance of buyer to the journal")
+		}
 		err = removeBuyOrderFromBuyOrderBook(conn, symbolName, orderId)
 		if err != nil {
 			return fmt.Errorf("database error when removing buy order from buy order book")
 		}
+		err = updateOrderBookLevel(conn, ORDER_TYPE_BUY, symbolName, price, -amount, -1)
+		if err != nil {
+			return fmt.Errorf("database error when removing buy order from buy order book level")
+		}
 	} else {
 		_, err = increaseSymbolPosition(conn, uid, symbolName, amount)
 		if err != nil {
 			return fmt.Errorf("database error when return symbol to seller")
 		}
+		err = increaseReservedSymbolPosition(conn, uid, symbolName, -amount)
+		if err != nil {
+			return fmt.Errorf("database error when releasing reserved symbol of seller")
+		}
+		err = postJournalEntry(conn, JOURNAL_KIND_CANCEL, orderId, currentTimeInString,
+			journalTransfer(symbolName, reservedLedgerAccount(uid), availableLedgerAccount(uid), amount))
+		if err != nil {
+			return fmt.Errorf("database error when posting the released symbol of seller to the journal")
+		}
 		err = removeSellOrderFromSellOrderBook(conn, symbolName, orderId)
 		if err != nil {
 			return fmt.Errorf("database error when removing sell order from sell order book")
 		}
+		err = updateOrderBookLevel(conn, ORDER_TYPE_SELL, symbolName, price, -amount, -1)
+		if err != nil {
+			return fmt.Errorf("database error when removing sell order from sell order book level")
+		}
 	}
 
-	err = removeOrder(conn, orderId)
+	err = archiveOrder(conn, orderId, ORDER_STATUS_CANCELLED, currentTimeInString)
 	if err != nil {
 		return fmt.Errorf("database error when removing order from orders")
 	}
 
-	currentTimeInString := getCurrentTimeInString()
-
 	err = insertCancelledOrderToCancelHistory(conn, orderId, amount, currentTimeInString)
 	if err != nil {
 		return fmt.Errorf("database error when inserting cancelled order to cancalled order history")
@@ -309,20 +642,165 @@ func CancelOpenOrder(pool *redigo.Pool, orderId string) error {
 	return nil
 }
 
+/*
+		QueryAccount query an account's status(active/frozen/closed), balance and symbol positions.
+		Available amounts can be used by new orders, reserved amounts are held by the account's open orders:
+		balance reserved by open buy orders, symbol positions reserved by open sell orders.
+	input --
+		requesterUid: user id of the requester, MUST BE the same as uid
+		uid: user id of the account to query
+	output --
+		an account tuple, symbol positions are sorted by symbol name
+		err:
+		if requesterUid is not uid, an error message will be returned
+		if uid does not exist, an error message will be returned
+		if database fails to retrieve the account, an error message will be returned
+*/
+func QueryAccount(store storage.Storage, requesterUid string, uid string) (AccountTuple, error) {
+	if requesterUid != uid {
+		return AccountTuple{}, fmt.Errorf("permission denied")
+	}
+
+	conn := store.Get()
+	defer conn.Close()
+
+	exists, err := checkAccountExists(conn, uid)
+	if err != nil || !exists {
+		return AccountTuple{}, fmt.Errorf("user doesn't exist")
+	}
+
+	var status string
+	status, err = getAccountStatus(conn, uid)
+	if err != nil {
+		return AccountTuple{}, fmt.Errorf("database error when retrieving the account status")
+	}
+
+	var balance, reservedBalance float64
+	balance, reservedBalance, err = getAccountBalanceAndReservedBalance(conn, uid)
+	if err != nil {
+		return AccountTuple{}, fmt.Errorf("database error when retrieving the balance")
+	}
+
+	var symbolNames []string
+	symbolNames, err = getAccountSymbols(conn, uid)
+	if err != nil {
+		return AccountTuple{}, fmt.Errorf("database error when retrieving the symbol positions")
+	}
+	sort.Strings(symbolNames)
+
+	var positions []PositionTuple
+	for _, symbolName := range symbolNames {
+		var amount, reservedAmount float64
+		amount, reservedAmount, err = getSymbolPositionAndReservedSymbolPosition(conn, uid, symbolName)
+		if err != nil {
+			return AccountTuple{}, fmt.Errorf("database error when retrieving the symbol positions")
+		}
+		positions = append(positions, PositionTuple{
+			SymbolName:      symbolName,
+			AvailableAmount: fmt.Sprintf("%f", amount),
+			ReservedAmount:  fmt.Sprintf("%f", reservedAmount),
+		})
+	}
+
+	return AccountTuple{
+		Status:           status,
+		AvailableBalance: fmt.Sprintf("%f", balance),
+		ReservedBalance:  fmt.Sprintf("%f", reservedBalance),
+		Positions:        positions,
+	}, nil
+}
+
+/*
+		QueryAccountOrders query the orders an account has placed, from the latest to the oldest, with filters.
+		Orders stay queryable after they are filled or cancelled.
+		The first query(empty cursor) returns the latest orders,
+		later queries pass the returned cursor to read the next(older) orders.
+	input --
+		requesterUid: user id of the requester, MUST BE the same as uid
+		uid: user id of the account to query
+		filter: status(open/filled/cancelled), symbol name, order type(buy/sell) and entry time range(unix epoch in seconds, both inclusive)
+		cursor: empty to read from the latest order, or the cursor returned by the previous page
+		limit: the maximum number of orders in a page, should be positive
+	output --
+		a list of account order tuples, the cursor of the next page(empty if there is no more order)
+		err:
+		if requesterUid is not uid, an error message will be returned
+		if filter, cursor or limit does not meet input restriction, an error message will be returned
+		if database fails to retrieve the orders, an error message will be returned
+*/
+func QueryAccountOrders(store storage.Storage, requesterUid string, uid string, filter AccountOrderFilter, cursor string, limit int) ([]AccountOrderTuple, string, error) {
+	if requesterUid != uid {
+		return []AccountOrderTuple{}, "", fmt.Errorf("permission denied")
+	}
+	if filter.Status != "" && filter.Status != ORDER_STATUS_OPEN && filter.Status != ORDER_STATUS_FILLED && filter.Status != ORDER_STATUS_CANCELLED {
+		return []AccountOrderTuple{}, "", fmt.Errorf("invalid status")
+	}
+	if filter.OrderType != "" && filter.OrderType != ORDER_TYPE_BUY && filter.OrderType != ORDER_TYPE_SELL {
+		return []AccountOrderTuple{}, "", fmt.Errorf("invalid side")
+	}
+	if !isBase10NumberSequense(cursor) || limit <= 0 {
+		return []AccountOrderTuple{}, "", fmt.Errorf("invalid cursor or limit")
+	}
+
+	conn := store.Get()
+	defer conn.Close()
+
+	var accountOrders []AccountOrderTuple
+	beforeOrderId := cursor
+	for len(accountOrders) < limit {
+		candidates, err := getOrdersFromAccountOrderIndex(conn, uid, beforeOrderId, limit)
+		if err != nil {
+			return []AccountOrderTuple{}, "", fmt.Errorf("database error when retrieving the account orders")
+		}
+
+		for _, candidate := range candidates {
+			beforeOrderId = candidate.OrderId
+			if !accountOrderMatchesFilter(candidate, filter) {
+				continue
+			}
+
+			candidate.Status, err = getOrderStatus(conn, candidate.OrderId)
+			if err != nil {
+				return []AccountOrderTuple{}, "", fmt.Errorf("database error when retrieving the order status")
+			}
+			if filter.Status != "" && candidate.Status != filter.Status {
+				continue
+			}
+
+			accountOrders = append(accountOrders, candidate)
+			if len(accountOrders) == limit {
+				break
+			}
+		}
+
+		if len(candidates) < limit {
+			break
+		}
+	}
+
+	var nextCursor string
+	if len(accountOrders) == limit {
+		nextCursor = accountOrders[limit-1].OrderId
+	}
+
+	return accountOrders, nextCursor, nil
+}
+
 /*
 		QueryOrderStatusAndHistory query open order, executed history and cancelled order history with order id.
 	input --
+		requesterUid: user id of the requester, MUST BE the account which placed the order
 		orderId: order id.
 	output --
 		a list of open order tuples, a list of executed order history tuples, a list of cancelled order history tuples,
 		eg: if no open order is found for this order id(i.e. the order has been cancelled), the list of open order tuples will be empty
 		err:
 		If no open order with order id exists, an error message is returned
+		If requesterUid did not place the order, an error message is returned
 */
-func QueryOrderStatusAndHistory(pool *redigo.Pool, orderId string) ([]OpenOrderTuple, []ExecutedOrderHistoryTuple, []CancelledOrderHistoryTuple, error) {
-	connection := pool.Get()
-	defer connection.Close()
-	conn := (&connection)
+func QueryOrderStatusAndHistory(store storage.Storage, requesterUid string, orderId string) ([]OpenOrderTuple, []ExecutedOrderHistoryTuple, []CancelledOrderHistoryTuple, error) {
+	conn := store.Get()
+	defer conn.Close()
 
 	var exists_in_executed_history, exists_in_cancel_history, exists_in_open_orders bool
 	var err error
@@ -343,6 +821,11 @@ func QueryOrderStatusAndHistory(pool *redigo.Pool, orderId string) ([]OpenOrderT
 		return []OpenOrderTuple{}, []ExecutedOrderHistoryTuple{}, []CancelledOrderHistoryTuple{}, fmt.Errorf("no such order exists")
 	}
 
+	err = checkOrderOwner(conn, requesterUid, orderId)
+	if err != nil {
+		return []OpenOrderTuple{}, []ExecutedOrderHistoryTuple{}, []CancelledOrderHistoryTuple{}, err
+	}
+
 	var executedOrderHistoryQueryResult []ExecutedOrderHistoryTuple
 	if exists_in_executed_history {
 		var executed_history_node_list []string
@@ -388,6 +871,202 @@ func QueryOrderStatusAndHistory(pool *redigo.Pool, orderId string) ([]OpenOrderT
 	return openOrderQueryResult, executedOrderHistoryQueryResult, cancelledOrderHistoryQueryResult, nil
 }
 
+/*
+		QueryOrderBookDepth query the aggregated price levels of the buy and sell order books of a symbol.
+		Each level reports its price, the total open amount and the number of open orders at that price.
+	input --
+		symbolName: the symbol of the order books
+		depth: the maximum number of price levels to return for each side, should be positive
+	output --
+		a list of bid levels(highest price first), a list of ask levels(lowest price first)
+		eg: if the buy order book is empty, the list of bid levels will be empty
+		err:
+		if depth does not meet input restriction, an error message will be returned
+		if database fails to retrieve the levels, an error message will be returned
+*/
+func QueryOrderBookDepth(store storage.Storage, symbolName string, depth int) ([]OrderBookLevelTuple, []OrderBookLevelTuple, error) {
+	if depth <= 0 {
+		return []OrderBookLevelTuple{}, []OrderBookLevelTuple{}, fmt.Errorf("invalid depth")
+	}
+
+	conn := store.Get()
+	defer conn.Close()
+
+	bids, err := getOrderBookLevels(conn, ORDER_TYPE_BUY, symbolName, depth)
+	if err != nil {
+		return []OrderBookLevelTuple{}, []OrderBookLevelTuple{}, fmt.Errorf("database error when retrieving the buy order book levels")
+	}
+
+	var asks []OrderBookLevelTuple
+	asks, err = getOrderBookLevels(conn, ORDER_TYPE_SELL, symbolName, depth)
+	if err != nil {
+		return []OrderBookLevelTuple{}, []OrderBookLevelTuple{}, fmt.Errorf("database error when retrieving the sell order book levels")
+	}
+
+	return bids, asks, nil
+}
+
+/*
+		RegisterAdminAccount will allow an account to run admin requests.
+	input --
+		uid: user id, a base-10 digit sequence. The account does not need to exist.
+	output --
+		error:
+		if uid does not meet input restriction, an error message will be returned
+		if database fails to register the admin account, an error message will be returned
+*/
+func RegisterAdminAccount(store storage.Storage, uid string) error {
+	if uid == "" || !isBase10NumberSequense(uid) {
+		return fmt.Errorf("invalid id")
+	}
+
+	conn := store.Get()
+	defer conn.Close()
+
+	err := addAdminAccount(conn, uid)
+	if err != nil {
+		return fmt.Errorf("database error to register an admin account")
+	}
+
+	return nil
+}
+
+/*
+		QueryOrderBookSnapshot query every resting order of a symbol, order by order, in matching priority(buy orders first).
+		The first query(empty cursor) takes a snapshot of both order books and returns its first page,
+		later queries pass the returned cursor to read the next pages from the same snapshot,
+		so the pages stay consistent with each other even if orders are matched in between.
+		A snapshot expires DB_ORDER_BOOK_SNAPSHOT_TTL_SECONDS after it is taken.
+		MAKE SURE no order is matched or cancelled while calling this function with an empty cursor.
+	input --
+		adminUid: user id of the requester, MUST BE an admin account
+		symbolName: the symbol of the order books
+		cursor: empty to take a new snapshot, or the cursor returned by the previous page
+		limit: the maximum number of orders in a page, should be positive
+	output --
+		a list of resting order tuples, the cursor of the next page(empty if this is the last page)
+		err:
+		if adminUid is not an admin account, an error message will be returned
+		if limit or cursor does not meet input restriction, an error message will be returned
+		if the snapshot referred by the cursor has expired, an error message will be returned
+		if database fails to take or read the snapshot, an error message will be returned
+*/
+func QueryOrderBookSnapshot(store storage.Storage, adminUid string, symbolName string, cursor string, limit int) ([]RestingOrderTuple, string, error) {
+	if limit <= 0 {
+		return []RestingOrderTuple{}, "", fmt.Errorf("invalid limit")
+	}
+
+	conn := store.Get()
+	defer conn.Close()
+
+	isAdmin, err := checkAdminAccount(conn, adminUid)
+	if err != nil {
+		return []RestingOrderTuple{}, "", fmt.Errorf("database error when checking admin account")
+	}
+	if !isAdmin {
+		return []RestingOrderTuple{}, "", fmt.Errorf("permission denied")
+	}
+
+	var snapshotId string
+	var offset int
+	if cursor == "" {
+		var newSnapshotId int
+		newSnapshotId, err = uniqueKeyGenerator.GetNewOrderBookSnapshotId(store)
+		if err != nil {
+			return []RestingOrderTuple{}, "", fmt.Errorf("error when generating snapshot id")
+		}
+		snapshotId = strconv.Itoa(newSnapshotId)
+
+		_, err = createOrderBookSnapshot(conn, symbolName, snapshotId)
+		if err != nil {
+			return []RestingOrderTuple{}, "", fmt.Errorf("database error when taking order book snapshot")
+		}
+	} else {
+		snapshotId, offset, err = parseOrderBookSnapshotCursor(cursor)
+		if err != nil {
+			return []RestingOrderTuple{}, "", err
+		}
+
+		var exists bool
+		exists, err = orderBookSnapshotExists(conn, symbolName, snapshotId)
+		if err != nil {
+			return []RestingOrderTuple{}, "", fmt.Errorf("database error when checking order book snapshot")
+		}
+		if !exists {
+			return []RestingOrderTuple{}, "", fmt.Errorf("snapshot expired or does not exist")
+		}
+	}
+
+	restingOrders, numberOfOrders, err := getOrderBookSnapshotPage(conn, symbolName, snapshotId, offset, limit)
+	if err != nil {
+		return []RestingOrderTuple{}, "", fmt.Errorf("database error when reading order book snapshot")
+	}
+
+	var nextCursor string
+	if offset+len(restingOrders) < numberOfOrders {
+		nextCursor = fmt.Sprintf("%s:%d", snapshotId, offset+len(restingOrders))
+	}
+
+	return restingOrders, nextCursor, nil
+}
+
+/*
+		QueryOrderDetail query the details of an order: symbol, order type, limit price, initial amount, entry time,
+		and its state(open/filled/cancelled) with the time it was closed.
+		Details of filled or cancelled orders are kept for OrderArchiveRetention after they are closed.
+	input --
+		requesterUid: user id of the requester, MUST BE the account which placed the order
+		orderId: order id.
+	output --
+		an order detail tuple
+		eg: if the order is open, CloseTime will be empty
+		err:
+		if no open or archived order with order id exists, an error message is returned
+		If requesterUid did not place the order, an error message is returned
+		if database fails to retrieve the order, an error message will be returned
+*/
+func QueryOrderDetail(store storage.Storage, requesterUid string, orderId string) (OrderDetailTuple, error) {
+	conn := store.Get()
+	defer conn.Close()
+
+	exists_in_open_orders, err := checkOrderExists(conn, orderId)
+	if err != nil {
+		return OrderDetailTuple{}, fmt.Errorf("database error when checking the existence in open orders")
+	}
+
+	var exists_in_archived_orders bool
+	if !exists_in_open_orders {
+		exists_in_archived_orders, err = archivedOrderExists(conn, orderId)
+		if err != nil {
+			return OrderDetailTuple{}, fmt.Errorf("database error when checking the existence in archived orders")
+		}
+		if !exists_in_archived_orders {
+			return OrderDetailTuple{}, fmt.Errorf("no such order exists")
+		}
+	}
+
+	err = checkOrderOwner(conn, requesterUid, orderId)
+	if err != nil {
+		return OrderDetailTuple{}, err
+	}
+
+	var orderDetail OrderDetailTuple
+	if exists_in_open_orders {
+		orderDetail, err = getOrderDetail(conn, DB_ORDER_PREFIX+orderId)
+		if err != nil {
+			return OrderDetailTuple{}, fmt.Errorf("database error when retrieving the open order")
+		}
+		orderDetail.State = ORDER_STATUS_OPEN
+		return orderDetail, nil
+	}
+
+	orderDetail, err = getOrderDetail(conn, DB_ORDER_ARCHIVE_PREFIX+orderId)
+	if err != nil {
+		return OrderDetailTuple{}, fmt.Errorf("database error when retrieving the archived order")
+	}
+	return orderDetail, nil
+}
+
 /*
 		MatchOrder will match open order with orderId with possible open orders.
 		If matched, a transaction is executed automatically, and an executed history is inserted.
@@ -411,7 +1090,7 @@ func QueryOrderStatusAndHistory(pool *redigo.Pool, orderId string) ([]OpenOrderT
 		err:
 		database err
 */
-func MatchOrder(conn *redigo.Conn, orderId string, uid string, symbolName string, limitPrice float64, amount float64, orderType string) error {
+func MatchOrder(conn storage.Conn, orderId string, uid string, symbolName string, limitPrice float64, amount float64, orderType string) error {
 	if orderType == ORDER_TYPE_BUY {
 		err := matchForBuyOrder(conn, orderId, uid, symbolName, limitPrice, amount)
 		if err != nil {
@@ -426,7 +1105,7 @@ func MatchOrder(conn *redigo.Conn, orderId string, uid string, symbolName string
 	return nil
 }
 
-func matchForBuyOrder(conn *redigo.Conn, orderId string, uid string, symbolName string, limitPrice float64, amount float64) error {
+func matchForBuyOrder(conn storage.Conn, orderId string, uid string, symbolName string, limitPrice float64, amount float64) error {
 	buyOrderId := orderId
 	for {
 		empty, err := isSellOrderBookEmpty(conn, symbolName)
@@ -464,7 +1143,7 @@ func matchForBuyOrder(conn *redigo.Conn, orderId string, uid string, symbolName
 	}
 }
 
-func matchForSellOrder(conn *redigo.Conn, orderId string, uid string, symbolName string, limitPrice float64, amount float64) error {
+func matchForSellOrder(conn storage.Conn, orderId string, uid string, symbolName string, limitPrice float64, amount float64) error {
 	sellOrderId := orderId
 	for {
 		empty, err := isBuyOrderBookEmpty(conn, symbolName)
@@ -505,11 +1184,14 @@ func matchForSellOrder(conn *redigo.Conn, orderId string, uid string, symbolName
 /*
 		executeMatch does a transaction between a matched buy/sell orders pair.
 		An executed history is added into executed history when execution is done.
+		The execution is recorded once in the trade log of the symbol with a unique trade id,
+		and both orders' executed histories refer to that trade id.
 		This function will NOT check if the orders match or not. The user has to make sure two orders match.
 		Since executed history does not contain info about orderType(buy/sell), we set transaction amount in executed hitory to negative as "sell"
 		This function will NOT validate both orders existence and openness
-		This function will atomatically remove orders when an order's amount become 0(empty order).
+		This function will atomatically remove orders when an order's amount become 0(empty order), removed orders are archived as filled.
 		This function will also remove the order which inits the transaction when it becomes empty.
+		Every write of the execution is committed atomically, a failure leaves none of them.
 	input --
 		buyOrderId: buy order's id
 		sellOrderId: sell order's id
@@ -523,7 +1205,14 @@ func matchForSellOrder(conn *redigo.Conn, orderId string, uid string, symbolName
 		database error
 
 */
-func executeMatch(conn *redigo.Conn, buyOrderId string, sellOrderId string, symbolName string, transInitOrderType string) error {
+func executeMatch(conn storage.Conn, buyOrderId string, sellOrderId string, symbolName string, transInitOrderType string) error {
+	return runAtomically(conn, func(conn storage.Conn) error {
+		return applyMatch(conn, buyOrderId, sellOrderId, symbolName, transInitOrderType)
+	})
+}
+
+// applyMatch does the reads and writes of executeMatch, on the connection of a transaction
+func applyMatch(conn storage.Conn, buyOrderId string, sellOrderId string, symbolName string, transInitOrderType string) error {
 	var sell_order_amount, buy_order_amount float64
 	var err error
 	sell_order_amount, err = GetOrderAmount(conn, sellOrderId)
@@ -564,10 +1253,24 @@ func executeMatch(conn *redigo.Conn, buyOrderId string, sellOrderId string, symb
 		transaction_price = buy_order_limit_price
 	}
 
+	var tradeId int
+	tradeId, err = uniqueKeyGenerator.GetNewTradeId(conn)
+	if err != nil {
+		return fmt.Errorf("error when generating tradeId")
+	}
+
 	_, err = increaseSymbolPosition(conn, buyer_uid, symbolName, transaction_amount)
 	if err != nil {
 		return fmt.Errorf("database error when adding symbol to the buyer's account")
 	}
+	err = increaseReservedSymbolPosition(conn, seller_uid, symbolName, -transaction_amount)
+	if err != nil {
+		return fmt.Errorf("database error when releasing reserved symbol of the seller's account")
+	}
+	err = increaseReservedBalance(conn, buyer_uid, -buy_order_limit_price*transaction_amount)
+	if err != nil {
+		return fmt.Errorf("database error when releasing reserved balance of the buyer's account")
+	}
 
 	_, err = increaseAccountBalance(conn, seller_uid, transaction_price*transaction_amount)
 	if err != nil {
@@ -582,12 +1285,31 @@ func executeMatch(conn *redigo.Conn, buyOrderId string, sellOrderId string, symb
 		}
 	}
 
+	current_time := getCurrentTimeInString()
+	fillPostings := append(
+		journalTransfer(JOURNAL_ASSET_CASH, reservedLedgerAccount(buyer_uid), availableLedgerAccount(seller_uid), transaction_price*transaction_amount),
+		journalTransfer(symbolName, reservedLedgerAccount(seller_uid), availableLedgerAccount(buyer_uid), transaction_amount)...)
+	err = postJournalEntry(conn, JOURNAL_KIND_FILL, strconv.Itoa(tradeId), current_time, fillPostings)
+	if err != nil {
+		return fmt.Errorf("database error when posting the trade to the journal")
+	}
+	if refundToBuyer > 0 {
+		err = postJournalEntry(conn, JOURNAL_KIND_REFUND, strconv.Itoa(tradeId), current_time,
+			journalTransfer(JOURNAL_ASSET_CASH, reservedLedgerAccount(buyer_uid), availableLedgerAccount(buyer_uid), refundToBuyer))
+		if err != nil {
+			return fmt.Errorf("database error when posting the refund to the journal")
+		}
+	}
 	if transaction_amount == buy_order_amount {
 		err = removeBuyOrderFromBuyOrderBook(conn, symbolName, buyOrderId)
 		if err != nil {
 			return fmt.Errorf("database error when removing empty order from buy order book")
 		}
-		err = removeOrder(conn, buyOrderId)
+		err = updateOrderBookLevel(conn, ORDER_TYPE_BUY, symbolName, buy_order_limit_price, -transaction_amount, -1)
+		if err != nil {
+			return fmt.Errorf("database error when removing empty order from buy order book level")
+		}
+		err = archiveOrder(conn, buyOrderId, ORDER_STATUS_FILLED, current_time)
 		if err != nil {
 			return fmt.Errorf("database error when removing empty buy order from buy orders")
 		}
@@ -597,6 +1319,10 @@ func executeMatch(conn *redigo.Conn, buyOrderId string, sellOrderId string, symb
 		if err != nil {
 			return fmt.Errorf("database error when decrease amount from buy order")
 		}
+		err = updateOrderBookLevel(conn, ORDER_TYPE_BUY, symbolName, buy_order_limit_price, -transaction_amount, 0)
+		if err != nil {
+			return fmt.Errorf("database error when decrease amount from buy order book level")
+		}
 	}
 
 	if transaction_amount == sell_order_amount {
@@ -604,7 +1330,11 @@ func executeMatch(conn *redigo.Conn, buyOrderId string, sellOrderId string, symb
 		if err != nil {
 			return fmt.Errorf("database error when removing empty order from sell order book")
 		}
-		err = removeOrder(conn, sellOrderId)
+		err = updateOrderBookLevel(conn, ORDER_TYPE_SELL, symbolName, sell_order_limit_price, -transaction_amount, -1)
+		if err != nil {
+			return fmt.Errorf("database error when removing empty order from sell order book level")
+		}
+		err = archiveOrder(conn, sellOrderId, ORDER_STATUS_FILLED, current_time)
 		if err != nil {
 			return fmt.Errorf("database error when removing empty buy order from sell orders")
 		}
@@ -613,18 +1343,35 @@ func executeMatch(conn *redigo.Conn, buyOrderId string, sellOrderId string, symb
 		if err != nil {
 			return fmt.Errorf("database error when decrease amount from sell order")
 		}
+		err = updateOrderBookLevel(conn, ORDER_TYPE_SELL, symbolName, sell_order_limit_price, -transaction_amount, 0)
+		if err != nil {
+			return fmt.Errorf("database error when decrease amount from sell order book level")
+		}
 	}
 
-	current_time := getCurrentTimeInString()
-	err = InsertExcutedOrderToExcutedHistory(conn, buyOrderId, transaction_amount, transaction_price, current_time)
+	err = insertTradeToTradeLog(conn, strconv.Itoa(tradeId), symbolName, buyOrderId, sellOrderId, transInitOrderType, transaction_price, transaction_amount, current_time)
+	if err != nil {
+		return fmt.Errorf("database error when inserting the trade to trade log")
+	}
+
+	err = InsertExcutedOrderToExcutedHistory(conn, buyOrderId, transaction_amount, transaction_price, current_time, strconv.Itoa(tradeId))
 	if err != nil {
 		return fmt.Errorf("database error when inserting buy order executed history")
 	}
 	// Since executed history does not contain info about orderType(buy/sell), we set transaction amount in executed hitory to negative as "sell"
-	err = InsertExcutedOrderToExcutedHistory(conn, sellOrderId, -transaction_amount, transaction_price, current_time)
+	err = InsertExcutedOrderToExcutedHistory(conn, sellOrderId, -transaction_amount, transaction_price, current_time, strconv.Itoa(tradeId))
 	if err != nil {
 		return fmt.Errorf("database error when inserting sell order executed history")
 	}
 
+	err = updateTickerWithTrade(conn, symbolName, transaction_price, transaction_amount, current_time)
+	if err != nil {
+		return fmt.Errorf("database error when updating the ticker")
+	}
+	err = updateCandlesWithTrade(conn, symbolName, transaction_price, transaction_amount, current_time)
+	if err != nil {
+		return fmt.Errorf("database error when updating the candles")
+	}
+
 	return nil
 }
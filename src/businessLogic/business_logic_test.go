@@ -0,0 +1,445 @@
+package businessLogic
+
+import (
+	"app/storage"
+	"fmt"
+	"testing"
+)
+
+const TEST_ADMIN_UID = "1"
+
+// newTestStore returns a memory store with an admin account and the accounts of balances, each holding 100 SPY
+func newTestStore(t *testing.T, balances map[string]float64) storage.Storage {
+	store := storage.NewMemoryStorage()
+	err := RegisterAdminAccount(store, TEST_ADMIN_UID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for uid, balance := range balances {
+		err = CreateAccount(store, uid, balance)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = SetOrAddSymbolPositionToAccount(store, uid, "SPY", 100)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return store
+}
+
+// checkAccount fails the test if the balances or the SPY positions of uid are not the expected ones
+func checkAccount(t *testing.T, store storage.Storage, uid string, balance float64, reservedBalance float64, position float64, reservedPosition float64) {
+	conn := store.Get()
+	defer conn.Close()
+
+	gotBalance, gotReservedBalance, err := getAccountBalanceAndReservedBalance(conn, uid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gotPosition, gotReservedPosition, err := getSymbolPositionAndReservedSymbolPosition(conn, uid, "SPY")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotBalance != balance || gotReservedBalance != reservedBalance {
+		t.Errorf("account %s: balance %v reserved %v, want %v reserved %v", uid, gotBalance, gotReservedBalance, balance, reservedBalance)
+	}
+	if gotPosition != position || gotReservedPosition != reservedPosition {
+		t.Errorf("account %s: SPY %v reserved %v, want %v reserved %v", uid, gotPosition, gotReservedPosition, position, reservedPosition)
+	}
+}
+
+func TestPlaceOrder(t *testing.T) {
+	tests := []struct {
+		name       string
+		uid        string
+		orderType  string
+		limitPrice float64
+		amount     float64
+		wantErr    string
+		// the balances and SPY positions of account 2 after the order
+		balance, reservedBalance, position, reservedPosition float64
+	}{
+		{"buy", "2", ORDER_TYPE_BUY, 10, 5, "", 950, 50, 100, 0},
+		{"sell", "2", ORDER_TYPE_SELL, 10, 5, "", 1000, 0, 95, 5},
+		{"buy all the balance", "2", ORDER_TYPE_BUY, 10, 100, "", 0, 1000, 100, 0},
+		{"buy without the balance", "2", ORDER_TYPE_BUY, 10, 101, "insufficient fund", 1000, 0, 100, 0},
+		{"sell without the symbols", "2", ORDER_TYPE_SELL, 10, 101, "insufficient symbols", 1000, 0, 100, 0},
+		{"zero amount", "2", ORDER_TYPE_BUY, 10, 0, "invalid amount or limit price", 1000, 0, 100, 0},
+		{"negative limit price", "2", ORDER_TYPE_SELL, -1, 5, "invalid amount or limit price", 1000, 0, 100, 0},
+		{"unknown account", "9", ORDER_TYPE_BUY, 10, 5, "user doesn't exist", 1000, 0, 100, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := newTestStore(t, map[string]float64{"2": 1000})
+
+			var err error
+			if test.orderType == ORDER_TYPE_BUY {
+				err = SetBuyOrder(store, "100", test.uid, "SPY", test.limitPrice, test.amount)
+			} else {
+				err = SetSellOrder(store, "100", test.uid, "SPY", test.limitPrice, test.amount)
+			}
+			if test.wantErr == "" && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if test.wantErr != "" && (err == nil || err.Error() != test.wantErr) {
+				t.Fatalf("error %v, want %s", err, test.wantErr)
+			}
+
+			checkAccount(t, store, "2", test.balance, test.reservedBalance, test.position, test.reservedPosition)
+		})
+	}
+
+	t.Run("symbol named cash", func(t *testing.T) {
+		store := newTestStore(t, map[string]float64{"2": 1000})
+		err := SetBuyOrder(store, "100", "2", JOURNAL_ASSET_CASH, 10, 5)
+		if err == nil || err.Error() != "invalid symbol name cash" {
+			t.Fatalf("error %v, want invalid symbol name cash", err)
+		}
+		err = SetOrAddSymbolPositionToAccount(store, "2", JOURNAL_ASSET_CASH, 5)
+		if err == nil || err.Error() != "invalid symbol name cash" {
+			t.Fatalf("error %v, want invalid symbol name cash", err)
+		}
+		checkAccount(t, store, "2", 1000, 0, 100, 0)
+	})
+}
+
+func TestMatchOrder(t *testing.T) {
+	type order struct {
+		orderId    string
+		uid        string
+		orderType  string
+		limitPrice float64
+		amount     float64
+	}
+	tests := []struct {
+		name   string
+		orders []order
+		// the balances and SPY positions of the buyer(2) and the seller(3) after the orders
+		buyer, seller [4]float64
+	}{
+		{
+			"no cross",
+			[]order{{"100", "3", ORDER_TYPE_SELL, 11, 5}, {"101", "2", ORDER_TYPE_BUY, 10, 5}},
+			[4]float64{950, 50, 100, 0},
+			[4]float64{1000, 0, 95, 5},
+		},
+		{
+			"full fill at the resting price",
+			[]order{{"100", "3", ORDER_TYPE_SELL, 10, 5}, {"101", "2", ORDER_TYPE_BUY, 12, 5}},
+			[4]float64{950, 0, 105, 0},
+			[4]float64{1050, 0, 95, 0},
+		},
+		{
+			"partial fill keeps the rest resting",
+			[]order{{"100", "2", ORDER_TYPE_BUY, 10, 8}, {"101", "3", ORDER_TYPE_SELL, 10, 5}},
+			[4]float64{920, 30, 105, 0},
+			[4]float64{1050, 0, 95, 0},
+		},
+		{
+			"sweep two levels",
+			[]order{
+				{"100", "3", ORDER_TYPE_SELL, 10, 5},
+				{"101", "3", ORDER_TYPE_SELL, 11, 5},
+				{"102", "2", ORDER_TYPE_BUY, 11, 10},
+			},
+			[4]float64{895, 0, 110, 0},
+			[4]float64{1105, 0, 90, 0},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := newTestStore(t, map[string]float64{"2": 1000, "3": 1000})
+
+			for _, o := range test.orders {
+				var err error
+				if o.orderType == ORDER_TYPE_BUY {
+					err = SetBuyOrder(store, o.orderId, o.uid, "SPY", o.limitPrice, o.amount)
+				} else {
+					err = SetSellOrder(store, o.orderId, o.uid, "SPY", o.limitPrice, o.amount)
+				}
+				if err != nil {
+					t.Fatalf("order %s: %v", o.orderId, err)
+				}
+			}
+
+			checkAccount(t, store, "2", test.buyer[0], test.buyer[1], test.buyer[2], test.buyer[3])
+			checkAccount(t, store, "3", test.seller[0], test.seller[1], test.seller[2], test.seller[3])
+		})
+	}
+}
+
+func TestCancelOpenOrder(t *testing.T) {
+	tests := []struct {
+		name         string
+		requesterUid string
+		orderId      string
+		wantErr      bool
+		// the balances and SPY positions of account 2 after the cancel
+		balance, reservedBalance float64
+	}{
+		{"cancel refunds the reservation", "2", "100", false, 1000, 0},
+		{"not your order", "3", "100", true, 950, 50},
+		{"unknown order", "2", "999", true, 950, 50},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := newTestStore(t, map[string]float64{"2": 1000, "3": 1000})
+			err := SetBuyOrder(store, "100", "2", "SPY", 10, 5)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = CancelOpenOrder(store, test.requesterUid, test.orderId)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("error %v, want error %v", err, test.wantErr)
+			}
+
+			checkAccount(t, store, "2", test.balance, test.reservedBalance, 100, 0)
+		})
+	}
+
+	t.Run("cancel twice", func(t *testing.T) {
+		store := newTestStore(t, map[string]float64{"2": 1000})
+		err := SetSellOrder(store, "100", "2", "SPY", 10, 5)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = CancelOpenOrder(store, "2", "100")
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = CancelOpenOrder(store, "2", "100")
+		if err == nil {
+			t.Fatal("cancelling a cancelled order succeeded")
+		}
+		checkAccount(t, store, "2", 1000, 0, 100, 0)
+	})
+}
+
+func TestDepositAndWithdraw(t *testing.T) {
+	tests := []struct {
+		name      string
+		adminUid  string
+		uid       string
+		deposit   bool
+		amount    float64
+		wantErr   string
+		balance   float64
+		movements int
+	}{
+		{"deposit", TEST_ADMIN_UID, "2", true, 250, "", 1250, 2},
+		{"withdraw", "", "2", false, 250, "", 750, 2},
+		{"withdraw the whole balance", "", "2", false, 1000, "", 0, 2},
+		{"withdraw more than the balance", "", "2", false, 1000.01, "insufficient funds", 1000, 1},
+		{"deposit zero", TEST_ADMIN_UID, "2", true, 0, "invalid amount", 1000, 1},
+		{"withdraw a negative amount", "", "2", false, -5, "invalid amount", 1000, 1},
+		{"deposit to an unknown account", TEST_ADMIN_UID, "9", true, 10, "user doesn't exist", 1000, 1},
+		{"deposit by a non-admin", "2", "2", true, 10, "permission denied", 1000, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := newTestStore(t, map[string]float64{"2": 1000})
+
+			var err error
+			if test.deposit {
+				_, err = Deposit(store, test.adminUid, test.uid, test.amount, "test")
+			} else {
+				_, err = Withdraw(store, test.uid, test.amount, "test")
+			}
+			if test.wantErr == "" && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if test.wantErr != "" && (err == nil || err.Error() != test.wantErr) {
+				t.Fatalf("error %v, want %s", err, test.wantErr)
+			}
+
+			checkAccount(t, store, "2", test.balance, 0, 100, 0)
+			// the initial balance, then the movement if it succeeded
+			movements, err := QueryCashLedger(store, "2", "2", 0, 100)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(movements) != test.movements {
+				t.Errorf("%d cash movements, want %d", len(movements), test.movements)
+			}
+		})
+	}
+
+	t.Run("reserved balance can not be withdrawn", func(t *testing.T) {
+		store := newTestStore(t, map[string]float64{"2": 1000})
+		err := SetBuyOrder(store, "100", "2", "SPY", 10, 50)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = Withdraw(store, "2", 600, "test")
+		if err == nil || err.Error() != "insufficient funds" {
+			t.Fatalf("error %v, want insufficient funds", err)
+		}
+		checkAccount(t, store, "2", 500, 500, 100, 0)
+	})
+}
+
+func TestTransfer(t *testing.T) {
+	tests := []struct {
+		name       string
+		adminUid   string
+		fromUid    string
+		toUid      string
+		symbolName string
+		amount     float64
+		wantErr    string
+		// the balances and SPY positions of accounts 2 and 3 after the transfer
+		from, to [2]float64
+	}{
+		{"cash", TEST_ADMIN_UID, "2", "3", "", 300, "", [2]float64{700, 100}, [2]float64{1300, 100}},
+		{"symbol", TEST_ADMIN_UID, "2", "3", "SPY", 40, "", [2]float64{1000, 60}, [2]float64{1000, 140}},
+		{"not an admin", "2", "2", "3", "", 300, "permission denied", [2]float64{1000, 100}, [2]float64{1000, 100}},
+		{"insufficient funds", TEST_ADMIN_UID, "2", "3", "", 1000.5, "insufficient funds", [2]float64{1000, 100}, [2]float64{1000, 100}},
+		{"insufficient symbols", TEST_ADMIN_UID, "2", "3", "SPY", 101, "insufficient symbols", [2]float64{1000, 100}, [2]float64{1000, 100}},
+		{"same account", TEST_ADMIN_UID, "2", "2", "", 10, "cannot transfer to the same account", [2]float64{1000, 100}, [2]float64{1000, 100}},
+		{"unknown account", TEST_ADMIN_UID, "2", "9", "", 10, "user 9 doesn't exist", [2]float64{1000, 100}, [2]float64{1000, 100}},
+		{"symbol named cash", TEST_ADMIN_UID, "2", "3", "cash", 10, "invalid symbol name cash", [2]float64{1000, 100}, [2]float64{1000, 100}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := newTestStore(t, map[string]float64{"2": 1000, "3": 1000})
+
+			_, err := Transfer(store, test.adminUid, test.fromUid, test.toUid, test.symbolName, test.amount, "test")
+			if test.wantErr == "" && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if test.wantErr != "" && (err == nil || err.Error() != test.wantErr) {
+				t.Fatalf("error %v, want %s", err, test.wantErr)
+			}
+
+			checkAccount(t, store, "2", test.from[0], 0, test.from[1], 0)
+			checkAccount(t, store, "3", test.to[0], 0, test.to[1], 0)
+		})
+	}
+
+	t.Run("symbol to an account without the position", func(t *testing.T) {
+		store := newTestStore(t, map[string]float64{"2": 1000})
+		err := CreateAccount(store, "4", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = Transfer(store, TEST_ADMIN_UID, "2", "4", "SPY", 25, "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkAccount(t, store, "2", 1000, 0, 75, 0)
+		checkAccount(t, store, "4", 0, 0, 25, 0)
+	})
+}
+
+func TestPreTradeRiskGrossPosition(t *testing.T) {
+	type order struct {
+		orderType  string
+		limitPrice float64
+		amount     float64
+	}
+	tests := []struct {
+		name     string
+		maxGross float64
+		// orders of account 2 resting before the checked order, at prices which do not cross
+		resting []order
+		order   order
+		wantErr string
+	}{
+		{"sell at the limit", 100, nil, order{ORDER_TYPE_SELL, 20, 50}, ""},
+		{"sell the whole position at the limit", 100, nil, order{ORDER_TYPE_SELL, 20, 100}, ""},
+		{"sell with a resting sell at the limit", 100, []order{{ORDER_TYPE_SELL, 20, 40}}, order{ORDER_TYPE_SELL, 21, 60}, ""},
+		{"buy at the limit", 100, nil, order{ORDER_TYPE_BUY, 10, 1}, "risk reject: max gross position 100 exceeded"},
+		{"buy up to the limit", 150, nil, order{ORDER_TYPE_BUY, 10, 50}, ""},
+		{"buy over the limit", 150, []order{{ORDER_TYPE_BUY, 9, 30}}, order{ORDER_TYPE_BUY, 10, 21}, "risk reject: max gross position 150 exceeded"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := newTestStore(t, map[string]float64{"2": 1000})
+			err := SetRiskLimits(store, TEST_ADMIN_UID, "2", "SPY", RiskLimitTuple{MaxGrossPosition: test.maxGross})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			placeOrder := func(orderId string, o order) error {
+				if o.orderType == ORDER_TYPE_BUY {
+					return SetBuyOrder(store, orderId, "2", "SPY", o.limitPrice, o.amount)
+				}
+				return SetSellOrder(store, orderId, "2", "SPY", o.limitPrice, o.amount)
+			}
+			for i, o := range test.resting {
+				err = placeOrder(fmt.Sprintf("%d", 100+i), o)
+				if err != nil {
+					t.Fatalf("resting order: %v", err)
+				}
+			}
+
+			err = placeOrder("200", test.order)
+			if test.wantErr == "" && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if test.wantErr != "" && (err == nil || err.Error() != test.wantErr) {
+				t.Fatalf("error %v, want %s", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestQueryTickerAcrossSessions(t *testing.T) {
+	store := newTestStore(t, map[string]float64{"2": 1000, "3": 1000})
+	defer ClearCommandTime()
+	firstSession := int64(20000) * SECONDS_PER_SESSION
+
+	trade := func(orderId string, price float64) {
+		err := SetSellOrder(store, orderId+"1", "3", "SPY", price, 5)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = SetBuyOrder(store, orderId+"2", "2", "SPY", price, 5)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		time int64
+		// the price of a trade before the query, 0 for no trade
+		tradePrice float64
+		want       TickerTuple
+	}{
+		{"first trade", firstSession + 100, 10, TickerTuple{
+			LastPrice: "10.000000", LastAmount: "5.000000", LastTime: fmt.Sprintf("%d", firstSession+100),
+			Open: "10.000000", High: "10.000000", Low: "10.000000", Close: "10.000000", Volume: "5.000000", Notional: "50.000000"}},
+		{"second trade in the session", firstSession + 200, 12, TickerTuple{
+			LastPrice: "12.000000", LastAmount: "5.000000", LastTime: fmt.Sprintf("%d", firstSession+200),
+			Open: "10.000000", High: "12.000000", Low: "10.000000", Close: "12.000000", Volume: "10.000000", Notional: "110.000000"}},
+		{"next session without a trade", firstSession + SECONDS_PER_SESSION + 100, 0, TickerTuple{
+			LastPrice: "12.000000", LastAmount: "5.000000", LastTime: fmt.Sprintf("%d", firstSession+200)}},
+		{"first trade of the next session", firstSession + SECONDS_PER_SESSION + 200, 11, TickerTuple{
+			LastPrice: "11.000000", LastAmount: "5.000000", LastTime: fmt.Sprintf("%d", firstSession+SECONDS_PER_SESSION+200),
+			Open: "11.000000", High: "11.000000", Low: "11.000000", Close: "11.000000", Volume: "5.000000", Notional: "55.000000"}},
+	}
+
+	for i, test := range tests {
+		SetCommandTime(test.time)
+		if test.tradePrice > 0 {
+			trade(fmt.Sprintf("%d", 100+i), test.tradePrice)
+		}
+
+		ticker, err := QueryTicker(store, "SPY")
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if ticker != test.want {
+			t.Errorf("%s: ticker %+v, want %+v", test.name, ticker, test.want)
+		}
+	}
+}
@@ -2,16 +2,26 @@ package businessLogic
 
 import (
 	"fmt"
-	redis "app/redis"
+	"app/storage"
+	"app/uniqueKeyGenerator"
 	"strconv"
-
-	redigo "github.com/gomodule/redigo/redis"
+	"time"
 )
 
 const (
 	DB_ACCOUNT_PREFIX                   = "account:"
 	DB_ACCOUNT_FIELD_BALANCE            = "balance"
+	DB_ACCOUNT_FIELD_RESERVED           = "reserved"
+	DB_ACCOUNT_SYMBOLS_PREFIX           = "accountSymbols:"
+	DB_ACCOUNT_ORDERS_PREFIX            = "accountOrders:"
+	DB_ACCOUNT_OPEN_ORDERS_PREFIX       = "accountOpenOrders:"
 	DB_SYMBOL_POSITION_FIELD_AMOUNT     = "amount"
+	DB_SYMBOL_POSITION_FIELD_RESERVED   = "reserved"
+	DB_SYMBOL_DEPOSIT_PREFIX            = "symbolDeposit:"
+	DB_SYMBOL_DEPOSIT_FIELD_ACCOUNT     = "account"
+	DB_SYMBOL_DEPOSIT_FIELD_SYMBOL      = "symbol"
+	DB_SYMBOL_DEPOSIT_FIELD_AMOUNT      = "amount"
+	DB_SYMBOL_DEPOSIT_FIELD_TIME        = "time"
 	DB_ORDER_PREFIX                     = "order:"
 	DB_ORDER_FIELD_ACCOUNT              = "account"
 	DB_ORDER_FIELD_SYMBOL               = "symbol"
@@ -19,8 +29,17 @@ const (
 	DB_ORDER_FIELD_ORDER_CURRENT_AMOUNT = "amount"
 	DB_ORDER_FIELD_ORDER_INITIAL_AMOUNT = "origAmount"
 	DB_ORDER_FIELD_ORDER_TYPE           = "orderType"
+	DB_ORDER_FIELD_TIME                 = "time"
+	DB_ORDER_ARCHIVE_PREFIX             = "order-archive:"
+	DB_ORDER_ARCHIVE_FIELD_STATE        = "state"
+	DB_ORDER_ARCHIVE_FIELD_CLOSE_TIME   = "closeTime"
+	DB_ORDER_ARCHIVE_FIELD_EXPIRE_AT    = "expireAt"
 	DB_BUY_ORDER_BOOK_PREFIX            = "openBuyOrderBook:"
 	DB_SELL_ORDER_BOOK_PREFIX           = "openSellOrderBook:"
+	DB_BUY_ORDER_BOOK_LEVELS_PREFIX     = "openBuyOrderBookLevels:"
+	DB_SELL_ORDER_BOOK_LEVELS_PREFIX    = "openSellOrderBookLevels:"
+	DB_ORDER_BOOK_LEVEL_FIELD_AMOUNT    = "amount"
+	DB_ORDER_BOOK_LEVEL_FIELD_COUNT     = "count"
 	DB_CANCEL_HISTORY_PREFIX            = "order-cancel:"
 	DB_CANCEL_HISTORY_FIELD_AMOUNT      = "amount"
 	DB_CANCEL_HISOTRY_FIELD_TIME        = "time"
@@ -28,16 +47,45 @@ const (
 	DB_EXECUTED_HISTORY_FIELD_AMOUNT    = "amount"
 	DB_EXECUTED_HISTORY_FIELD_LIMIT     = "limit"
 	DB_EXECUTED_HISOTRY_FIELD_TIME      = "time"
+	DB_ADMIN_ACCOUNTS                   = "adminAccounts"
+	DB_ORDER_BOOK_SNAPSHOT_PREFIX       = "orderBookSnapshot:"
+	DB_ORDER_BOOK_SNAPSHOT_TTL_SECONDS  = 300
 )
 
+// how long an archived order is kept after it is filled or cancelled, 0 to keep it forever
+var OrderArchiveRetention = 7 * 24 * time.Hour
+
+/*
+		Run step atomically: its writes are applied together. If step returns an error, none of its writes are applied.
+		With Redis, a write which fails when the transaction is committed does not roll back the others, see storage.Conn.
+		Reads in step should be done before the writes to the same key, see storage.Conn.
+		Ids generated in step are not returned if step fails, they are skipped.
+	input --
+		step: reads and writes through the connection it is given, and NOT through conn
+	err --
+		from step, from Atomically
+*/
+func runAtomically(conn storage.Conn, step func(conn storage.Conn) error) error {
+	stepFailed := false
+	err := conn.Atomically(func(conn storage.Conn) error {
+		err := step(conn)
+		stepFailed = err != nil
+		return err
+	})
+	if err != nil && !stepFailed {
+		return fmt.Errorf("database error when committing the transaction")
+	}
+	return err
+}
+
 /*
 		Create an Account with uid and balance. This function will NOT check if the account exists, User has to MAKE SURE that the account exists.
 	input --
 		uid: user id, no restriction on the length and characters
 		balance: initial user balance, no restriction on the amount, can be negative
 */
-func createAccount(conn *redigo.Conn, uid string, balance float64) error {
-	return redis.HMSet(conn, DB_ACCOUNT_PREFIX+uid, map[string]interface{}{DB_ACCOUNT_FIELD_BALANCE: balance})
+func createAccount(conn storage.Conn, uid string, balance float64) error {
+	return conn.HMSet(DB_ACCOUNT_PREFIX+uid, map[string]interface{}{DB_ACCOUNT_FIELD_BALANCE: balance})
 }
 
 /*
@@ -45,8 +93,8 @@ func createAccount(conn *redigo.Conn, uid string, balance float64) error {
 	input --
 		uid: user id, no restriction on the length and characters
 */
-func checkAccountExists(conn *redigo.Conn, uid string) (bool, error) {
-	return redis.Exists(conn, DB_ACCOUNT_PREFIX+uid)
+func checkAccountExists(conn storage.Conn, uid string) (bool, error) {
+	return conn.Exists(DB_ACCOUNT_PREFIX+uid)
 }
 
 /*
@@ -58,8 +106,8 @@ func checkAccountExists(conn *redigo.Conn, uid string) (bool, error) {
 	err --
 		from HGET, from strconv.ParseFloat
 */
-func GetAccountBalance(conn *redigo.Conn, uid string) (float64, error) {
-	balance_in_string, err := redis.HGet(conn, DB_ACCOUNT_PREFIX+uid, DB_ACCOUNT_FIELD_BALANCE)
+func GetAccountBalance(conn storage.Conn, uid string) (float64, error) {
+	balance_in_string, err := conn.HGet(DB_ACCOUNT_PREFIX+uid, DB_ACCOUNT_FIELD_BALANCE)
 	if err != nil {
 		return 0, err
 	}
@@ -77,8 +125,8 @@ func GetAccountBalance(conn *redigo.Conn, uid string) (float64, error) {
 	err --
 		from HIncrByFloat, from strconv.ParseFloat
 */
-func increaseAccountBalance(conn *redigo.Conn, uid string, amount float64) (float64, error) {
-	balance_after_incr_in_string, err := redis.HIncrByFloat(conn, DB_ACCOUNT_PREFIX+uid, DB_ACCOUNT_FIELD_BALANCE, amount)
+func increaseAccountBalance(conn storage.Conn, uid string, amount float64) (float64, error) {
+	balance_after_incr_in_string, err := conn.HIncrByFloat(DB_ACCOUNT_PREFIX+uid, DB_ACCOUNT_FIELD_BALANCE, amount)
 	if err != nil {
 		return 0, err
 	}
@@ -96,9 +144,9 @@ func increaseAccountBalance(conn *redigo.Conn, uid string, amount float64) (floa
 	err --
 		from HIncrByFloat, from strconv.ParseFloat
 */
-func decreaseAccountBalance(conn *redigo.Conn, uid string, amount float64) (float64, error) {
+func decreaseAccountBalance(conn storage.Conn, uid string, amount float64) (float64, error) {
 	minus_amount := -amount
-	balance_after_incr_in_string, err := redis.HIncrByFloat(conn, DB_ACCOUNT_PREFIX+uid, DB_ACCOUNT_FIELD_BALANCE, minus_amount)
+	balance_after_incr_in_string, err := conn.HIncrByFloat(DB_ACCOUNT_PREFIX+uid, DB_ACCOUNT_FIELD_BALANCE, minus_amount)
 	if err != nil {
 		return 0, err
 	}
@@ -106,19 +154,113 @@ func decreaseAccountBalance(conn *redigo.Conn, uid string, amount float64) (floa
 	return strconv.ParseFloat(balance_after_incr_in_string, 64)
 }
 
+/*
+		Increase the balance reserved by an Account's open buy orders using uid.
+		The reserved balance has already been deducted from the account's balance.
+		This function will NOT check if the account exists, User has to MAKE SURE that the account exists.
+	input --
+		uid: user id, no restriction on the length and characters
+		amount: the amount you want to increase, will accept negative
+	err --
+		from HIncrByFloat
+*/
+func increaseReservedBalance(conn storage.Conn, uid string, amount float64) error {
+	_, err := conn.HIncrByFloat(DB_ACCOUNT_PREFIX+uid, DB_ACCOUNT_FIELD_RESERVED, amount)
+	return err
+}
+
+/*
+		Get an Account's balance and the balance reserved by its open buy orders using uid.
+		This function will NOT check if the account exists, User has to MAKE SURE that the account exists.
+	input --
+		uid: user id, no restriction on the length and characters
+	output --
+		return the balance and reserved balance in float64
+	err --
+		from HMGet, from strconv.ParseFloat
+*/
+func getAccountBalanceAndReservedBalance(conn storage.Conn, uid string) (float64, float64, error) {
+	balance_n_reserved, err := conn.HMGet(DB_ACCOUNT_PREFIX+uid, []string{DB_ACCOUNT_FIELD_BALANCE, DB_ACCOUNT_FIELD_RESERVED})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var balance, reserved float64
+	balance, err = parseFloatOrZero(balance_n_reserved[0])
+	if err != nil {
+		return 0, 0, err
+	}
+	reserved, err = parseFloatOrZero(balance_n_reserved[1])
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return balance, reserved, nil
+}
+
 /*
 		Set a symbol position(amount) to an account using uid and symbol name.
 		This function will NOT check if the account exists, or the position User has to MAKE SURE that the account exists.
 		If the symbol position to that account does not exist, this function will create and set that symbol position to input amount
 		If the symbol position already exists, this fucntion will UPDATE that symbol position to input amount
+		The symbol is added to the account's symbol index.
 	input --
 		uid: user id, no restriction on the length and characters
 		symbolName: symbol Name, no restriction on the length and characters
 		amount: initial symbol position amount to the account, no restriction on the amount, can be negative
 */
-func setSymbolPosition(conn *redigo.Conn, uid string, symbolName string, amount float64) error {
+func setSymbolPosition(conn storage.Conn, uid string, symbolName string, amount float64) error {
 	key := DB_ACCOUNT_PREFIX + uid + ":" + symbolName
-	return redis.HMSet(conn, key, map[string]interface{}{DB_SYMBOL_POSITION_FIELD_AMOUNT: amount})
+	err := conn.HMSet(key, map[string]interface{}{DB_SYMBOL_POSITION_FIELD_AMOUNT: amount})
+	if err != nil {
+		return err
+	}
+
+	return conn.SAdd(DB_ACCOUNT_SYMBOLS_PREFIX+uid, symbolName)
+}
+
+/*
+		Record a symbol deposit into an account, with a new symbol deposit id, the reference of its journal entry.
+	input --
+		uid: user id, no restriction on the length and characters
+		symbolName: symbol Name, no restriction on the length and characters
+		amount: the deposited amount
+	output --
+		the symbol deposit id and the time of the deposit
+	err --
+		from Incr, HMSet
+*/
+func insertSymbolDeposit(conn storage.Conn, uid string, symbolName string, amount float64) (string, string, error) {
+	id, err := uniqueKeyGenerator.GetNewSymbolDepositId(conn)
+	if err != nil {
+		return "", "", err
+	}
+	depositId := strconv.Itoa(id)
+	current_time := getCurrentTimeInString()
+
+	err = conn.HMSet(
+		DB_SYMBOL_DEPOSIT_PREFIX+depositId,
+		map[string]interface{}{
+			DB_SYMBOL_DEPOSIT_FIELD_ACCOUNT: uid,
+			DB_SYMBOL_DEPOSIT_FIELD_SYMBOL:  symbolName,
+			DB_SYMBOL_DEPOSIT_FIELD_AMOUNT:  amount,
+			DB_SYMBOL_DEPOSIT_FIELD_TIME:    current_time})
+	if err != nil {
+		return "", "", err
+	}
+	return depositId, current_time, nil
+}
+
+/*
+		Get all symbol names an account has held a symbol position for.
+		This function will NOT check if the account exists. If it does not, an EMPTY list is returned.
+	input --
+		uid: user id, no restriction on the length and characters
+	err --
+		from SMembers
+*/
+func getAccountSymbols(conn storage.Conn, uid string) ([]string, error) {
+	return conn.SMembers(DB_ACCOUNT_SYMBOLS_PREFIX+uid)
 }
 
 /*
@@ -127,9 +269,9 @@ func setSymbolPosition(conn *redigo.Conn, uid string, symbolName string, amount
 		uid: user id, no restriction on the length and characters
 		symbolName: symbol Name, no restriction on the length and characters
 */
-func checkSymbolPositionExists(conn *redigo.Conn, uid string, symbolName string) (bool, error) {
+func checkSymbolPositionExists(conn storage.Conn, uid string, symbolName string) (bool, error) {
 	key := DB_ACCOUNT_PREFIX + uid + ":" + symbolName
-	return redis.Exists(conn, key)
+	return conn.Exists(key)
 }
 
 /*
@@ -143,9 +285,9 @@ func checkSymbolPositionExists(conn *redigo.Conn, uid string, symbolName string)
 		from HGET, from strconv.ParseFloat
 
 */
-func GetSymbolPosition(conn *redigo.Conn, uid string, symbolName string) (float64, error) {
+func GetSymbolPosition(conn storage.Conn, uid string, symbolName string) (float64, error) {
 	key := DB_ACCOUNT_PREFIX + uid + ":" + symbolName
-	amount_in_string, err := redis.HGet(conn, key, DB_SYMBOL_POSITION_FIELD_AMOUNT)
+	amount_in_string, err := conn.HGet(key, DB_SYMBOL_POSITION_FIELD_AMOUNT)
 	if err != nil {
 		return 0, err
 	}
@@ -155,7 +297,8 @@ func GetSymbolPosition(conn *redigo.Conn, uid string, symbolName string) (float6
 
 /*
 		Increase a symbol position amount associated with an account.
-		This function will NOT check if the account or the symbol position in the account exists, User has to MAKE SURE that they exist.
+		If the symbol position in the account does not exist, it will be created, and the symbol is added to the account's symbol index.
+		This function will NOT check if the account exists, User has to MAKE SURE that it exists.
 	input --
 		uid: user id, no restriction on the length and characters
 		symbolName: symbol Name, no restriction on the length and characters
@@ -163,11 +306,16 @@ func GetSymbolPosition(conn *redigo.Conn, uid string, symbolName string) (float6
 	output --
 		return the amount after increasement in float64
 	err --
-		from HIncrByFloat, from strconv.ParseFloat
+		from HIncrByFloat, SAdd, from strconv.ParseFloat
 */
-func increaseSymbolPosition(conn *redigo.Conn, uid string, symbolName string, amount float64) (float64, error) {
+func increaseSymbolPosition(conn storage.Conn, uid string, symbolName string, amount float64) (float64, error) {
 	key := DB_ACCOUNT_PREFIX + uid + ":" + symbolName
-	amount_after_incr_in_string, err := redis.HIncrByFloat(conn, key, DB_SYMBOL_POSITION_FIELD_AMOUNT, amount)
+	amount_after_incr_in_string, err := conn.HIncrByFloat(key, DB_SYMBOL_POSITION_FIELD_AMOUNT, amount)
+	if err != nil {
+		return 0, err
+	}
+
+	err = conn.SAdd(DB_ACCOUNT_SYMBOLS_PREFIX+uid, symbolName)
 	if err != nil {
 		return 0, err
 	}
@@ -187,10 +335,10 @@ func increaseSymbolPosition(conn *redigo.Conn, uid string, symbolName string, am
 	err --
 		from HIncrByFloat, from strconv.ParseFloat
 */
-func decreaseSymbolPosition(conn *redigo.Conn, uid string, symbolName string, amount float64) (float64, error) {
+func decreaseSymbolPosition(conn storage.Conn, uid string, symbolName string, amount float64) (float64, error) {
 	minus_amount := -amount
 	key := DB_ACCOUNT_PREFIX + uid + ":" + symbolName
-	amount_after_decr_in_string, err := redis.HIncrByFloat(conn, key, DB_SYMBOL_POSITION_FIELD_AMOUNT, minus_amount)
+	amount_after_decr_in_string, err := conn.HIncrByFloat(key, DB_SYMBOL_POSITION_FIELD_AMOUNT, minus_amount)
 	if err != nil {
 		return 0, err
 	}
@@ -198,6 +346,54 @@ func decreaseSymbolPosition(conn *redigo.Conn, uid string, symbolName string, am
 	return strconv.ParseFloat(amount_after_decr_in_string, 64)
 }
 
+/*
+		Increase the symbol position amount reserved by an account's open sell orders.
+		The reserved amount has already been deducted from the account's symbol position.
+		This function will NOT check if the account or the symbol position in the account exists, User has to MAKE SURE that they exist.
+	input --
+		uid: user id, no restriction on the length and characters
+		symbolName: symbol Name, no restriction on the length and characters
+		amount: the amount you want to increase, will accept negative
+	err --
+		from HIncrByFloat
+*/
+func increaseReservedSymbolPosition(conn storage.Conn, uid string, symbolName string, amount float64) error {
+	key := DB_ACCOUNT_PREFIX + uid + ":" + symbolName
+	_, err := conn.HIncrByFloat(key, DB_SYMBOL_POSITION_FIELD_RESERVED, amount)
+	return err
+}
+
+/*
+		Get a symbol position amount and the amount reserved by open sell orders associated with an account.
+		If the symbol position does not exist, 0 and 0 are returned.
+	input --
+		uid: user id, no restriction on the length and characters
+		symbolName: symbol Name, no restriction on the length and characters
+	output --
+		return the amount and reserved amount in float64
+	err --
+		from HMGet, from strconv.ParseFloat
+*/
+func getSymbolPositionAndReservedSymbolPosition(conn storage.Conn, uid string, symbolName string) (float64, float64, error) {
+	key := DB_ACCOUNT_PREFIX + uid + ":" + symbolName
+	amount_n_reserved, err := conn.HMGet(key, []string{DB_SYMBOL_POSITION_FIELD_AMOUNT, DB_SYMBOL_POSITION_FIELD_RESERVED})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var amount, reserved float64
+	amount, err = parseFloatOrZero(amount_n_reserved[0])
+	if err != nil {
+		return 0, 0, err
+	}
+	reserved, err = parseFloatOrZero(amount_n_reserved[1])
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return amount, reserved, nil
+}
+
 /*
 		Create an buy Order.
 		This function will NOT validate anything.(old order, account, symbol position, balance...)
@@ -208,9 +404,10 @@ func decreaseSymbolPosition(conn *redigo.Conn, uid string, symbolName string, am
 		symbolName: symbol name, no restriction on the length and characters
 		limitPrice: limit price, can be negative
 		orderAmount: the symbol position amount you want to buy
+		time: entry time of the order
 */
-func createBuyOrder(conn *redigo.Conn, orderId string, uid string, symbolName string, limitPrice float64, orderAmount float64) error {
-	return redis.HMSet(conn,
+func createBuyOrder(conn storage.Conn, orderId string, uid string, symbolName string, limitPrice float64, orderAmount float64, time string) error {
+	return conn.HMSet(
 		DB_ORDER_PREFIX+orderId,
 		map[string]interface{}{
 			DB_ORDER_FIELD_ACCOUNT:              uid,
@@ -218,7 +415,8 @@ func createBuyOrder(conn *redigo.Conn, orderId string, uid string, symbolName st
 			DB_ORDER_FIELD_LIMIT_PRICE:          limitPrice,
 			DB_ORDER_FIELD_ORDER_CURRENT_AMOUNT: orderAmount,
 			DB_ORDER_FIELD_ORDER_INITIAL_AMOUNT: orderAmount,
-			DB_ORDER_FIELD_ORDER_TYPE:           "buy"})
+			DB_ORDER_FIELD_ORDER_TYPE:           "buy",
+			DB_ORDER_FIELD_TIME:                 time})
 }
 
 /*
@@ -231,9 +429,10 @@ func createBuyOrder(conn *redigo.Conn, orderId string, uid string, symbolName st
 		symbolName: symbol name, no restriction on the length and characters
 		limitPrice: limit price, can be negative
 		orderAmount: the symbol position amount you want to sell
+		time: entry time of the order
 */
-func createSellOrder(conn *redigo.Conn, orderId string, uid string, symbolName string, limitPrice float64, orderAmount float64) error {
-	return redis.HMSet(conn,
+func createSellOrder(conn storage.Conn, orderId string, uid string, symbolName string, limitPrice float64, orderAmount float64, time string) error {
+	return conn.HMSet(
 		DB_ORDER_PREFIX+orderId,
 		map[string]interface{}{
 			DB_ORDER_FIELD_ACCOUNT:              uid,
@@ -241,7 +440,8 @@ func createSellOrder(conn *redigo.Conn, orderId string, uid string, symbolName s
 			DB_ORDER_FIELD_LIMIT_PRICE:          limitPrice,
 			DB_ORDER_FIELD_ORDER_CURRENT_AMOUNT: orderAmount,
 			DB_ORDER_FIELD_ORDER_INITIAL_AMOUNT: orderAmount,
-			DB_ORDER_FIELD_ORDER_TYPE:           "sell"})
+			DB_ORDER_FIELD_ORDER_TYPE:           "sell",
+			DB_ORDER_FIELD_TIME:                 time})
 }
 
 /*
@@ -255,8 +455,8 @@ func createSellOrder(conn *redigo.Conn, orderId string, uid string, symbolName s
 		from HGET, from strconv.ParseFloat
 
 */
-func GetOrderAmount(conn *redigo.Conn, orderId string) (float64, error) {
-	amount_in_string, err := redis.HGet(conn, DB_ORDER_PREFIX+orderId, DB_ORDER_FIELD_ORDER_CURRENT_AMOUNT)
+func GetOrderAmount(conn storage.Conn, orderId string) (float64, error) {
+	amount_in_string, err := conn.HGet(DB_ORDER_PREFIX+orderId, DB_ORDER_FIELD_ORDER_CURRENT_AMOUNT)
 	if err != nil {
 		return 0, err
 	}
@@ -275,8 +475,8 @@ func GetOrderAmount(conn *redigo.Conn, orderId string) (float64, error) {
 		from HMGet
 
 */
-func GetSymbolNameAndOrderType(conn *redigo.Conn, orderId string) ([]string, error) {
-	symbolName_n_orderType, err := redis.HMGet(conn, DB_ORDER_PREFIX+orderId, []string{DB_ORDER_FIELD_SYMBOL, DB_ORDER_FIELD_ORDER_TYPE})
+func GetSymbolNameAndOrderType(conn storage.Conn, orderId string) ([]string, error) {
+	symbolName_n_orderType, err := conn.HMGet(DB_ORDER_PREFIX+orderId, []string{DB_ORDER_FIELD_SYMBOL, DB_ORDER_FIELD_ORDER_TYPE})
 	if err != nil {
 		return []string{}, err
 	}
@@ -295,8 +495,8 @@ func GetSymbolNameAndOrderType(conn *redigo.Conn, orderId string) ([]string, err
 		from HGet
 
 */
-func GetOrderUid(conn *redigo.Conn, orderId string) (string, error) {
-	return redis.HGet(conn, DB_ORDER_PREFIX+orderId, DB_ORDER_FIELD_ACCOUNT)
+func GetOrderUid(conn storage.Conn, orderId string) (string, error) {
+	return conn.HGet(DB_ORDER_PREFIX+orderId, DB_ORDER_FIELD_ACCOUNT)
 }
 
 /*
@@ -310,8 +510,8 @@ func GetOrderUid(conn *redigo.Conn, orderId string) (string, error) {
 		from HGet, strconv.ParseFloat
 
 */
-func GetOrderLimitPrice(conn *redigo.Conn, orderId string) (float64, error) {
-	limitPrice_in_string, err := redis.HGet(conn, DB_ORDER_PREFIX+orderId, DB_ORDER_FIELD_LIMIT_PRICE)
+func GetOrderLimitPrice(conn storage.Conn, orderId string) (float64, error) {
+	limitPrice_in_string, err := conn.HGet(DB_ORDER_PREFIX+orderId, DB_ORDER_FIELD_LIMIT_PRICE)
 	if err != nil {
 		return 0, err
 	}
@@ -330,9 +530,9 @@ func GetOrderLimitPrice(conn *redigo.Conn, orderId string) (float64, error) {
 	err --
 		from HIncrByFloat, from strconv.ParseFloat
 */
-func decreaseOrderAmount(conn *redigo.Conn, orderId string, amount float64) (float64, error) {
+func decreaseOrderAmount(conn storage.Conn, orderId string, amount float64) (float64, error) {
 	minus_amount := -amount
-	amount_after_decr_in_string, err := redis.HIncrByFloat(conn, DB_ORDER_PREFIX+orderId, DB_ORDER_FIELD_ORDER_CURRENT_AMOUNT, minus_amount)
+	amount_after_decr_in_string, err := conn.HIncrByFloat(DB_ORDER_PREFIX+orderId, DB_ORDER_FIELD_ORDER_CURRENT_AMOUNT, minus_amount)
 	if err != nil {
 		return 0, err
 	}
@@ -347,8 +547,109 @@ func decreaseOrderAmount(conn *redigo.Conn, orderId string, amount float64) (flo
 	err --
 		from Delete
 */
-func removeOrder(conn *redigo.Conn, orderId string) error {
-	return redis.Delete(conn, DB_ORDER_PREFIX+orderId)
+func removeOrder(conn storage.Conn, orderId string) error {
+	return conn.Delete(DB_ORDER_PREFIX+orderId)
+}
+
+/*
+		Archive an order associated with the orderId, the order is removed from orders and from the open orders of its account.
+		The archived order keeps every field of the order, with its current amount set to 0, its state and its close time.
+		The archived order expires after OrderArchiveRetention.
+		This function will NOT check if the order exists, User has to MAKE SURE that it exist.
+	input --
+		orderId: order id, no restriction on the length and characters, MAKE SURE it exists
+		state: filled/cancelled
+		closeTime: the time the order is filled or cancelled
+	err --
+		from HGet, Rename, SRem, HMSet, Expire
+*/
+func archiveOrder(conn storage.Conn, orderId string, state string, closeTime string) error {
+	archiveKey := DB_ORDER_ARCHIVE_PREFIX + orderId
+	uid, err := conn.HGet(DB_ORDER_PREFIX+orderId, DB_ORDER_FIELD_ACCOUNT)
+	if err != nil {
+		return err
+	}
+
+	err = conn.Rename(DB_ORDER_PREFIX+orderId, archiveKey)
+	if err != nil {
+		return err
+	}
+	err = conn.SRem(DB_ACCOUNT_OPEN_ORDERS_PREFIX+uid, orderId)
+	if err != nil {
+		return err
+	}
+
+	err = conn.HMSet(archiveKey, map[string]interface{}{
+		DB_ORDER_FIELD_ORDER_CURRENT_AMOUNT: 0,
+		DB_ORDER_ARCHIVE_FIELD_STATE:        state,
+		DB_ORDER_ARCHIVE_FIELD_CLOSE_TIME:   closeTime,
+		DB_ORDER_ARCHIVE_FIELD_EXPIRE_AT:    expireAtAfter(OrderArchiveRetention)})
+	if err != nil {
+		return err
+	}
+
+	if OrderArchiveRetention > 0 {
+		return conn.Expire(archiveKey, int(OrderArchiveRetention.Seconds()))
+	}
+	return nil
+}
+
+/*
+		Check an archived order with orderId exists. An expired archived order does not exist,
+		the expiry is checked against the recorded expireAt, so a replay of the command journal sees the same archived orders.
+	input --
+		orderId: order id, no restriction on the length and characters
+	err --
+		from Exists, HGet
+*/
+func archivedOrderExists(conn storage.Conn, orderId string) (bool, error) {
+	exists, err := conn.Exists(DB_ORDER_ARCHIVE_PREFIX + orderId)
+	if err != nil || !exists {
+		return false, err
+	}
+
+	var expireAt string
+	expireAt, err = conn.HGet(DB_ORDER_ARCHIVE_PREFIX+orderId, DB_ORDER_ARCHIVE_FIELD_EXPIRE_AT)
+	if err == storage.ErrNil {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return !hasExpired(expireAt), nil
+}
+
+/*
+		Get the details of an open or archived order.
+		This function will NOT validate if the order exists or not.
+		For an open order, State and CloseTime are empty.
+	input --
+		orderKey: DB_ORDER_PREFIX or DB_ORDER_ARCHIVE_PREFIX followed by order id
+	err --
+		from HMGet
+*/
+func getOrderDetail(conn storage.Conn, orderKey string) (OrderDetailTuple, error) {
+	values, err := conn.HMGet(orderKey, []string{
+		DB_ORDER_FIELD_SYMBOL,
+		DB_ORDER_FIELD_ORDER_TYPE,
+		DB_ORDER_FIELD_LIMIT_PRICE,
+		DB_ORDER_FIELD_ORDER_INITIAL_AMOUNT,
+		DB_ORDER_FIELD_TIME,
+		DB_ORDER_ARCHIVE_FIELD_STATE,
+		DB_ORDER_ARCHIVE_FIELD_CLOSE_TIME})
+	if err != nil {
+		return OrderDetailTuple{}, err
+	}
+
+	return OrderDetailTuple{
+		SymbolName:    values[0],
+		OrderType:     values[1],
+		LimitPrice:    values[2],
+		InitialAmount: values[3],
+		EntryTime:     values[4],
+		State:         values[5],
+		CloseTime:     values[6],
+	}, nil
 }
 
 /*
@@ -358,8 +659,8 @@ func removeOrder(conn *redigo.Conn, orderId string) error {
 	err --
 		from exists
 */
-func checkOrderExists(conn *redigo.Conn, orderId string) (bool, error) {
-	return redis.Exists(conn, DB_ORDER_PREFIX+orderId)
+func checkOrderExists(conn storage.Conn, orderId string) (bool, error) {
+	return conn.Exists(DB_ORDER_PREFIX+orderId)
 }
 
 /*
@@ -371,8 +672,8 @@ func checkOrderExists(conn *redigo.Conn, orderId string) (bool, error) {
 		orderId: order id, no restriction on the length and characters
 		limitPrice: the limit price of this order
 */
-func AddBuyOrderToBuyOrderBook(conn *redigo.Conn, symbolName string, orderId string, limitPrice float64) error {
-	return redis.ZAdd(conn, DB_BUY_ORDER_BOOK_PREFIX+symbolName, limitPrice, orderId)
+func AddBuyOrderToBuyOrderBook(conn storage.Conn, symbolName string, orderId string, limitPrice float64) error {
+	return conn.ZAdd(DB_BUY_ORDER_BOOK_PREFIX+symbolName, limitPrice, orderId)
 }
 
 /*
@@ -384,8 +685,8 @@ func AddBuyOrderToBuyOrderBook(conn *redigo.Conn, symbolName string, orderId str
 		orderId: order id, no restriction on the length and characters
 		limitPrice: the limit price of this order
 */
-func AddSellOrderToSellOrderBook(conn *redigo.Conn, symbolName string, orderId string, limitPrice float64) error {
-	return redis.ZAdd(conn, DB_SELL_ORDER_BOOK_PREFIX+symbolName, limitPrice, orderId)
+func AddSellOrderToSellOrderBook(conn storage.Conn, symbolName string, orderId string, limitPrice float64) error {
+	return conn.ZAdd(DB_SELL_ORDER_BOOK_PREFIX+symbolName, limitPrice, orderId)
 }
 
 /*
@@ -395,8 +696,8 @@ func AddSellOrderToSellOrderBook(conn *redigo.Conn, symbolName string, orderId s
 		symbolName: the symbol that this order belongs to.
 		orderId: order id, no restriction on the length and characters
 */
-func removeBuyOrderFromBuyOrderBook(conn *redigo.Conn, symbolName string, orderId string) error {
-	return redis.ZRem(conn, DB_BUY_ORDER_BOOK_PREFIX+symbolName, orderId)
+func removeBuyOrderFromBuyOrderBook(conn storage.Conn, symbolName string, orderId string) error {
+	return conn.ZRem(DB_BUY_ORDER_BOOK_PREFIX+symbolName, orderId)
 }
 
 /*
@@ -406,8 +707,8 @@ func removeBuyOrderFromBuyOrderBook(conn *redigo.Conn, symbolName string, orderI
 		symbolName: the symbol that this order belongs to.
 		orderId: order id, no restriction on the length and characters
 */
-func removeSellOrderFromSellOrderBook(conn *redigo.Conn, symbolName string, orderId string) error {
-	return redis.ZRem(conn, DB_SELL_ORDER_BOOK_PREFIX+symbolName, orderId)
+func removeSellOrderFromSellOrderBook(conn storage.Conn, symbolName string, orderId string) error {
+	return conn.ZRem(DB_SELL_ORDER_BOOK_PREFIX+symbolName, orderId)
 }
 
 /*
@@ -416,8 +717,8 @@ func removeSellOrderFromSellOrderBook(conn *redigo.Conn, symbolName string, orde
 	input --
 		symbolName: the buy order book's symbol that you want to peek
 */
-func peekBuyOrderWithMaxPriceInBuyOrdrerBook(conn *redigo.Conn, symbolName string) (string, float64, error) {
-	orderId_n_limitPrice, err := redis.ZRevRange(conn, DB_BUY_ORDER_BOOK_PREFIX+symbolName, 0, 0, true)
+func peekBuyOrderWithMaxPriceInBuyOrdrerBook(conn storage.Conn, symbolName string) (string, float64, error) {
+	orderId_n_limitPrice, err := conn.ZRevRange(DB_BUY_ORDER_BOOK_PREFIX+symbolName, 0, 0, true)
 	if err != nil {
 		return "", 0, err
 	} else if len(orderId_n_limitPrice) == 0 {
@@ -440,8 +741,8 @@ func peekBuyOrderWithMaxPriceInBuyOrdrerBook(conn *redigo.Conn, symbolName strin
 	input --
 		symbolName: the sell order book's symbol that you want to peek
 */
-func peekSellOrderWithMinPriceInSellOrdrerBook(conn *redigo.Conn, symbolName string) (string, float64, error) {
-	orderId_n_limitPrice, err := redis.ZRange(conn, DB_SELL_ORDER_BOOK_PREFIX+symbolName, 0, 0, true)
+func peekSellOrderWithMinPriceInSellOrdrerBook(conn storage.Conn, symbolName string) (string, float64, error) {
+	orderId_n_limitPrice, err := conn.ZRange(DB_SELL_ORDER_BOOK_PREFIX+symbolName, 0, 0, true)
 	if err != nil {
 		return "", 0, err
 	} else if len(orderId_n_limitPrice) == 0 {
@@ -463,8 +764,8 @@ func peekSellOrderWithMinPriceInSellOrdrerBook(conn *redigo.Conn, symbolName str
 	input --
 		symbolName: the buy order book symbol that you want to check
 */
-func isBuyOrderBookEmpty(conn *redigo.Conn, symbolName string) (bool, error) {
-	number_of_elements, err := redis.ZCard(conn, DB_BUY_ORDER_BOOK_PREFIX+symbolName)
+func isBuyOrderBookEmpty(conn storage.Conn, symbolName string) (bool, error) {
+	number_of_elements, err := conn.ZCard(DB_BUY_ORDER_BOOK_PREFIX+symbolName)
 	if err != nil {
 		return true, err
 	}
@@ -481,8 +782,8 @@ func isBuyOrderBookEmpty(conn *redigo.Conn, symbolName string) (bool, error) {
 	input --
 		symbolName: the buy order book symbol that you want to check
 */
-func isSellOrderBookEmpty(conn *redigo.Conn, symbolName string) (bool, error) {
-	number_of_elements, err := redis.ZCard(conn, DB_SELL_ORDER_BOOK_PREFIX+symbolName)
+func isSellOrderBookEmpty(conn storage.Conn, symbolName string) (bool, error) {
+	number_of_elements, err := conn.ZCard(DB_SELL_ORDER_BOOK_PREFIX+symbolName)
 	if err != nil {
 		return true, err
 	}
@@ -494,6 +795,418 @@ func isSellOrderBookEmpty(conn *redigo.Conn, symbolName string) (bool, error) {
 	return false, nil
 }
 
+/*
+		Return the key of the sorted set holding the price levels of an order book, and the key of the hash
+		holding the aggregate(total amount, number of orders) of one price level in that order book.
+		Price levels in the sorted set use the formatted price as member and the price as score.
+	input --
+		orderType: buy/sell, decides which order book the level belongs to
+		symbolName: the symbol of the order book
+		limitPrice: the price of the level
+*/
+func getOrderBookLevelKeys(orderType string, symbolName string, limitPrice float64) (string, string) {
+	levelsKey := DB_SELL_ORDER_BOOK_LEVELS_PREFIX + symbolName
+	if orderType == "buy" {
+		levelsKey = DB_BUY_ORDER_BOOK_LEVELS_PREFIX + symbolName
+	}
+
+	return levelsKey, levelsKey + ":" + formatPriceLevel(limitPrice)
+}
+
+/*
+		Update a price level of an order book associated with symbolName.
+		Each price level keeps the total open amount and the number of open orders resting at that price,
+		so that depth queries do not have to scan every order in the order book.
+		The level is created when the first order is added to it, and removed when its last order leaves.
+		This function will NOT check the existence of the order book or of any order.
+	input --
+		orderType: buy/sell, decides which order book the level belongs to
+		symbolName: the symbol of the order book
+		limitPrice: the price of the level
+		amountDelta: the amount you want to add to the level, will accept negative
+		countDelta: the number of orders you want to add to the level, will accept negative
+	err --
+		from HIncrByFloat, HIncrBy, ZAdd, ZRem, Delete
+*/
+func updateOrderBookLevel(conn storage.Conn, orderType string, symbolName string, limitPrice float64, amountDelta float64, countDelta int) error {
+	levelsKey, levelKey := getOrderBookLevelKeys(orderType, symbolName, limitPrice)
+
+	_, err := conn.HIncrByFloat(levelKey, DB_ORDER_BOOK_LEVEL_FIELD_AMOUNT, amountDelta)
+	if err != nil {
+		return err
+	}
+
+	var count int
+	count, err = conn.HIncrBy(levelKey, DB_ORDER_BOOK_LEVEL_FIELD_COUNT, countDelta)
+	if err != nil {
+		return err
+	}
+
+	if count <= 0 {
+		err = conn.Delete(levelKey)
+		if err != nil {
+			return err
+		}
+		return conn.ZRem(levelsKey, formatPriceLevel(limitPrice))
+	}
+
+	if countDelta > 0 {
+		return conn.ZAdd(levelsKey, limitPrice, formatPriceLevel(limitPrice))
+	}
+
+	return nil
+}
+
+/*
+		Return the best price levels of an order book associated with symbolName.
+		Buy levels are returned from the highest price to the lowest, sell levels from the lowest price to the highest.
+		If the order book does not exist, an EMPTY list is returned.
+	input --
+		orderType: buy/sell, decides which order book to read
+		symbolName: the symbol of the order book
+		depth: the maximum number of price levels to return, should be positive
+	err --
+		from ZRange, ZRevRange, HMGet
+*/
+func getOrderBookLevels(conn storage.Conn, orderType string, symbolName string, depth int) ([]OrderBookLevelTuple, error) {
+	var prices []string
+	var err error
+	if orderType == "buy" {
+		prices, err = conn.ZRevRange(DB_BUY_ORDER_BOOK_LEVELS_PREFIX+symbolName, 0, depth-1, false)
+	} else {
+		prices, err = conn.ZRange(DB_SELL_ORDER_BOOK_LEVELS_PREFIX+symbolName, 0, depth-1, false)
+	}
+	if err != nil {
+		return []OrderBookLevelTuple{}, err
+	}
+
+	var levels []OrderBookLevelTuple
+	for _, price := range prices {
+		levelPrice, err := strconv.ParseFloat(price, 64)
+		if err != nil {
+			return []OrderBookLevelTuple{}, err
+		}
+		_, levelKey := getOrderBookLevelKeys(orderType, symbolName, levelPrice)
+
+		var amount_n_count []string
+		amount_n_count, err = conn.HMGet(levelKey, []string{DB_ORDER_BOOK_LEVEL_FIELD_AMOUNT, DB_ORDER_BOOK_LEVEL_FIELD_COUNT})
+		if err != nil {
+			return []OrderBookLevelTuple{}, err
+		}
+
+		var amount float64
+		amount, err = strconv.ParseFloat(amount_n_count[0], 64)
+		if err != nil {
+			return []OrderBookLevelTuple{}, err
+		}
+
+		levels = append(levels, OrderBookLevelTuple{
+			Price:       price,
+			TotalAmount: fmt.Sprintf("%f", amount),
+			OrderCount:  amount_n_count[1],
+		})
+	}
+
+	return levels, nil
+}
+
+/*
+		Add an order to the order index of its account. The index keeps every order the account has ever placed,
+		including orders that are filled or cancelled and removed from orders, ordered by order id.
+		If the order is already in the index, it will be UPDATED.
+		The order is also added to the open orders of the account, archiveOrder removes it.
+	input --
+		uid: user id, no restriction on the length and characters
+		accountOrder: the order to add, Status is not stored since it changes over time
+	err --
+		from ZAdd, SAdd, strconv.Atoi
+*/
+func addOrderToAccountOrderIndex(conn storage.Conn, uid string, accountOrder AccountOrderTuple) error {
+	orderIdScore, err := strconv.Atoi(accountOrder.OrderId)
+	if err != nil {
+		return err
+	}
+
+	err = conn.ZAdd(DB_ACCOUNT_ORDERS_PREFIX+uid, orderIdScore, joinAccountOrderTuple(accountOrder))
+	if err != nil {
+		return err
+	}
+
+	return conn.SAdd(DB_ACCOUNT_OPEN_ORDERS_PREFIX+uid, accountOrder.OrderId)
+}
+
+/*
+		Get the ids of the open orders of an account.
+		Order of results: NON-PREDICTABLE
+		If the account has no open order, an EMPTY list is returned.
+	input --
+		uid: user id, no restriction on the length and characters
+	err --
+		from SMembers
+*/
+func getAccountOpenOrderIds(conn storage.Conn, uid string) ([]string, error) {
+	return conn.SMembers(DB_ACCOUNT_OPEN_ORDERS_PREFIX+uid)
+}
+
+/*
+		Query orders from the order index of an account with order id smaller than beforeOrderId, from the latest to the oldest.
+		Status of the returned orders is NOT filled by this function.
+		If the index does not exist, an EMPTY list is returned.
+	input --
+		uid: user id, no restriction on the length and characters
+		beforeOrderId: order id, orders before it(exclusive) are returned, empty to read from the latest order
+		limit: the maximum number of orders to return
+	err --
+		from ZRevRangeByScoreWithLimit
+*/
+func getOrdersFromAccountOrderIndex(conn storage.Conn, uid string, beforeOrderId string, limit int) ([]AccountOrderTuple, error) {
+	max := "+inf"
+	if beforeOrderId != "" {
+		max = "(" + beforeOrderId
+	}
+
+	nodes, err := conn.ZRevRangeByScoreWithLimit(DB_ACCOUNT_ORDERS_PREFIX+uid, max, "-inf", 0, limit)
+	if err != nil {
+		return []AccountOrderTuple{}, err
+	}
+
+	var accountOrders []AccountOrderTuple
+	for _, node := range nodes {
+		accountOrders = append(accountOrders, parseAccountOrderTuple(node))
+	}
+
+	return accountOrders, nil
+}
+
+/*
+		Get the account which placed an order, from the open order or the archived order.
+		If the order is neither open nor archived(eg: the archived order has expired), an empty uid is returned.
+	input --
+		orderId: order id, no restriction on the length and characters
+	err --
+		from Exists, HGet
+*/
+func getOrderAccount(conn storage.Conn, orderId string) (string, error) {
+	open, err := checkOrderExists(conn, orderId)
+	if err != nil {
+		return "", err
+	}
+	if open {
+		return conn.HGet(DB_ORDER_PREFIX+orderId, DB_ORDER_FIELD_ACCOUNT)
+	}
+
+	var archived bool
+	archived, err = archivedOrderExists(conn, orderId)
+	if err != nil || !archived {
+		return "", err
+	}
+	return conn.HGet(DB_ORDER_ARCHIVE_PREFIX+orderId, DB_ORDER_FIELD_ACCOUNT)
+}
+
+/*
+		Check an order is in the order index of an account, i.e. the account placed the order.
+		The order index never expires, unlike archived orders.
+	input --
+		uid: user id, no restriction on the length and characters
+		orderId: order id, orders ids which are not a base-10 digit sequence are never in the index
+	err --
+		from ZRangeByScore
+*/
+func checkOrderInAccountOrderIndex(conn storage.Conn, uid string, orderId string) (bool, error) {
+	if !isBase10NumberSequense(orderId) {
+		return false, nil
+	}
+
+	nodes, err := conn.ZRangeByScore(DB_ACCOUNT_ORDERS_PREFIX+uid, orderId, orderId)
+	if err != nil {
+		return false, err
+	}
+	return len(nodes) > 0, nil
+}
+
+/*
+		Get the status of an order: open if it is still in orders, the archived state if it is archived,
+		otherwise(the archived order has expired) cancelled if it has a cancel order history, filled if not.
+		This function will NOT check if the order has ever existed.
+	input --
+		orderId: order id, no restriction on the length and characters
+	err --
+		from Exists, HGet
+*/
+func getOrderStatus(conn storage.Conn, orderId string) (string, error) {
+	open, err := checkOrderExists(conn, orderId)
+	if err != nil {
+		return "", err
+	}
+	if open {
+		return ORDER_STATUS_OPEN, nil
+	}
+
+	var archived bool
+	archived, err = archivedOrderExists(conn, orderId)
+	if err != nil {
+		return "", err
+	}
+	if archived {
+		return conn.HGet(DB_ORDER_ARCHIVE_PREFIX+orderId, DB_ORDER_ARCHIVE_FIELD_STATE)
+	}
+
+	var cancelled bool
+	cancelled, err = cancelledOrderExists(conn, orderId)
+	if err != nil {
+		return "", err
+	}
+	if cancelled {
+		return ORDER_STATUS_CANCELLED, nil
+	}
+
+	return ORDER_STATUS_FILLED, nil
+}
+
+/*
+		Add an account to admin accounts. Admin accounts are allowed to run admin requests.
+		This function will NOT check if the account exists, an admin account does not need to hold balance or symbols.
+	input --
+		uid: user id, no restriction on the length and characters
+*/
+func addAdminAccount(conn storage.Conn, uid string) error {
+	return conn.SAdd(DB_ADMIN_ACCOUNTS, uid)
+}
+
+/*
+		Check an account is an admin account.
+	input --
+		uid: user id, no restriction on the length and characters
+*/
+func checkAdminAccount(conn storage.Conn, uid string) (bool, error) {
+	return conn.SIsMember(DB_ADMIN_ACCOUNTS, uid)
+}
+
+/*
+		Get a resting order's id, order type, limit price, current amount, entry time and uid.
+		This function will NOT validate if the orderId exists or not.
+	input --
+		orderId: order id, no restriction on the length and characters, MAKE SURE it exists
+	err --
+		from HMGet
+*/
+func getRestingOrder(conn storage.Conn, orderId string) (RestingOrderTuple, error) {
+	values, err := conn.HMGet(DB_ORDER_PREFIX+orderId,
+		[]string{DB_ORDER_FIELD_ORDER_TYPE, DB_ORDER_FIELD_LIMIT_PRICE, DB_ORDER_FIELD_ORDER_CURRENT_AMOUNT, DB_ORDER_FIELD_TIME, DB_ORDER_FIELD_ACCOUNT})
+	if err != nil {
+		return RestingOrderTuple{}, err
+	}
+
+	return RestingOrderTuple{
+		OrderId:       orderId,
+		OrderType:     values[0],
+		LimitPrice:    values[1],
+		CurrentAmount: values[2],
+		EntryTime:     values[3],
+		Uid:           values[4],
+	}, nil
+}
+
+/*
+		Copy every resting order of the buy and sell order books associated with symbolName into a snapshot list.
+		Orders are copied in matching priority: buy orders from the highest price, then sell orders from the lowest price.
+		The orders are read first, then the snapshot list is written with its expiry atomically, so no partial snapshot is left.
+		The snapshot expires after DB_ORDER_BOOK_SNAPSHOT_TTL_SECONDS.
+		MAKE SURE no order is matched or cancelled while the snapshot is being taken, otherwise the snapshot is not consistent.
+	input --
+		symbolName: the symbol of the order books
+		snapshotId: snapshot id, MAKE SURE it is unique
+	output --
+		return the number of orders in the snapshot
+	err --
+		from ZRange, ZRevRange, HMGet, RPush, Expire, Atomically
+*/
+func createOrderBookSnapshot(conn storage.Conn, symbolName string, snapshotId string) (int, error) {
+	buyOrderIds, err := conn.ZRevRange(DB_BUY_ORDER_BOOK_PREFIX+symbolName, 0, -1, false)
+	if err != nil {
+		return 0, err
+	}
+
+	var sellOrderIds []string
+	sellOrderIds, err = conn.ZRange(DB_SELL_ORDER_BOOK_PREFIX+symbolName, 0, -1, false)
+	if err != nil {
+		return 0, err
+	}
+
+	var nodes []string
+	for _, orderId := range append(buyOrderIds, sellOrderIds...) {
+		var restingOrder RestingOrderTuple
+		restingOrder, err = getRestingOrder(conn, orderId)
+		if err != nil {
+			return 0, err
+		}
+		nodes = append(nodes, joinRestingOrderTuple(restingOrder))
+	}
+	if len(nodes) == 0 {
+		return 0, nil
+	}
+
+	snapshotKey := DB_ORDER_BOOK_SNAPSHOT_PREFIX + symbolName + ":" + snapshotId
+	err = runAtomically(conn, func(conn storage.Conn) error {
+		for _, node := range nodes {
+			err := conn.RPush(snapshotKey, node)
+			if err != nil {
+				return err
+			}
+		}
+		return conn.Expire(snapshotKey, DB_ORDER_BOOK_SNAPSHOT_TTL_SECONDS)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return len(nodes), nil
+}
+
+/*
+		Check an order book snapshot exists. An expired snapshot does not exist.
+	input --
+		symbolName: the symbol of the order books
+		snapshotId: snapshot id
+*/
+func orderBookSnapshotExists(conn storage.Conn, symbolName string, snapshotId string) (bool, error) {
+	return conn.Exists(DB_ORDER_BOOK_SNAPSHOT_PREFIX+symbolName+":"+snapshotId)
+}
+
+/*
+		Query a page of resting orders from an order book snapshot.
+		This function will NOT check if the snapshot exists. If it does not, an EMPTY list is returned.
+	input --
+		symbolName: the symbol of the order books
+		snapshotId: snapshot id
+		offset: the position of the first order of the page in the snapshot
+		limit: the maximum number of orders in the page
+	output --
+		return the page of resting orders, and the number of orders in the whole snapshot
+	err --
+		from LRange, LLen
+*/
+func getOrderBookSnapshotPage(conn storage.Conn, symbolName string, snapshotId string, offset int, limit int) ([]RestingOrderTuple, int, error) {
+	snapshotKey := DB_ORDER_BOOK_SNAPSHOT_PREFIX + symbolName + ":" + snapshotId
+	nodes, err := conn.LRange(snapshotKey, offset, offset+limit-1)
+	if err != nil {
+		return []RestingOrderTuple{}, 0, err
+	}
+
+	var numberOfOrders int
+	numberOfOrders, err = conn.LLen(snapshotKey)
+	if err != nil {
+		return []RestingOrderTuple{}, 0, err
+	}
+
+	var restingOrders []RestingOrderTuple
+	for _, node := range nodes {
+		restingOrders = append(restingOrders, parseRestingOrderTuple(node))
+	}
+
+	return restingOrders, numberOfOrders, nil
+}
+
 /*
 		Insert a cancel order history tuple to cancel order histories.
 		This function will NOT check if the history exists.
@@ -503,8 +1216,8 @@ func isSellOrderBookEmpty(conn *redigo.Conn, symbolName string) (bool, error) {
 		amount: the order's current order amount before cancellation
 		time: cancellation time
 */
-func insertCancelledOrderToCancelHistory(conn *redigo.Conn, orderId string, amount float64, time string) error {
-	return redis.HMSet(conn,
+func insertCancelledOrderToCancelHistory(conn storage.Conn, orderId string, amount float64, time string) error {
+	return conn.HMSet(
 		DB_CANCEL_HISTORY_PREFIX+orderId,
 		map[string]interface{}{
 			DB_CANCEL_HISTORY_FIELD_AMOUNT: amount,
@@ -517,8 +1230,8 @@ func insertCancelledOrderToCancelHistory(conn *redigo.Conn, orderId string, amou
 	input --
 		orderId: order id, no restriction on the length and characters, MAKE SURE it is unique in cancel histories
 */
-func getAmountAndTimeForCancelledOrderFromCancelHistory(conn *redigo.Conn, orderId string) (float64, string, error) {
-	amount_n_time, err := redis.HMGet(conn, DB_CANCEL_HISTORY_PREFIX+orderId, []string{DB_CANCEL_HISTORY_FIELD_AMOUNT, DB_CANCEL_HISOTRY_FIELD_TIME})
+func getAmountAndTimeForCancelledOrderFromCancelHistory(conn storage.Conn, orderId string) (float64, string, error) {
+	amount_n_time, err := conn.HMGet(DB_CANCEL_HISTORY_PREFIX+orderId, []string{DB_CANCEL_HISTORY_FIELD_AMOUNT, DB_CANCEL_HISOTRY_FIELD_TIME})
 	if err != nil {
 		return 0, "", err
 	} else if len(amount_n_time) == 0 {
@@ -542,8 +1255,8 @@ func getAmountAndTimeForCancelledOrderFromCancelHistory(conn *redigo.Conn, order
 	input --
 		orderId: order id, no restriction on the length and characters
 */
-func cancelledOrderExists(conn *redigo.Conn, orderId string) (bool, error) {
-	exists, err := redis.Exists(conn, DB_CANCEL_HISTORY_PREFIX+orderId)
+func cancelledOrderExists(conn storage.Conn, orderId string) (bool, error) {
+	exists, err := conn.Exists(DB_CANCEL_HISTORY_PREFIX+orderId)
 	if err != nil {
 		return false, err
 	}
@@ -552,21 +1265,26 @@ func cancelledOrderExists(conn *redigo.Conn, orderId string) (bool, error) {
 }
 
 /*
-		WARN: By the time we write this document, we did no know how to write TRANSACTION, so we will not handle errors in consecutive RPUSHs
-
 		Insert an executed order history tuple to executed order histories.
+		The tuple is 4 consecutive nodes, run it in runAtomically so a tuple is never partially inserted.
 	input --
 		orderId: order id, no restriction on the length and characters
 		amount: the order's executed order amount
 		limitPrice: the order's executed limit price.
 		time: executed time
+		tradeId: the id of the trade in the trade log of the symbol
+	err --
+		from RPush
 */
-func InsertExcutedOrderToExcutedHistory(conn *redigo.Conn, orderId string, amount float64, limitPrice float64, time string) error {
+func InsertExcutedOrderToExcutedHistory(conn storage.Conn, orderId string, amount float64, limitPrice float64, time string, tradeId string) error {
 	amount_in_string := fmt.Sprintf("%f", amount)
 	limitPrice_in_string := fmt.Sprintf("%f", limitPrice)
-	redis.RPush(conn, DB_EXECUTED_HISTORY_PREFIX+orderId, amount_in_string)
-	redis.RPush(conn, DB_EXECUTED_HISTORY_PREFIX+orderId, limitPrice_in_string)
-	redis.RPush(conn, DB_EXECUTED_HISTORY_PREFIX+orderId, time)
+	for _, node := range []string{amount_in_string, limitPrice_in_string, time, tradeId} {
+		err := conn.RPush(DB_EXECUTED_HISTORY_PREFIX+orderId, node)
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -575,8 +1293,8 @@ func InsertExcutedOrderToExcutedHistory(conn *redigo.Conn, orderId string, amoun
 	input --
 		orderId: order id, no restriction on the length and characters
 */
-func executedOrderExists(conn *redigo.Conn, orderId string) (bool, error) {
-	exists, err := redis.Exists(conn, DB_EXECUTED_HISTORY_PREFIX+orderId)
+func executedOrderExists(conn storage.Conn, orderId string) (bool, error) {
+	exists, err := conn.Exists(DB_EXECUTED_HISTORY_PREFIX+orderId)
 	if err != nil {
 		return false, err
 	}
@@ -587,11 +1305,11 @@ func executedOrderExists(conn *redigo.Conn, orderId string) (bool, error) {
 /*
 		Query an executed order history slice list.
 		list eg: (EO: executed order)
-			amount of EO1 --> limit price of EO1 --> time of EO1 --> amount of EO2 --> limit price of EO2 --> time of EO2 --> ...
+			amount of EO1 --> limit price of EO1 --> time of EO1 --> trade id of EO1 --> amount of EO2 --> ...
 		This function will NOT check if the history list exists. MAKE SURE that the history list EXIST.
 	input --
 		orderId: order id, no restriction on the length and characters.
 */
-func GetExecutedOrderSliceList(conn *redigo.Conn, orderId string) ([]string, error) {
-	return redis.LRange(conn, DB_EXECUTED_HISTORY_PREFIX+orderId, 0, -1)
+func GetExecutedOrderSliceList(conn storage.Conn, orderId string) ([]string, error) {
+	return conn.LRange(DB_EXECUTED_HISTORY_PREFIX+orderId, 0, -1)
 }
@@ -0,0 +1,191 @@
+package businessLogic
+
+import (
+	"app/storage"
+	"fmt"
+)
+
+const (
+	CASH_MOVEMENT_DEPOSIT      = "deposit"
+	CASH_MOVEMENT_WITHDRAW     = "withdraw"
+	CASH_MOVEMENT_TRANSFER_IN  = "transferIn"
+	CASH_MOVEMENT_TRANSFER_OUT = "transferOut"
+
+	CASH_MOVEMENT_REASON_ACCOUNT_CREATED = "account created"
+)
+
+type CashMovementTuple struct {
+	MovementId string
+	Type       string
+	Amount     string
+	Reason     string
+	Time       string
+	Balance    string
+}
+
+/*
+		Deposit adds cash from outside the exchange to an account's balance, the deposit is recorded in the account's cash ledger.
+		Only an admin can deposit, the cash is funded outside the exchange.
+	input --
+		adminUid: user id of the admin account
+		uid: user id of the account
+		amount: should be positive(> 0)
+		reason: why the cash is deposited, can be empty
+	output --
+		the recorded cash movement tuple, with the balance after the deposit
+		err:
+		if adminUid is not an admin account, an error message will be returned
+		if uid does not exist, an error message will be returned
+		if the account is closed, an error message will be returned
+		if amount does not meet input restriction, an error message will be returned
+		if database fails to change the balance or record the movement, an error message will be returned
+*/
+func Deposit(store storage.Storage, adminUid string, uid string, amount float64, reason string) (CashMovementTuple, error) {
+	if amount <= 0 {
+		return CashMovementTuple{}, fmt.Errorf("invalid amount")
+	}
+
+	conn := store.Get()
+	defer conn.Close()
+
+	isAdmin, err := checkAdminAccount(conn, adminUid)
+	if err != nil {
+		return CashMovementTuple{}, fmt.Errorf("database error when checking admin account")
+	}
+	if !isAdmin {
+		return CashMovementTuple{}, fmt.Errorf("permission denied")
+	}
+
+	exists, err := checkAccountExists(conn, uid)
+	if err != nil || !exists {
+		return CashMovementTuple{}, fmt.Errorf("user doesn't exist")
+	}
+	err = checkAccountIsNotClosed(conn, uid)
+	if err != nil {
+		return CashMovementTuple{}, err
+	}
+
+	// the balance changes with its ledger record and journal posting, or not at all
+	var movement CashMovementTuple
+	err = runAtomically(conn, func(conn storage.Conn) error {
+		balance, err := increaseAccountBalance(conn, uid, amount)
+		if err != nil {
+			return fmt.Errorf("database error when increasing the balance")
+		}
+		movement, err = insertCashMovementToCashLedger(conn, uid, CASH_MOVEMENT_DEPOSIT, amount, reason, balance)
+		if err != nil {
+			return fmt.Errorf("database error when recording the deposit")
+		}
+		err = postJournalEntry(conn, JOURNAL_KIND_DEPOSIT, movement.MovementId, movement.Time,
+			journalTransfer(JOURNAL_ASSET_CASH, JOURNAL_LEDGER_ACCOUNT_EXTERNAL, availableLedgerAccount(uid), amount))
+		if err != nil {
+			return fmt.Errorf("database error when posting the deposit to the journal")
+		}
+		return nil
+	})
+	if err != nil {
+		return CashMovementTuple{}, err
+	}
+
+	return movement, nil
+}
+
+/*
+		Withdraw removes cash from an account's balance, the withdrawal is recorded in the account's cash ledger.
+		Only the available balance can be withdrawn, balance reserved by open buy orders can not.
+	input --
+		uid: user id of the account
+		amount: should be positive(> 0)
+		reason: why the cash is withdrawn, can be empty
+	output --
+		the recorded cash movement tuple, with the balance after the withdrawal
+		err:
+		if uid does not exist, an error message will be returned
+		if the account is frozen or closed, an error message will be returned
+		if amount does not meet input restriction, an error message will be returned
+		if the account's available balance is insufficient, an error message will be returned
+		if database fails to change the balance or record the movement, an error message will be returned
+*/
+func Withdraw(store storage.Storage, uid string, amount float64, reason string) (CashMovementTuple, error) {
+	if amount <= 0 {
+		return CashMovementTuple{}, fmt.Errorf("invalid amount")
+	}
+
+	conn := store.Get()
+	defer conn.Close()
+
+	exists, err := checkAccountExists(conn, uid)
+	if err != nil || !exists {
+		return CashMovementTuple{}, fmt.Errorf("user doesn't exist")
+	}
+	err = checkAccountIsActive(conn, uid)
+	if err != nil {
+		return CashMovementTuple{}, err
+	}
+
+	var balance float64
+	balance, err = GetAccountBalance(conn, uid)
+	if err != nil {
+		return CashMovementTuple{}, fmt.Errorf("database error when retrieving the balance")
+	}
+	if balance < amount {
+		return CashMovementTuple{}, fmt.Errorf("insufficient funds")
+	}
+
+	// the balance changes with its ledger record and journal posting, or not at all
+	var movement CashMovementTuple
+	err = runAtomically(conn, func(conn storage.Conn) error {
+		balance, err := decreaseAccountBalance(conn, uid, amount)
+		if err != nil {
+			return fmt.Errorf("database error when decreasing the balance")
+		}
+		movement, err = insertCashMovementToCashLedger(conn, uid, CASH_MOVEMENT_WITHDRAW, amount, reason, balance)
+		if err != nil {
+			return fmt.Errorf("database error when recording the withdrawal")
+		}
+		err = postJournalEntry(conn, JOURNAL_KIND_WITHDRAW, movement.MovementId, movement.Time,
+			journalTransfer(JOURNAL_ASSET_CASH, availableLedgerAccount(uid), JOURNAL_LEDGER_ACCOUNT_EXTERNAL, amount))
+		if err != nil {
+			return fmt.Errorf("database error when posting the withdrawal to the journal")
+		}
+		return nil
+	})
+	if err != nil {
+		return CashMovementTuple{}, err
+	}
+
+	return movement, nil
+}
+
+/*
+		QueryCashLedger query the cash movements of an account, from the oldest to the latest.
+	input --
+		requesterUid: user id of the requester, MUST BE the same as uid
+		uid: user id of the account to query
+		sinceMovementId: cash movement id, movements after it(exclusive) are returned, 0 to read from the first movement
+		limit: the maximum number of movements to return, should be positive
+	output --
+		a list of cash movement tuples
+		err:
+		if requesterUid is not uid, an error message will be returned
+		if sinceMovementId or limit does not meet input restriction, an error message will be returned
+		if database fails to retrieve the movements, an error message will be returned
+*/
+func QueryCashLedger(store storage.Storage, requesterUid string, uid string, sinceMovementId int, limit int) ([]CashMovementTuple, error) {
+	if requesterUid != uid {
+		return []CashMovementTuple{}, fmt.Errorf("permission denied")
+	}
+	if sinceMovementId < 0 || limit <= 0 {
+		return []CashMovementTuple{}, fmt.Errorf("invalid since or limit")
+	}
+
+	conn := store.Get()
+	defer conn.Close()
+
+	movements, err := getCashMovementsFromCashLedger(conn, uid, sinceMovementId, limit)
+	if err != nil {
+		return []CashMovementTuple{}, fmt.Errorf("database error when retrieving the cash ledger")
+	}
+
+	return movements, nil
+}
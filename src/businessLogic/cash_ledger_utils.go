@@ -0,0 +1,111 @@
+package businessLogic
+
+import (
+	"app/storage"
+	"app/uniqueKeyGenerator"
+	"fmt"
+	"strconv"
+)
+
+const (
+	DB_CASH_MOVEMENT_PREFIX        = "cashMovement:"
+	DB_CASH_LEDGER_PREFIX          = "cashLedger:"
+	DB_CASH_MOVEMENT_FIELD_ACCOUNT = "account"
+	DB_CASH_MOVEMENT_FIELD_TYPE    = "type"
+	DB_CASH_MOVEMENT_FIELD_AMOUNT  = "amount"
+	DB_CASH_MOVEMENT_FIELD_REASON  = "reason"
+	DB_CASH_MOVEMENT_FIELD_TIME    = "time"
+	DB_CASH_MOVEMENT_FIELD_BALANCE = "balance"
+)
+
+/*
+		Record a cash movement of an account in the cash ledger of the account, with a new cash movement id and the current time.
+		This function will NOT change the account's balance, User has to change it before recording the movement.
+	input --
+		uid: user id, no restriction on the length and characters
+		movementType: deposit/withdraw
+		amount: the amount moved, should be positive
+		reason: why the cash is moved, can be empty
+		balance: the account's balance after the movement
+	output --
+		the recorded cash movement tuple
+	err --
+		from Incr, HMSet, ZAdd
+*/
+func insertCashMovementToCashLedger(conn storage.Conn, uid string, movementType string, amount float64, reason string, balance float64) (CashMovementTuple, error) {
+	id, err := uniqueKeyGenerator.GetNewCashMovementId(conn)
+	if err != nil {
+		return CashMovementTuple{}, err
+	}
+	movementId := strconv.Itoa(id)
+	current_time := getCurrentTimeInString()
+
+	err = conn.HMSet(
+		DB_CASH_MOVEMENT_PREFIX+movementId,
+		map[string]interface{}{
+			DB_CASH_MOVEMENT_FIELD_ACCOUNT: uid,
+			DB_CASH_MOVEMENT_FIELD_TYPE:    movementType,
+			DB_CASH_MOVEMENT_FIELD_AMOUNT:  amount,
+			DB_CASH_MOVEMENT_FIELD_REASON:  reason,
+			DB_CASH_MOVEMENT_FIELD_TIME:    current_time,
+			DB_CASH_MOVEMENT_FIELD_BALANCE: balance})
+	if err != nil {
+		return CashMovementTuple{}, err
+	}
+
+	err = conn.ZAdd(DB_CASH_LEDGER_PREFIX+uid, movementId, movementId)
+	if err != nil {
+		return CashMovementTuple{}, err
+	}
+
+	return CashMovementTuple{
+		MovementId: movementId,
+		Type:       movementType,
+		Amount:     fmt.Sprintf("%f", amount),
+		Reason:     reason,
+		Time:       current_time,
+		Balance:    fmt.Sprintf("%f", balance),
+	}, nil
+}
+
+/*
+		Query cash movements from the cash ledger of an account with movement id greater than sinceMovementId, from the oldest to the latest.
+		If the cash ledger does not exist, an EMPTY list is returned.
+	input --
+		uid: user id, no restriction on the length and characters
+		sinceMovementId: cash movement id, movements after it(exclusive) are returned, 0 to read from the first movement
+		limit: the maximum number of movements to return
+	err --
+		from ZRangeByScoreWithLimit, HMGet
+*/
+func getCashMovementsFromCashLedger(conn storage.Conn, uid string, sinceMovementId int, limit int) ([]CashMovementTuple, error) {
+	movementIds, err := conn.ZRangeByScoreWithLimit(DB_CASH_LEDGER_PREFIX+uid, fmt.Sprintf("(%d", sinceMovementId), "+inf", 0, limit)
+	if err != nil {
+		return []CashMovementTuple{}, err
+	}
+
+	var movements []CashMovementTuple
+	for _, movementId := range movementIds {
+		var values []string
+		values, err = conn.HMGet(DB_CASH_MOVEMENT_PREFIX+movementId, []string{
+			DB_CASH_MOVEMENT_FIELD_TYPE,
+			DB_CASH_MOVEMENT_FIELD_AMOUNT,
+			DB_CASH_MOVEMENT_FIELD_REASON,
+			DB_CASH_MOVEMENT_FIELD_TIME,
+			DB_CASH_MOVEMENT_FIELD_BALANCE})
+		if err != nil {
+			return []CashMovementTuple{}, err
+		}
+
+		movements = append(movements, CashMovementTuple{
+			MovementId: movementId,
+			Type:       values[0],
+			Amount:     values[1],
+			Reason:     values[2],
+			Time:       values[3],
+			Balance:    values[4],
+		})
+	}
+
+	return movements, nil
+}
@@ -0,0 +1,96 @@
+package businessLogic
+
+import (
+	"app/storage"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// how long a client order id is remembered after its order is submitted, 0 to remember it forever
+var ClientOrderIdRetention = 24 * time.Hour
+
+// ClientOrderTuple is the client order id of an order, and the response recorded for it if the order is placed
+type ClientOrderTuple struct {
+	ClOrdId  string
+	Response string
+}
+
+/*
+		LookupClientOrder returns the result of an order submitted with a client order id by an account,
+		so a resubmitted order is answered with the original result instead of being placed again.
+	input --
+		uid: user id of the account which submitted the order
+		clOrdId: client order id, unique per account within ClientOrderIdRetention
+	output --
+		the engine order id(empty if the order was rejected), the original response, and if the client order id was found
+		err:
+		if database fails to retrieve the client order id, an error message will be returned
+*/
+func LookupClientOrder(store storage.Storage, uid string, clOrdId string) (string, string, bool, error) {
+	conn := store.Get()
+	defer conn.Close()
+
+	orderId, response, found, err := getClientOrder(conn, uid, clOrdId)
+	if err != nil {
+		return "", "", false, fmt.Errorf("database error when retrieving the client order id")
+	}
+	return orderId, response, found, nil
+}
+
+/*
+		RecordClientOrder records the result of an order submitted with a client order id by an account.
+	input --
+		uid: user id of the account which submitted the order
+		clOrdId: client order id, unique per account within ClientOrderIdRetention
+		orderId: the engine order id, empty if the order was rejected
+		response: the response of the order, returned again when the order is resubmitted
+	output --
+		err:
+		if database fails to record the client order id, an error message will be returned
+*/
+func RecordClientOrder(store storage.Storage, uid string, clOrdId string, orderId string, response string) error {
+	conn := store.Get()
+	defer conn.Close()
+
+	err := setClientOrder(conn, uid, clOrdId, orderId, response)
+	if err != nil {
+		return fmt.Errorf("database error when recording the client order id")
+	}
+	return nil
+}
+
+/*
+		IsOrderRejection checks if an order was rejected by a business rule, which rejects the order again if it is resubmitted,
+		so the rejection is recorded for its client order id. Database errors are transient, a resubmitted order may be placed,
+		so they are not recorded.
+*/
+func IsOrderRejection(err error) bool {
+	return !strings.HasPrefix(err.Error(), "database error")
+}
+
+/*
+		GetOrderIdByClientOrderId returns the engine order id of an order submitted with a client order id by an account.
+	input --
+		uid: user id of the account which submitted the order
+		clOrdId: client order id
+	output --
+		the engine order id
+		err:
+		if the client order id is unknown or has expired, an error message will be returned
+		if the order with the client order id was rejected, an error message will be returned
+		if database fails to retrieve the client order id, an error message will be returned
+*/
+func GetOrderIdByClientOrderId(store storage.Storage, uid string, clOrdId string) (string, error) {
+	orderId, _, found, err := LookupClientOrder(store, uid, clOrdId)
+	if err != nil {
+		return "", err
+	}
+	if !found {
+		return "", fmt.Errorf("unknown clOrdId")
+	}
+	if orderId == "" {
+		return "", fmt.Errorf("order with this clOrdId was rejected")
+	}
+	return orderId, nil
+}
@@ -0,0 +1,67 @@
+package businessLogic
+
+import (
+	"app/storage"
+)
+
+const (
+	DB_CLIENT_ORDER_PREFIX          = "clientOrder:"
+	DB_CLIENT_ORDER_FIELD_ORDER     = "order"
+	DB_CLIENT_ORDER_FIELD_RESPONSE  = "response"
+	DB_CLIENT_ORDER_FIELD_EXPIRE_AT = "expireAt"
+)
+
+/*
+		Get the order id and the recorded response of a client order id of an account.
+		If the client order id is not recorded or has expired, found is false.
+		The expiry is checked against the recorded expireAt, so a replay of the command journal sees the same client order ids.
+	input --
+		uid: user id, no restriction on the length and characters
+		clOrdId: client order id, no restriction on the length and characters
+	err --
+		from Exists, HMGet
+*/
+func getClientOrder(conn storage.Conn, uid string, clOrdId string) (string, string, bool, error) {
+	key := DB_CLIENT_ORDER_PREFIX + uid + ":" + clOrdId
+	found, err := conn.Exists(key)
+	if err != nil || !found {
+		return "", "", false, err
+	}
+
+	values, err := conn.HMGet(key, []string{DB_CLIENT_ORDER_FIELD_ORDER, DB_CLIENT_ORDER_FIELD_RESPONSE, DB_CLIENT_ORDER_FIELD_EXPIRE_AT})
+	if err != nil {
+		return "", "", false, err
+	}
+	if hasExpired(values[2]) {
+		return "", "", false, nil
+	}
+	return values[0], values[1], true, nil
+}
+
+/*
+		Record the order id and the response of a client order id of an account, the record expires after ClientOrderIdRetention
+		from the current time(the time of the journaled command). The key expires in the database at the same time or later.
+		If the client order id is recorded, it will be UPDATED.
+	input --
+		uid: user id, no restriction on the length and characters
+		clOrdId: client order id, no restriction on the length and characters
+		orderId: the engine order id, empty if the order was rejected
+		response: the response of the order
+	err --
+		from HMSet, Expire
+*/
+func setClientOrder(conn storage.Conn, uid string, clOrdId string, orderId string, response string) error {
+	key := DB_CLIENT_ORDER_PREFIX + uid + ":" + clOrdId
+	err := conn.HMSet(key, map[string]interface{}{
+		DB_CLIENT_ORDER_FIELD_ORDER:     orderId,
+		DB_CLIENT_ORDER_FIELD_RESPONSE:  response,
+		DB_CLIENT_ORDER_FIELD_EXPIRE_AT: expireAtAfter(ClientOrderIdRetention)})
+	if err != nil {
+		return err
+	}
+
+	if ClientOrderIdRetention > 0 {
+		return conn.Expire(key, int(ClientOrderIdRetention.Seconds()))
+	}
+	return nil
+}
@@ -1,7 +1,10 @@
 package businessLogic
 
 import (
+	"fmt"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -14,23 +17,198 @@ func isBase10NumberSequense(s string) bool {
 	return true
 }
 
+// the time of the journaled command being executed, so replaying the command journal gives the same timestamps
+var commandTime struct {
+	sync.Mutex
+	epoch int64
+	fixed bool
+}
+
+/*
+		SetCommandTime makes every timestamp taken by the business logic epoch until ClearCommandTime,
+		call it before executing a journaled command with the time recorded in the journal.
+*/
+func SetCommandTime(epoch int64) {
+	commandTime.Lock()
+	defer commandTime.Unlock()
+	commandTime.epoch = epoch
+	commandTime.fixed = true
+}
+
+func ClearCommandTime() {
+	commandTime.Lock()
+	defer commandTime.Unlock()
+	commandTime.fixed = false
+}
+
 func getCurrentTimeInString() string {
-	currentTime := time.Now()
-	epoch := currentTime.Unix()
-	epochInString := strconv.FormatInt(epoch, 10)
-	return epochInString
+	return strconv.FormatInt(getCurrentEpoch(), 10)
+}
+
+// getCurrentEpoch returns the unix time in seconds, the time of the journaled command if one is being executed
+func getCurrentEpoch() int64 {
+	commandTime.Lock()
+	defer commandTime.Unlock()
+	if commandTime.fixed {
+		return commandTime.epoch
+	}
+	return time.Now().Unix()
+}
+
+/*
+		expireAtAfter returns the unix time a record kept for retention expires at, from the current time,
+		stored with the record so its expiry follows the time of the journaled commands, not the wall clock.
+		An empty string means the record never expires.
+*/
+func expireAtAfter(retention time.Duration) string {
+	if retention <= 0 {
+		return ""
+	}
+	return strconv.FormatInt(getCurrentEpoch()+int64(retention.Seconds()), 10)
+}
+
+// hasExpired checks if a record with the expireAt of expireAtAfter has expired at the current time
+func hasExpired(expireAt string) bool {
+	if expireAt == "" {
+		return false
+	}
+	epoch, err := strconv.ParseInt(expireAt, 10, 64)
+	return err == nil && getCurrentEpoch() >= epoch
+}
+
+// an empty string means the field does not exist, which is treated as 0
+func parseFloatOrZero(s string) (float64, error) {
+	if s == "" {
+		return 0, nil
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+// an empty string means the field does not exist, which is reported as 0
+func zeroIfEmpty(s string) string {
+	if s == "" {
+		return "0"
+	}
+	return s
+}
+
+func formatPriceLevel(price float64) string {
+	return strconv.FormatFloat(price, 'f', -1, 64)
 }
 
 func parseExcutedHistoryNodeList(executedHistoryNodeList []string) []ExecutedOrderHistoryTuple {
-	numberOfTuples := len(executedHistoryNodeList) / 3
+	numberOfTuples := len(executedHistoryNodeList) / 4
 	var tupleList []ExecutedOrderHistoryTuple
 	for i := 0; i < numberOfTuples; i++ {
 		tuple := ExecutedOrderHistoryTuple{
-			TransactionAmount: executedHistoryNodeList[i*3],
-			TransactionPrice:  executedHistoryNodeList[i*3+1],
-			TransactionTime:   executedHistoryNodeList[i*3+2],
+			TransactionAmount: executedHistoryNodeList[i*4],
+			TransactionPrice:  executedHistoryNodeList[i*4+1],
+			TransactionTime:   executedHistoryNodeList[i*4+2],
+			TradeId:           executedHistoryNodeList[i*4+3],
+		}
+		tupleList = append(tupleList, tuple)
+	}
+	return tupleList
+}
+
+func parseJournalPostingNodeList(postingNodeList []string) []JournalPostingTuple {
+	numberOfTuples := len(postingNodeList) / DB_JOURNAL_POSTING_NODE_COUNT
+	var tupleList []JournalPostingTuple
+	for i := 0; i < numberOfTuples; i++ {
+		tuple := JournalPostingTuple{
+			LedgerAccount: postingNodeList[i*DB_JOURNAL_POSTING_NODE_COUNT],
+			Asset:         postingNodeList[i*DB_JOURNAL_POSTING_NODE_COUNT+1],
+			Amount:        postingNodeList[i*DB_JOURNAL_POSTING_NODE_COUNT+2],
 		}
 		tupleList = append(tupleList, tuple)
 	}
 	return tupleList
 }
+
+func joinRestingOrderTuple(restingOrder RestingOrderTuple) string {
+	return strings.Join([]string{
+		restingOrder.OrderId,
+		restingOrder.OrderType,
+		restingOrder.LimitPrice,
+		restingOrder.CurrentAmount,
+		restingOrder.EntryTime,
+		restingOrder.Uid,
+	}, "|")
+}
+
+func parseRestingOrderTuple(node string) RestingOrderTuple {
+	fields := strings.Split(node, "|")
+	if len(fields) != 6 {
+		return RestingOrderTuple{}
+	}
+	return RestingOrderTuple{
+		OrderId:       fields[0],
+		OrderType:     fields[1],
+		LimitPrice:    fields[2],
+		CurrentAmount: fields[3],
+		EntryTime:     fields[4],
+		Uid:           fields[5],
+	}
+}
+
+func parseOrderBookSnapshotCursor(cursor string) (string, int, error) {
+	snapshotId_n_offset := strings.Split(cursor, ":")
+	if len(snapshotId_n_offset) != 2 || snapshotId_n_offset[0] == "" || !isBase10NumberSequense(snapshotId_n_offset[0]) {
+		return "", 0, fmt.Errorf("invalid cursor")
+	}
+
+	offset, err := strconv.Atoi(snapshotId_n_offset[1])
+	if err != nil || offset < 0 {
+		return "", 0, fmt.Errorf("invalid cursor")
+	}
+
+	return snapshotId_n_offset[0], offset, nil
+}
+
+func joinAccountOrderTuple(accountOrder AccountOrderTuple) string {
+	return strings.Join([]string{
+		accountOrder.OrderId,
+		accountOrder.SymbolName,
+		accountOrder.OrderType,
+		accountOrder.LimitPrice,
+		accountOrder.InitialAmount,
+		accountOrder.EntryTime,
+	}, "|")
+}
+
+func parseAccountOrderTuple(node string) AccountOrderTuple {
+	fields := strings.Split(node, "|")
+	if len(fields) != 6 {
+		return AccountOrderTuple{}
+	}
+	return AccountOrderTuple{
+		OrderId:       fields[0],
+		SymbolName:    fields[1],
+		OrderType:     fields[2],
+		LimitPrice:    fields[3],
+		InitialAmount: fields[4],
+		EntryTime:     fields[5],
+	}
+}
+
+func accountOrderMatchesFilter(accountOrder AccountOrderTuple, filter AccountOrderFilter) bool {
+	if filter.SymbolName != "" && accountOrder.SymbolName != filter.SymbolName {
+		return false
+	}
+	if filter.OrderType != "" && accountOrder.OrderType != filter.OrderType {
+		return false
+	}
+
+	entryTime, err := strconv.ParseInt(accountOrder.EntryTime, 10, 64)
+	if err != nil {
+		return false
+	}
+	if filter.From > 0 && entryTime < filter.From {
+		return false
+	}
+	if filter.To > 0 && entryTime > filter.To {
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,68 @@
+package businessLogic
+
+import (
+	"app/storage"
+	"fmt"
+)
+
+const (
+	JOURNAL_KIND_DEPOSIT  = "deposit"
+	JOURNAL_KIND_WITHDRAW = "withdraw"
+	JOURNAL_KIND_RESERVE  = "reserve"
+	JOURNAL_KIND_FILL     = "fill"
+	JOURNAL_KIND_REFUND   = "refund"
+	JOURNAL_KIND_CANCEL   = "cancel"
+	JOURNAL_KIND_TRANSFER = "transfer"
+)
+
+type JournalPostingTuple struct {
+	LedgerAccount string
+	Asset         string
+	Amount        string
+}
+
+type JournalEntryTuple struct {
+	EntryId  string
+	Kind     string
+	Ref      string
+	Time     string
+	Postings []JournalPostingTuple
+}
+
+/*
+		QueryJournal query the double-entry journal entries posted to an account, from the oldest to the latest.
+		Every change of the account's balance and symbol positions is posted as an entry:
+		deposit/withdraw(ref: cash movement id, or symbol deposit id for a symbol deposit), reserve/cancel(ref: order id), fill/refund(ref: trade id),
+		transfer(ref: transfer id).
+		An account's available and reserved cash and symbol positions are the balances of its ledger accounts:
+		"<uid>:available" and "<uid>:reserved", cash and symbols moved in and out of the exchange are posted to "external".
+	input --
+		requesterUid: user id of the requester, MUST BE the same as uid
+		uid: user id of the account to query
+		sinceEntryId: journal entry id, entries after it(exclusive) are returned, 0 to read from the first entry
+		limit: the maximum number of entries to return, should be positive
+	output --
+		a list of journal entry tuples
+		err:
+		if requesterUid is not uid, an error message will be returned
+		if sinceEntryId or limit does not meet input restriction, an error message will be returned
+		if database fails to retrieve the entries, an error message will be returned
+*/
+func QueryJournal(store storage.Storage, requesterUid string, uid string, sinceEntryId int, limit int) ([]JournalEntryTuple, error) {
+	if requesterUid != uid {
+		return []JournalEntryTuple{}, fmt.Errorf("permission denied")
+	}
+	if sinceEntryId < 0 || limit <= 0 {
+		return []JournalEntryTuple{}, fmt.Errorf("invalid since or limit")
+	}
+
+	conn := store.Get()
+	defer conn.Close()
+
+	entries, err := getJournalEntriesOfAccount(conn, uid, sinceEntryId, limit)
+	if err != nil {
+		return []JournalEntryTuple{}, fmt.Errorf("database error when retrieving the journal")
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,222 @@
+package businessLogic
+
+import (
+	"app/storage"
+	"app/uniqueKeyGenerator"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	DB_JOURNAL                    = "journal"
+	DB_JOURNAL_ENTRY_PREFIX       = "journalEntry:"
+	DB_JOURNAL_POSTINGS_PREFIX    = "journalPostings:"
+	DB_JOURNAL_ACCOUNT_PREFIX     = "journalAccount:"
+	DB_JOURNAL_BALANCES_PREFIX    = "journalBalances:"
+	DB_JOURNAL_ENTRY_FIELD_KIND   = "kind"
+	DB_JOURNAL_ENTRY_FIELD_REF    = "ref"
+	DB_JOURNAL_ENTRY_FIELD_TIME   = "time"
+	DB_JOURNAL_POSTING_NODE_COUNT = 3
+
+	JOURNAL_ASSET_CASH               = "cash"
+	JOURNAL_LEDGER_ACCOUNT_EXTERNAL  = "external"
+	JOURNAL_LEDGER_ACCOUNT_AVAILABLE = "available"
+	JOURNAL_LEDGER_ACCOUNT_RESERVED  = "reserved"
+	JOURNAL_BALANCE_TOLERANCE        = 1e-6
+)
+
+// checkSymbolName returns an error if a symbol can not be named symbolName, the journal names cash JOURNAL_ASSET_CASH
+func checkSymbolName(symbolName string) error {
+	if symbolName == JOURNAL_ASSET_CASH {
+		return fmt.Errorf("invalid symbol name %s", symbolName)
+	}
+	return nil
+}
+
+// a posting moves amount of an asset into a ledger account, a negative amount moves it out
+type journalPosting struct {
+	ledgerAccount string
+	asset         string
+	amount        float64
+}
+
+/*
+		The ledger account holding an account's available cash or symbol position.
+	input --
+		uid: user id, no restriction on the length and characters
+*/
+func availableLedgerAccount(uid string) string {
+	return uid + ":" + JOURNAL_LEDGER_ACCOUNT_AVAILABLE
+}
+
+/*
+		The ledger account holding an account's cash or symbol position reserved by open orders.
+	input --
+		uid: user id, no restriction on the length and characters
+*/
+func reservedLedgerAccount(uid string) string {
+	return uid + ":" + JOURNAL_LEDGER_ACCOUNT_RESERVED
+}
+
+/*
+		Build the balanced postings moving amount of an asset from a ledger account to another ledger account.
+	input --
+		asset: JOURNAL_ASSET_CASH or a symbol name
+		from: the ledger account the asset is moved out
+		to: the ledger account the asset is moved in
+		amount: the amount moved
+*/
+func journalTransfer(asset string, from string, to string, amount float64) []journalPosting {
+	return []journalPosting{
+		{ledgerAccount: from, asset: asset, amount: -amount},
+		{ledgerAccount: to, asset: asset, amount: amount},
+	}
+}
+
+/*
+		Post a journal entry with its postings. The postings of each asset MUST sum to 0.
+		Each posting is added to the journal balance of its ledger account, so every ledger account's balance is the sum of its postings.
+		The entry is indexed in the journal and in the journal of every account it posts to.
+	input --
+		kind: deposit/withdraw/reserve/fill/refund/cancel/transfer
+		ref: the id of what triggers the entry: cash movement id, order id, trade id or transfer id
+		time: the time of the entry
+		postings: the postings of the entry
+	err --
+		if postings of an asset does not sum to 0, an error is returned
+		from Incr, HMSet, RPush, ZAdd, HIncrByFloat
+*/
+func postJournalEntry(conn storage.Conn, kind string, ref string, time string, postings []journalPosting) error {
+	sums := make(map[string]float64)
+	for _, posting := range postings {
+		sums[posting.asset] += posting.amount
+	}
+	for asset, sum := range sums {
+		if math.Abs(sum) > JOURNAL_BALANCE_TOLERANCE {
+			return fmt.Errorf("unbalanced journal entry for %s", asset)
+		}
+	}
+
+	id, err := uniqueKeyGenerator.GetNewJournalEntryId(conn)
+	if err != nil {
+		return err
+	}
+	entryId := strconv.Itoa(id)
+
+	err = conn.HMSet(
+		DB_JOURNAL_ENTRY_PREFIX+entryId,
+		map[string]interface{}{
+			DB_JOURNAL_ENTRY_FIELD_KIND: kind,
+			DB_JOURNAL_ENTRY_FIELD_REF:  ref,
+			DB_JOURNAL_ENTRY_FIELD_TIME: time})
+	if err != nil {
+		return err
+	}
+
+	err = conn.ZAdd(DB_JOURNAL, entryId, entryId)
+	if err != nil {
+		return err
+	}
+
+	for _, posting := range postings {
+		err = conn.RPush(DB_JOURNAL_POSTINGS_PREFIX+entryId, posting.ledgerAccount)
+		if err != nil {
+			return err
+		}
+		err = conn.RPush(DB_JOURNAL_POSTINGS_PREFIX+entryId, posting.asset)
+		if err != nil {
+			return err
+		}
+		err = conn.RPush(DB_JOURNAL_POSTINGS_PREFIX+entryId, strconv.FormatFloat(posting.amount, 'f', -1, 64))
+		if err != nil {
+			return err
+		}
+
+		_, err = conn.HIncrByFloat(DB_JOURNAL_BALANCES_PREFIX+posting.asset, posting.ledgerAccount, posting.amount)
+		if err != nil {
+			return err
+		}
+
+		// the external ledger account does not belong to any account
+		if separator := strings.Index(posting.ledgerAccount, ":"); separator >= 0 {
+			err = conn.ZAdd(DB_JOURNAL_ACCOUNT_PREFIX+posting.ledgerAccount[:separator], entryId, entryId)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+/*
+		Get the journal balance of a ledger account for an asset, the sum of every posting to the ledger account.
+		If nothing has been posted to the ledger account, 0 is returned.
+	input --
+		asset: JOURNAL_ASSET_CASH or a symbol name
+		ledgerAccount: the ledger account
+	err --
+		from HExists, HGet, strconv.ParseFloat
+*/
+func getJournalBalance(conn storage.Conn, asset string, ledgerAccount string) (float64, error) {
+	exists, err := conn.HExists(DB_JOURNAL_BALANCES_PREFIX+asset, ledgerAccount)
+	if err != nil || !exists {
+		return 0, err
+	}
+
+	var balance_in_string string
+	balance_in_string, err = conn.HGet(DB_JOURNAL_BALANCES_PREFIX+asset, ledgerAccount)
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.ParseFloat(balance_in_string, 64)
+}
+
+/*
+		Query journal entries posted to an account with entry id greater than sinceEntryId, from the oldest to the latest.
+		Every posting of an entry is returned, including the postings to other ledger accounts.
+		If the account has no journal entry, an EMPTY list is returned.
+	input --
+		uid: user id, no restriction on the length and characters
+		sinceEntryId: journal entry id, entries after it(exclusive) are returned, 0 to read from the first entry
+		limit: the maximum number of entries to return
+	err --
+		from ZRangeByScoreWithLimit, HMGet, LRange
+*/
+func getJournalEntriesOfAccount(conn storage.Conn, uid string, sinceEntryId int, limit int) ([]JournalEntryTuple, error) {
+	entryIds, err := conn.ZRangeByScoreWithLimit(DB_JOURNAL_ACCOUNT_PREFIX+uid, fmt.Sprintf("(%d", sinceEntryId), "+inf", 0, limit)
+	if err != nil {
+		return []JournalEntryTuple{}, err
+	}
+
+	var entries []JournalEntryTuple
+	for _, entryId := range entryIds {
+		var values []string
+		values, err = conn.HMGet(DB_JOURNAL_ENTRY_PREFIX+entryId, []string{
+			DB_JOURNAL_ENTRY_FIELD_KIND,
+			DB_JOURNAL_ENTRY_FIELD_REF,
+			DB_JOURNAL_ENTRY_FIELD_TIME})
+		if err != nil {
+			return []JournalEntryTuple{}, err
+		}
+
+		var postingNodeList []string
+		postingNodeList, err = conn.LRange(DB_JOURNAL_POSTINGS_PREFIX+entryId, 0, -1)
+		if err != nil {
+			return []JournalEntryTuple{}, err
+		}
+
+		entries = append(entries, JournalEntryTuple{
+			EntryId:  entryId,
+			Kind:     values[0],
+			Ref:      values[1],
+			Time:     values[2],
+			Postings: parseJournalPostingNodeList(postingNodeList),
+		})
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,294 @@
+package businessLogic
+
+import (
+	"app/storage"
+	"app/uniqueKeyGenerator"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+const (
+	KILL_SWITCH_ACTION_ENGAGE  = "engage"
+	KILL_SWITCH_ACTION_RELEASE = "release"
+)
+
+type KillSwitchEventTuple struct {
+	EventId           string
+	AdminUid          string
+	Target            string
+	Action            string
+	Reason            string
+	CancelledOrderIds []string
+	Time              string
+	// why an engage stopped before every resting order was cancelled, empty if it did not
+	Error string
+}
+
+/*
+		checkKillSwitch returns an error if the kill switch of the account or of its firm group is engaged.
+		New orders need both kill switches released.
+*/
+func checkKillSwitch(conn storage.Conn, uid string) error {
+	engaged, err := checkKillSwitchEngaged(conn, killSwitchTarget(uid, ""))
+	if err != nil {
+		return fmt.Errorf("database error when checking the kill switch")
+	}
+	if engaged {
+		return fmt.Errorf("kill switch engaged")
+	}
+
+	var groupName string
+	groupName, err = getAccountGroup(conn, uid)
+	if err != nil {
+		return fmt.Errorf("database error when checking the kill switch")
+	}
+	if groupName == "" {
+		return nil
+	}
+	engaged, err = checkKillSwitchEngaged(conn, killSwitchTarget("", groupName))
+	if err != nil {
+		return fmt.Errorf("database error when checking the kill switch")
+	}
+	if engaged {
+		return fmt.Errorf("kill switch of group %s engaged", groupName)
+	}
+	return nil
+}
+
+/*
+		SetAccountGroup puts an account in a firm group, a kill switch of the group applies to every account in it.
+		An account is in at most one group, it leaves its old group.
+	input --
+		adminUid: user id of the requester, MUST BE an admin account
+		uid: user id of the account
+		groupName: the firm group, empty to leave the current group
+	output --
+		err:
+		if adminUid is not an admin account, an error message will be returned
+		if uid does not exist, an error message will be returned
+		if database fails to change the group, an error message will be returned
+*/
+func SetAccountGroup(store storage.Storage, adminUid string, uid string, groupName string) error {
+	conn := store.Get()
+	defer conn.Close()
+
+	err := checkAdminAndAccount(conn, adminUid, uid)
+	if err != nil {
+		return err
+	}
+
+	var oldGroupName string
+	oldGroupName, err = getAccountGroup(conn, uid)
+	if err != nil {
+		return fmt.Errorf("database error when retrieving the group")
+	}
+
+	err = setAccountGroup(conn, uid, oldGroupName, groupName)
+	if err != nil {
+		return fmt.Errorf("database error when changing the group")
+	}
+	return nil
+}
+
+/*
+		EngageKillSwitch engages the kill switch of an account or of a firm group:
+		new orders of the account, or of every account in the group, are rejected until the kill switch is released,
+		and every resting order of them is cancelled across all symbols, with the reserved cash or symbols refunded.
+		The action and the cancelled orders are recorded in the kill switch audit log.
+		If a cancel fails, the event is recorded with the orders cancelled before it and the error, the kill switch stays engaged,
+		and engaging it again cancels the remaining resting orders.
+	input --
+		adminUid: user id of the requester, MUST BE an admin account
+		uid: user id of the account, empty if groupName is given
+		groupName: the firm group, empty if uid is given
+		reason: why the kill switch is engaged, can be empty
+	output --
+		the recorded kill switch event
+		err:
+		if adminUid is not an admin account, an error message will be returned
+		if both or none of uid and groupName are given, or uid does not exist, an error message will be returned
+		if database fails to engage the kill switch or record the event, an error message will be returned
+		if an order can not be cancelled, the recorded event and an error message will be returned
+*/
+func EngageKillSwitch(store storage.Storage, adminUid string, uid string, groupName string, reason string) (KillSwitchEventTuple, error) {
+	conn := store.Get()
+	defer conn.Close()
+
+	err := checkKillSwitchRequest(conn, adminUid, uid, groupName)
+	if err != nil {
+		return KillSwitchEventTuple{}, err
+	}
+
+	target := killSwitchTarget(uid, groupName)
+	var engaged bool
+	engaged, err = checkKillSwitchEngaged(conn, target)
+	if err != nil {
+		return KillSwitchEventTuple{}, fmt.Errorf("database error when checking the kill switch")
+	}
+	// an engaged kill switch is engaged again to cancel the orders a failed engage left resting
+	if !engaged {
+		// block new orders first, so nothing is entered between the cancels
+		err = setKillSwitch(conn, target, true)
+		if err != nil {
+			return KillSwitchEventTuple{}, fmt.Errorf("database error when engaging the kill switch")
+		}
+	}
+
+	uids := []string{uid}
+	if groupName != "" {
+		uids, err = getGroupAccounts(conn, groupName)
+		if err != nil {
+			return KillSwitchEventTuple{}, fmt.Errorf("database error when retrieving the group")
+		}
+		sort.Strings(uids)
+	}
+
+	var cancelledOrderIds []string
+	var cancelErr error
+	for _, accountUid := range uids {
+		var orderIds []string
+		orderIds, cancelErr = cancelAccountOpenOrders(conn, accountUid)
+		cancelledOrderIds = append(cancelledOrderIds, orderIds...)
+		if cancelErr != nil {
+			break
+		}
+	}
+
+	event, err := recordKillSwitchEvent(conn, adminUid, target, KILL_SWITCH_ACTION_ENGAGE, reason, cancelledOrderIds, cancelErr)
+	if err != nil {
+		return KillSwitchEventTuple{}, err
+	}
+	if cancelErr != nil {
+		return event, fmt.Errorf("%s, engage the kill switch again to cancel the remaining orders", cancelErr)
+	}
+	return event, nil
+}
+
+/*
+		ReleaseKillSwitch releases the kill switch of an account or of a firm group, new orders are accepted again.
+		An account still can not enter orders while the kill switch of its group, or its own, is engaged.
+		The action is recorded in the kill switch audit log.
+	input --
+		adminUid: user id of the requester, MUST BE an admin account
+		uid: user id of the account, empty if groupName is given
+		groupName: the firm group, empty if uid is given
+		reason: why the kill switch is released, can be empty
+	output --
+		the recorded kill switch event
+		err:
+		if adminUid is not an admin account, an error message will be returned
+		if both or none of uid and groupName are given, or uid does not exist, an error message will be returned
+		if the kill switch is not engaged, an error message will be returned
+		if database fails to release the kill switch or record the event, an error message will be returned
+*/
+func ReleaseKillSwitch(store storage.Storage, adminUid string, uid string, groupName string, reason string) (KillSwitchEventTuple, error) {
+	conn := store.Get()
+	defer conn.Close()
+
+	err := checkKillSwitchRequest(conn, adminUid, uid, groupName)
+	if err != nil {
+		return KillSwitchEventTuple{}, err
+	}
+
+	target := killSwitchTarget(uid, groupName)
+	var engaged bool
+	engaged, err = checkKillSwitchEngaged(conn, target)
+	if err != nil {
+		return KillSwitchEventTuple{}, fmt.Errorf("database error when checking the kill switch")
+	}
+	if !engaged {
+		return KillSwitchEventTuple{}, fmt.Errorf("kill switch not engaged")
+	}
+
+	err = setKillSwitch(conn, target, false)
+	if err != nil {
+		return KillSwitchEventTuple{}, fmt.Errorf("database error when releasing the kill switch")
+	}
+
+	return recordKillSwitchEvent(conn, adminUid, target, KILL_SWITCH_ACTION_RELEASE, reason, []string{}, nil)
+}
+
+// checkKillSwitchRequest returns an error if adminUid is not an admin account, or the target is not exactly one existing account or one group
+func checkKillSwitchRequest(conn storage.Conn, adminUid string, uid string, groupName string) error {
+	if (uid == "") == (groupName == "") {
+		return fmt.Errorf("either account or group is required")
+	}
+
+	if uid != "" {
+		return checkAdminAndAccount(conn, adminUid, uid)
+	}
+
+	isAdmin, err := checkAdminAccount(conn, adminUid)
+	if err != nil {
+		return fmt.Errorf("database error when checking admin account")
+	}
+	if !isAdmin {
+		return fmt.Errorf("permission denied")
+	}
+	return nil
+}
+
+// recordKillSwitchEvent records an event, cancelErr is the error which stopped the cancels of an engage, nil if none did
+func recordKillSwitchEvent(conn storage.Conn, adminUid string, target string, action string, reason string, cancelledOrderIds []string, cancelErr error) (KillSwitchEventTuple, error) {
+	id, err := uniqueKeyGenerator.GetNewKillSwitchEventId(conn)
+	if err != nil {
+		return KillSwitchEventTuple{}, fmt.Errorf("error when generating killSwitchEventId")
+	}
+
+	event := KillSwitchEventTuple{
+		EventId:           strconv.Itoa(id),
+		AdminUid:          adminUid,
+		Target:            target,
+		Action:            action,
+		Reason:            reason,
+		CancelledOrderIds: cancelledOrderIds,
+		Time:              getCurrentTimeInString(),
+	}
+	if cancelErr != nil {
+		event.Error = cancelErr.Error()
+	}
+	err = insertKillSwitchEventToLog(conn, event)
+	if err != nil {
+		return KillSwitchEventTuple{}, fmt.Errorf("database error when recording the kill switch event")
+	}
+	return event, nil
+}
+
+/*
+		QueryKillSwitchEvents query the kill switch audit log, from the oldest to the latest.
+	input --
+		adminUid: user id of the requester, MUST BE an admin account
+		sinceEventId: event id, events after it(exclusive) are returned, 0 to read from the first event
+		limit: the maximum number of events to return, should be positive
+	output --
+		a list of kill switch event tuples
+		err:
+		if adminUid is not an admin account, an error message will be returned
+		if sinceEventId or limit does not meet input restriction, an error message will be returned
+		if database fails to retrieve the events, an error message will be returned
+*/
+func QueryKillSwitchEvents(store storage.Storage, adminUid string, sinceEventId int, limit int) ([]KillSwitchEventTuple, error) {
+	if sinceEventId < 0 || limit <= 0 {
+		return []KillSwitchEventTuple{}, fmt.Errorf("invalid since or limit")
+	}
+
+	conn := store.Get()
+	defer conn.Close()
+
+	isAdmin, err := checkAdminAccount(conn, adminUid)
+	if err != nil {
+		return []KillSwitchEventTuple{}, fmt.Errorf("database error when checking admin account")
+	}
+	if !isAdmin {
+		return []KillSwitchEventTuple{}, fmt.Errorf("permission denied")
+	}
+
+	var events []KillSwitchEventTuple
+	events, err = getKillSwitchEventsFromLog(conn, sinceEventId, limit)
+	if err != nil {
+		return []KillSwitchEventTuple{}, fmt.Errorf("database error when retrieving the kill switch events")
+	}
+
+	return events, nil
+}
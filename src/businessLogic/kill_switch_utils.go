@@ -0,0 +1,182 @@
+package businessLogic
+
+import (
+	"app/storage"
+	"fmt"
+	"strings"
+)
+
+const (
+	DB_ACCOUNT_FIELD_GROUP              = "group"
+	DB_FIRM_GROUP_PREFIX                = "firmGroup:"
+	DB_KILL_SWITCHES                    = "killSwitches"
+	DB_KILL_SWITCH_EVENT_PREFIX         = "killSwitchEvent:"
+	DB_KILL_SWITCH_EVENT_LOG            = "killSwitchEvents"
+	DB_KILL_SWITCH_EVENT_FIELD_ADMIN    = "admin"
+	DB_KILL_SWITCH_EVENT_FIELD_TARGET   = "target"
+	DB_KILL_SWITCH_EVENT_FIELD_ACTION   = "action"
+	DB_KILL_SWITCH_EVENT_FIELD_REASON   = "reason"
+	DB_KILL_SWITCH_EVENT_FIELD_CANCELED = "canceled"
+	DB_KILL_SWITCH_EVENT_FIELD_TIME     = "time"
+	DB_KILL_SWITCH_EVENT_FIELD_ERROR    = "error"
+)
+
+// the target of a kill switch: account:<uid> or group:<group name>
+func killSwitchTarget(uid string, groupName string) string {
+	if groupName != "" {
+		return "group:" + groupName
+	}
+	return "account:" + uid
+}
+
+/*
+		Get the firm group of an account, empty if the account is in no group.
+		This function will NOT check if the account exists, User has to MAKE SURE that the account exists.
+	input --
+		uid: user id, no restriction on the length and characters
+	err --
+		from HMGet
+*/
+func getAccountGroup(conn storage.Conn, uid string) (string, error) {
+	values, err := conn.HMGet(DB_ACCOUNT_PREFIX+uid, []string{DB_ACCOUNT_FIELD_GROUP})
+	if err != nil {
+		return "", err
+	}
+	return values[0], nil
+}
+
+/*
+		Move an account to a firm group, out of its old group.
+		This function will NOT check if the account exists, User has to MAKE SURE that the account exists.
+	input --
+		uid: user id, no restriction on the length and characters
+		oldGroupName: the current group of the account, empty if it is in no group
+		groupName: the new group, empty to leave every group
+	err --
+		from SRem, SAdd, HSet, HDel
+*/
+func setAccountGroup(conn storage.Conn, uid string, oldGroupName string, groupName string) error {
+	if oldGroupName != "" {
+		err := conn.SRem(DB_FIRM_GROUP_PREFIX+oldGroupName, uid)
+		if err != nil {
+			return err
+		}
+	}
+	if groupName == "" {
+		return conn.HDel(DB_ACCOUNT_PREFIX+uid, DB_ACCOUNT_FIELD_GROUP)
+	}
+
+	err := conn.SAdd(DB_FIRM_GROUP_PREFIX+groupName, uid)
+	if err != nil {
+		return err
+	}
+	return conn.HSet(DB_ACCOUNT_PREFIX+uid, DB_ACCOUNT_FIELD_GROUP, groupName)
+}
+
+/*
+		Get the accounts of a firm group.
+		Order of results: NON-PREDICTABLE
+	err --
+		from SMembers
+*/
+func getGroupAccounts(conn storage.Conn, groupName string) ([]string, error) {
+	return conn.SMembers(DB_FIRM_GROUP_PREFIX+groupName)
+}
+
+/*
+		Check if the kill switch of a target is engaged.
+	input --
+		target: from killSwitchTarget
+	err --
+		from SIsMember
+*/
+func checkKillSwitchEngaged(conn storage.Conn, target string) (bool, error) {
+	return conn.SIsMember(DB_KILL_SWITCHES, target)
+}
+
+/*
+		Engage or release the kill switch of a target.
+	input --
+		target: from killSwitchTarget
+	err --
+		from SAdd, SRem
+*/
+func setKillSwitch(conn storage.Conn, target string, engaged bool) error {
+	if engaged {
+		return conn.SAdd(DB_KILL_SWITCHES, target)
+	}
+	return conn.SRem(DB_KILL_SWITCHES, target)
+}
+
+/*
+		Record a kill switch event in the kill switch audit log.
+	input --
+		event: the event, MAKE SURE its event id is unique
+	err --
+		from HMSet, ZAdd
+*/
+func insertKillSwitchEventToLog(conn storage.Conn, event KillSwitchEventTuple) error {
+	err := conn.HMSet(
+		DB_KILL_SWITCH_EVENT_PREFIX+event.EventId,
+		map[string]interface{}{
+			DB_KILL_SWITCH_EVENT_FIELD_ADMIN:    event.AdminUid,
+			DB_KILL_SWITCH_EVENT_FIELD_TARGET:   event.Target,
+			DB_KILL_SWITCH_EVENT_FIELD_ACTION:   event.Action,
+			DB_KILL_SWITCH_EVENT_FIELD_REASON:   event.Reason,
+			DB_KILL_SWITCH_EVENT_FIELD_CANCELED: strings.Join(event.CancelledOrderIds, ","),
+			DB_KILL_SWITCH_EVENT_FIELD_TIME:     event.Time,
+			DB_KILL_SWITCH_EVENT_FIELD_ERROR:    event.Error})
+	if err != nil {
+		return err
+	}
+
+	return conn.ZAdd(DB_KILL_SWITCH_EVENT_LOG, event.EventId, event.EventId)
+}
+
+/*
+		Query events from the kill switch audit log with event id greater than sinceEventId, from the oldest to the latest.
+		If the log does not exist, an EMPTY list is returned.
+	input --
+		sinceEventId: event id, events after it(exclusive) are returned, 0 to read from the first event
+		limit: the maximum number of events to return
+	err --
+		from ZRangeByScoreWithLimit, HMGet
+*/
+func getKillSwitchEventsFromLog(conn storage.Conn, sinceEventId int, limit int) ([]KillSwitchEventTuple, error) {
+	eventIds, err := conn.ZRangeByScoreWithLimit(DB_KILL_SWITCH_EVENT_LOG, fmt.Sprintf("(%d", sinceEventId), "+inf", 0, limit)
+	if err != nil {
+		return []KillSwitchEventTuple{}, err
+	}
+
+	var events []KillSwitchEventTuple
+	for _, eventId := range eventIds {
+		values, err := conn.HMGet(DB_KILL_SWITCH_EVENT_PREFIX+eventId, []string{
+			DB_KILL_SWITCH_EVENT_FIELD_ADMIN,
+			DB_KILL_SWITCH_EVENT_FIELD_TARGET,
+			DB_KILL_SWITCH_EVENT_FIELD_ACTION,
+			DB_KILL_SWITCH_EVENT_FIELD_REASON,
+			DB_KILL_SWITCH_EVENT_FIELD_CANCELED,
+			DB_KILL_SWITCH_EVENT_FIELD_TIME,
+			DB_KILL_SWITCH_EVENT_FIELD_ERROR})
+		if err != nil {
+			return []KillSwitchEventTuple{}, err
+		}
+
+		var cancelledOrderIds []string
+		if values[4] != "" {
+			cancelledOrderIds = strings.Split(values[4], ",")
+		}
+		events = append(events, KillSwitchEventTuple{
+			EventId:           eventId,
+			AdminUid:          values[0],
+			Target:            values[1],
+			Action:            values[2],
+			Reason:            values[3],
+			CancelledOrderIds: cancelledOrderIds,
+			Time:              values[5],
+			Error:             values[6],
+		})
+	}
+
+	return events, nil
+}
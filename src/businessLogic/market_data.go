@@ -0,0 +1,159 @@
+package businessLogic
+
+import (
+	"app/storage"
+	"fmt"
+	"strconv"
+)
+
+type TickerTuple struct {
+	BestBid    string
+	BestAsk    string
+	Spread     string
+	LastPrice  string
+	LastAmount string
+	LastTime   string
+	Open       string
+	High       string
+	Low        string
+	Close      string
+	Volume     string
+	Notional   string
+}
+
+type CandleTuple struct {
+	StartTime string
+	Open      string
+	High      string
+	Low       string
+	Close     string
+	Volume    string
+}
+
+type TradeTuple struct {
+	TradeId     string
+	BuyOrderId  string
+	SellOrderId string
+	Aggressor   string
+	Price       string
+	Amount      string
+	Time        string
+}
+
+/*
+		QueryTicker query the top of book and the current session statistics of a symbol.
+		A session is a UTC day, see updateTickerWithTrade.
+	input --
+		symbolName: the symbol of the ticker
+	output --
+		a ticker tuple
+		eg: if the buy order book is empty, BestBid and Spread will be empty
+		eg: if the symbol has never traded, the last trade and session fields will be empty
+		eg: if the symbol has not traded in the current session, the session fields will be empty
+		err:
+		if database fails to retrieve the ticker or the order books, an error message will be returned
+*/
+func QueryTicker(store storage.Storage, symbolName string) (TickerTuple, error) {
+	conn := store.Get()
+	defer conn.Close()
+
+	ticker, err := getTicker(conn, symbolName)
+	if err != nil {
+		return TickerTuple{}, fmt.Errorf("database error when retrieving the ticker")
+	}
+
+	var bids, asks []OrderBookLevelTuple
+	bids, err = getOrderBookLevels(conn, ORDER_TYPE_BUY, symbolName, 1)
+	if err != nil {
+		return TickerTuple{}, fmt.Errorf("database error when retrieving the buy order book levels")
+	}
+	asks, err = getOrderBookLevels(conn, ORDER_TYPE_SELL, symbolName, 1)
+	if err != nil {
+		return TickerTuple{}, fmt.Errorf("database error when retrieving the sell order book levels")
+	}
+
+	if len(bids) > 0 {
+		ticker.BestBid = bids[0].Price
+	}
+	if len(asks) > 0 {
+		ticker.BestAsk = asks[0].Price
+	}
+	if len(bids) > 0 && len(asks) > 0 {
+		var bestBid, bestAsk float64
+		bestBid, err = strconv.ParseFloat(ticker.BestBid, 64)
+		if err != nil {
+			return TickerTuple{}, fmt.Errorf("database error when retrieving the buy order book levels")
+		}
+		bestAsk, err = strconv.ParseFloat(ticker.BestAsk, 64)
+		if err != nil {
+			return TickerTuple{}, fmt.Errorf("database error when retrieving the sell order book levels")
+		}
+		ticker.Spread = formatPriceLevel(bestAsk - bestBid)
+	}
+
+	return ticker, nil
+}
+
+/*
+		QueryCandles query the OHLCV candles of a symbol in an interval, from the oldest to the latest.
+		Only candles of the latest CANDLE_RETENTION intervals are kept.
+	input --
+		symbolName: the symbol of the candles
+		interval: candle interval name, one of CANDLE_INTERVALS(1s, 1m, 5m, 1h, 1d)
+		from: unix epoch in seconds, the earliest candle start time to return
+		to: unix epoch in seconds, the latest candle start time to return
+	output --
+		a list of candle tuples
+		eg: if no trade happened between from and to, the list will be empty
+		err:
+		if interval, from or to does not meet input restriction, an error message will be returned
+		if database fails to retrieve the candles, an error message will be returned
+*/
+func QueryCandles(store storage.Storage, symbolName string, interval string, from int64, to int64) ([]CandleTuple, error) {
+	if _, ok := CANDLE_INTERVALS[interval]; !ok {
+		return []CandleTuple{}, fmt.Errorf("invalid interval")
+	}
+	if from < 0 || from > to {
+		return []CandleTuple{}, fmt.Errorf("invalid time range")
+	}
+
+	conn := store.Get()
+	defer conn.Close()
+
+	candles, err := getCandles(conn, symbolName, interval, from, to)
+	if err != nil {
+		return []CandleTuple{}, fmt.Errorf("database error when retrieving the candles")
+	}
+
+	return candles, nil
+}
+
+/*
+		QueryTrades query the public trade tape of a symbol, from the oldest to the latest trade.
+		Every trade has a unique trade id, which increases with time. Poll with the last trade id seen to get new trades.
+	input --
+		symbolName: the symbol of the trades
+		sinceTradeId: trades with trade id greater than it are returned, 0 to read from the first trade
+		limit: the maximum number of trades to return, should be positive
+	output --
+		a list of trade tuples
+		eg: if no trade happened after sinceTradeId, the list will be empty
+		err:
+		if sinceTradeId or limit does not meet input restriction, an error message will be returned
+		if database fails to retrieve the trades, an error message will be returned
+*/
+func QueryTrades(store storage.Storage, symbolName string, sinceTradeId int, limit int) ([]TradeTuple, error) {
+	if sinceTradeId < 0 || limit <= 0 {
+		return []TradeTuple{}, fmt.Errorf("invalid since or limit")
+	}
+
+	conn := store.Get()
+	defer conn.Close()
+
+	trades, err := getTradesFromTradeLog(conn, symbolName, sinceTradeId, limit)
+	if err != nil {
+		return []TradeTuple{}, fmt.Errorf("database error when retrieving the trades")
+	}
+
+	return trades, nil
+}
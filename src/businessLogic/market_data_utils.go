@@ -0,0 +1,413 @@
+package businessLogic
+
+import (
+	"app/storage"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+const (
+	DB_TICKER_PREFIX            = "ticker:"
+	DB_TICKER_FIELD_LAST_PRICE  = "lastPrice"
+	DB_TICKER_FIELD_LAST_AMOUNT = "lastAmount"
+	DB_TICKER_FIELD_LAST_TIME   = "lastTime"
+	DB_TICKER_FIELD_SESSION     = "session"
+	DB_TICKER_FIELD_OPEN        = "open"
+	DB_TICKER_FIELD_HIGH        = "high"
+	DB_TICKER_FIELD_LOW         = "low"
+	DB_TICKER_FIELD_VOLUME      = "volume"
+	DB_TICKER_FIELD_NOTIONAL    = "notional"
+
+	SECONDS_PER_SESSION = 24 * 60 * 60
+
+	DB_CANDLES_PREFIX      = "candles:"
+	DB_CANDLE_PREFIX       = "candle:"
+	DB_CANDLE_FIELD_OPEN   = "open"
+	DB_CANDLE_FIELD_HIGH   = "high"
+	DB_CANDLE_FIELD_LOW    = "low"
+	DB_CANDLE_FIELD_CLOSE  = "close"
+	DB_CANDLE_FIELD_VOLUME = "volume"
+
+	DB_TRADE_PREFIX           = "trade:"
+	DB_TRADE_LOG_PREFIX       = "trades:"
+	DB_TRADE_FIELD_SYMBOL     = "symbol"
+	DB_TRADE_FIELD_BUY_ORDER  = "buyOrder"
+	DB_TRADE_FIELD_SELL_ORDER = "sellOrder"
+	DB_TRADE_FIELD_AGGRESSOR  = "aggressor"
+	DB_TRADE_FIELD_PRICE      = "price"
+	DB_TRADE_FIELD_AMOUNT     = "amount"
+	DB_TRADE_FIELD_TIME       = "time"
+)
+
+// candle interval name --> length of the interval in seconds
+var CANDLE_INTERVALS = map[string]int64{
+	"1s": 1,
+	"1m": 60,
+	"5m": 5 * 60,
+	"1h": 60 * 60,
+	"1d": 24 * 60 * 60,
+}
+
+// candle interval name --> number of candles kept for the interval, older candles are removed
+var CANDLE_RETENTION = map[string]int64{
+	"1s": 60 * 60,
+	"1m": 24 * 60,
+	"5m": 7 * 24 * 12,
+	"1h": 30 * 24,
+	"1d": 365,
+}
+
+/*
+		Update the ticker statistics of a symbol with a trade.
+		A session is a UTC day. The first trade of a session resets open, high, low, volume and notional,
+		later trades in the same session extend them. Close of a session is the last trade price.
+	input --
+		symbolName: the symbol of the trade
+		price: the trade price
+		amount: the trade amount, should be positive
+		time: the trade time, unix epoch in seconds
+	err --
+		from HMGet, HMSet, HIncrByFloat, strconv.ParseFloat, strconv.ParseInt
+*/
+func updateTickerWithTrade(conn storage.Conn, symbolName string, price float64, amount float64, time string) error {
+	epoch, err := strconv.ParseInt(time, 10, 64)
+	if err != nil {
+		return err
+	}
+	session := strconv.FormatInt(epoch/SECONDS_PER_SESSION, 10)
+
+	tickerKey := DB_TICKER_PREFIX + symbolName
+	var session_n_high_n_low []string
+	session_n_high_n_low, err = conn.HMGet(tickerKey, []string{DB_TICKER_FIELD_SESSION, DB_TICKER_FIELD_HIGH, DB_TICKER_FIELD_LOW})
+	if err != nil {
+		return err
+	}
+
+	if session_n_high_n_low[0] != session {
+		return conn.HMSet(tickerKey, map[string]interface{}{
+			DB_TICKER_FIELD_LAST_PRICE:  price,
+			DB_TICKER_FIELD_LAST_AMOUNT: amount,
+			DB_TICKER_FIELD_LAST_TIME:   time,
+			DB_TICKER_FIELD_SESSION:     session,
+			DB_TICKER_FIELD_OPEN:        price,
+			DB_TICKER_FIELD_HIGH:        price,
+			DB_TICKER_FIELD_LOW:         price,
+			DB_TICKER_FIELD_VOLUME:      amount,
+			DB_TICKER_FIELD_NOTIONAL:    price * amount})
+	}
+
+	var high, low float64
+	high, err = strconv.ParseFloat(session_n_high_n_low[1], 64)
+	if err != nil {
+		return err
+	}
+	low, err = strconv.ParseFloat(session_n_high_n_low[2], 64)
+	if err != nil {
+		return err
+	}
+
+	err = conn.HMSet(tickerKey, map[string]interface{}{
+		DB_TICKER_FIELD_LAST_PRICE:  price,
+		DB_TICKER_FIELD_LAST_AMOUNT: amount,
+		DB_TICKER_FIELD_LAST_TIME:   time,
+		DB_TICKER_FIELD_HIGH:        math.Max(high, price),
+		DB_TICKER_FIELD_LOW:         math.Min(low, price)})
+	if err != nil {
+		return err
+	}
+
+	_, err = conn.HIncrByFloat(tickerKey, DB_TICKER_FIELD_VOLUME, amount)
+	if err != nil {
+		return err
+	}
+	_, err = conn.HIncrByFloat(tickerKey, DB_TICKER_FIELD_NOTIONAL, price*amount)
+	return err
+}
+
+/*
+		Query the ticker statistics of a symbol: last trade and current session open/high/low/close, volume and notional.
+		If the symbol has never traded, all fields of the returned tuple are empty.
+		If the symbol has not traded in the current session, the session fields are empty and only the last trade is returned.
+		Best bid, best ask and spread are NOT filled by this function.
+	input --
+		symbolName: the symbol of the ticker
+	err --
+		from HMGet
+*/
+func getTicker(conn storage.Conn, symbolName string) (TickerTuple, error) {
+	values, err := conn.HMGet(DB_TICKER_PREFIX+symbolName, []string{
+		DB_TICKER_FIELD_LAST_PRICE,
+		DB_TICKER_FIELD_LAST_AMOUNT,
+		DB_TICKER_FIELD_LAST_TIME,
+		DB_TICKER_FIELD_OPEN,
+		DB_TICKER_FIELD_HIGH,
+		DB_TICKER_FIELD_LOW,
+		DB_TICKER_FIELD_VOLUME,
+		DB_TICKER_FIELD_NOTIONAL,
+		DB_TICKER_FIELD_SESSION})
+	if err != nil {
+		return TickerTuple{}, err
+	}
+
+	// the session is only rolled over by a trade, the statistics of a previous session are not the current ones
+	session := values[8]
+	values = values[:8]
+	if session != strconv.FormatInt(getCurrentEpoch()/SECONDS_PER_SESSION, 10) {
+		for i := 3; i < len(values); i++ {
+			values[i] = ""
+		}
+	}
+
+	for i, value := range values {
+		// lastTime is an epoch, keep it as it is
+		if value == "" || i == 2 {
+			continue
+		}
+		var number float64
+		number, err = strconv.ParseFloat(value, 64)
+		if err != nil {
+			return TickerTuple{}, err
+		}
+		values[i] = fmt.Sprintf("%f", number)
+	}
+
+	ticker := TickerTuple{
+		LastPrice:  values[0],
+		LastAmount: values[1],
+		LastTime:   values[2],
+		Open:       values[3],
+		High:       values[4],
+		Low:        values[5],
+		Volume:     values[6],
+		Notional:   values[7],
+	}
+	if ticker.Open != "" {
+		ticker.Close = ticker.LastPrice
+	}
+	return ticker, nil
+}
+
+/*
+		Update the candles of a symbol in every interval of CANDLE_INTERVALS with a trade.
+		The first trade of a candle sets open, high, low, close and volume, later trades in the same candle extend them.
+		Before a new candle is created, candles older than CANDLE_RETENTION of that interval are removed.
+	input --
+		symbolName: the symbol of the trade
+		price: the trade price
+		amount: the trade amount, should be positive
+		time: the trade time, unix epoch in seconds
+	err --
+		from HMGet, HMSet, HIncrByFloat, ZAdd, ZRangeByScore, ZRemRangeByScore, Delete, strconv.ParseFloat, strconv.ParseInt
+*/
+func updateCandlesWithTrade(conn storage.Conn, symbolName string, price float64, amount float64, time string) error {
+	epoch, err := strconv.ParseInt(time, 10, 64)
+	if err != nil {
+		return err
+	}
+
+	for interval, seconds := range CANDLE_INTERVALS {
+		candleStart := epoch - epoch%seconds
+		candlesKey := DB_CANDLES_PREFIX + symbolName + ":" + interval
+		candleKey := DB_CANDLE_PREFIX + symbolName + ":" + interval + ":" + strconv.FormatInt(candleStart, 10)
+
+		var high_n_low []string
+		high_n_low, err = conn.HMGet(candleKey, []string{DB_CANDLE_FIELD_HIGH, DB_CANDLE_FIELD_LOW})
+		if err != nil {
+			return err
+		}
+
+		if high_n_low[0] == "" {
+			// read the expired candles before the new candle is added, so this works in runAtomically
+			err = removeExpiredCandles(conn, symbolName, interval, candleStart-CANDLE_RETENTION[interval]*seconds)
+			if err != nil {
+				return err
+			}
+			err = conn.HMSet(candleKey, map[string]interface{}{
+				DB_CANDLE_FIELD_OPEN:   price,
+				DB_CANDLE_FIELD_HIGH:   price,
+				DB_CANDLE_FIELD_LOW:    price,
+				DB_CANDLE_FIELD_CLOSE:  price,
+				DB_CANDLE_FIELD_VOLUME: amount})
+			if err != nil {
+				return err
+			}
+			err = conn.ZAdd(candlesKey, candleStart, strconv.FormatInt(candleStart, 10))
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		var high, low float64
+		high, err = strconv.ParseFloat(high_n_low[0], 64)
+		if err != nil {
+			return err
+		}
+		low, err = strconv.ParseFloat(high_n_low[1], 64)
+		if err != nil {
+			return err
+		}
+
+		err = conn.HMSet(candleKey, map[string]interface{}{
+			DB_CANDLE_FIELD_HIGH:  math.Max(high, price),
+			DB_CANDLE_FIELD_LOW:   math.Min(low, price),
+			DB_CANDLE_FIELD_CLOSE: price})
+		if err != nil {
+			return err
+		}
+		_, err = conn.HIncrByFloat(candleKey, DB_CANDLE_FIELD_VOLUME, amount)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+/*
+		Remove the candles of a symbol in an interval which start before the given time.
+	input --
+		symbolName: the symbol of the candles
+		interval: candle interval name, one of CANDLE_INTERVALS
+		before: unix epoch in seconds, candles starting before it(exclusive) are removed
+	err --
+		from ZRangeByScore, ZRemRangeByScore, Delete
+*/
+func removeExpiredCandles(conn storage.Conn, symbolName string, interval string, before int64) error {
+	candlesKey := DB_CANDLES_PREFIX + symbolName + ":" + interval
+	expiredCandleStarts, err := conn.ZRangeByScore(candlesKey, "-inf", fmt.Sprintf("(%d", before))
+	if err != nil {
+		return err
+	}
+
+	for _, candleStart := range expiredCandleStarts {
+		err = conn.Delete(DB_CANDLE_PREFIX+symbolName+":"+interval+":"+candleStart)
+		if err != nil {
+			return err
+		}
+	}
+
+	return conn.ZRemRangeByScore(candlesKey, "-inf", fmt.Sprintf("(%d", before))
+}
+
+/*
+		Query the candles of a symbol in an interval which start between from and to(both inclusive).
+		Candles are returned from the oldest to the latest. Intervals without any trade have no candle.
+		This function will NOT check if the interval is one of CANDLE_INTERVALS.
+	input --
+		symbolName: the symbol of the candles
+		interval: candle interval name
+		from: unix epoch in seconds
+		to: unix epoch in seconds
+	err --
+		from ZRangeByScore, HMGet
+*/
+func getCandles(conn storage.Conn, symbolName string, interval string, from int64, to int64) ([]CandleTuple, error) {
+	candleStarts, err := conn.ZRangeByScore(DB_CANDLES_PREFIX+symbolName+":"+interval, from, to)
+	if err != nil {
+		return []CandleTuple{}, err
+	}
+
+	var candles []CandleTuple
+	for _, candleStart := range candleStarts {
+		var values []string
+		values, err = conn.HMGet(DB_CANDLE_PREFIX+symbolName+":"+interval+":"+candleStart, []string{
+			DB_CANDLE_FIELD_OPEN,
+			DB_CANDLE_FIELD_HIGH,
+			DB_CANDLE_FIELD_LOW,
+			DB_CANDLE_FIELD_CLOSE,
+			DB_CANDLE_FIELD_VOLUME})
+		if err != nil {
+			return []CandleTuple{}, err
+		}
+
+		candles = append(candles, CandleTuple{
+			StartTime: candleStart,
+			Open:      values[0],
+			High:      values[1],
+			Low:       values[2],
+			Close:     values[3],
+			Volume:    values[4],
+		})
+	}
+
+	return candles, nil
+}
+
+/*
+		Insert a trade to the trade log of a symbol. Each trade is recorded once, for both its buy and sell order.
+		If a trade with the same trade id exists, it will be UPDATED.
+	input --
+		tradeId: trade id, a base-10 digit sequence, MAKE SURE it is unique
+		symbolName: the symbol of the trade
+		buyOrderId: the buy order of the trade
+		sellOrderId: the sell order of the trade
+		aggressor: buy/sell, the order type of the order which inits the trade
+		price: the trade price
+		amount: the trade amount, should be positive
+		time: the trade time
+	err --
+		from HMSet, ZAdd
+*/
+func insertTradeToTradeLog(conn storage.Conn, tradeId string, symbolName string, buyOrderId string, sellOrderId string, aggressor string, price float64, amount float64, time string) error {
+	err := conn.HMSet(
+		DB_TRADE_PREFIX+tradeId,
+		map[string]interface{}{
+			DB_TRADE_FIELD_SYMBOL:     symbolName,
+			DB_TRADE_FIELD_BUY_ORDER:  buyOrderId,
+			DB_TRADE_FIELD_SELL_ORDER: sellOrderId,
+			DB_TRADE_FIELD_AGGRESSOR:  aggressor,
+			DB_TRADE_FIELD_PRICE:      price,
+			DB_TRADE_FIELD_AMOUNT:     amount,
+			DB_TRADE_FIELD_TIME:       time})
+	if err != nil {
+		return err
+	}
+
+	return conn.ZAdd(DB_TRADE_LOG_PREFIX+symbolName, tradeId, tradeId)
+}
+
+/*
+		Query trades from the trade log of a symbol with trade id greater than sinceTradeId, from the oldest to the latest.
+		If the trade log does not exist, an EMPTY list is returned.
+	input --
+		symbolName: the symbol of the trade log
+		sinceTradeId: trade id, trades after it(exclusive) are returned, 0 to read from the first trade
+		limit: the maximum number of trades to return
+	err --
+		from ZRangeByScoreWithLimit, HMGet
+*/
+func getTradesFromTradeLog(conn storage.Conn, symbolName string, sinceTradeId int, limit int) ([]TradeTuple, error) {
+	tradeIds, err := conn.ZRangeByScoreWithLimit(DB_TRADE_LOG_PREFIX+symbolName, fmt.Sprintf("(%d", sinceTradeId), "+inf", 0, limit)
+	if err != nil {
+		return []TradeTuple{}, err
+	}
+
+	var trades []TradeTuple
+	for _, tradeId := range tradeIds {
+		var values []string
+		values, err = conn.HMGet(DB_TRADE_PREFIX+tradeId, []string{
+			DB_TRADE_FIELD_BUY_ORDER,
+			DB_TRADE_FIELD_SELL_ORDER,
+			DB_TRADE_FIELD_AGGRESSOR,
+			DB_TRADE_FIELD_PRICE,
+			DB_TRADE_FIELD_AMOUNT,
+			DB_TRADE_FIELD_TIME})
+		if err != nil {
+			return []TradeTuple{}, err
+		}
+
+		trades = append(trades, TradeTuple{
+			TradeId:     tradeId,
+			BuyOrderId:  values[0],
+			SellOrderId: values[1],
+			Aggressor:   values[2],
+			Price:       values[3],
+			Amount:      values[4],
+			Time:        values[5],
+		})
+	}
+
+	return trades, nil
+}
@@ -0,0 +1,192 @@
+package businessLogic
+
+import (
+	"app/storage"
+	"fmt"
+	"sort"
+	"time"
+)
+
+const (
+	RATE_LIMIT_KIND_ORDERS   = "orders"
+	RATE_LIMIT_KIND_CANCELS  = "cancels"
+	RATE_LIMIT_KIND_MESSAGES = "messages"
+)
+
+var RATE_LIMIT_KINDS = []string{RATE_LIMIT_KIND_ORDERS, RATE_LIMIT_KIND_CANCELS, RATE_LIMIT_KIND_MESSAGES}
+
+// default limits of an account without limits of its own, 0 means unlimited
+var MaxOrdersPerSecond = 100
+var MaxCancelsPerSecond = 100
+var MaxMessagesPerConnection = 100
+
+type RateStatsTuple struct {
+	Uid       string
+	Accepted  map[string]string
+	Throttled map[string]string
+}
+
+func defaultRateLimit(kind string) int {
+	if kind == RATE_LIMIT_KIND_ORDERS {
+		return MaxOrdersPerSecond
+	}
+	if kind == RATE_LIMIT_KIND_CANCELS {
+		return MaxCancelsPerSecond
+	}
+	return MaxMessagesPerConnection
+}
+
+/*
+		CheckRateLimit counts a new order or cancel of an account in the current second,
+		and returns an error if the account has sent more than its limit in the second.
+		Accepted and throttled messages are counted in the account's rate limit statistics.
+	input --
+		uid: user id of the account sending the message
+		kind: RATE_LIMIT_KIND_ORDERS or RATE_LIMIT_KIND_CANCELS
+	output --
+		err:
+		if the limit is exceeded, an error message will be returned
+		if database fails to count the message, an error message will be returned
+*/
+func CheckRateLimit(store storage.Storage, uid string, kind string) error {
+	conn := store.Get()
+	defer conn.Close()
+
+	limit, err := getRateLimit(conn, uid, kind, defaultRateLimit(kind))
+	if err != nil {
+		return fmt.Errorf("database error when retrieving the rate limit")
+	}
+
+	count := 0
+	if limit > 0 {
+		count, err = incrRateCounter(conn, uid, kind, time.Now().Unix())
+		if err != nil {
+			return fmt.Errorf("database error when counting the message")
+		}
+	}
+
+	if limit > 0 && count > limit {
+		err = addRateStats(conn, uid, kind, 0, 1)
+		if err != nil {
+			return fmt.Errorf("database error when counting the message")
+		}
+		return fmt.Errorf("throttled: more than %d %s per second", limit, kind)
+	}
+
+	err = addRateStats(conn, uid, kind, 1, 0)
+	if err != nil {
+		return fmt.Errorf("database error when counting the message")
+	}
+	return nil
+}
+
+/*
+		CheckMessageLimit returns how many messages of a connection are accepted,
+		the messages after the account's limit of messages per connection are throttled.
+		Accepted and throttled messages are counted in the account's rate limit statistics.
+	input --
+		uid: user id of the account sending the messages
+		numberOfMessages: the number of messages sent in the connection
+	output --
+		the number of accepted messages, the first ones of the connection
+		err:
+		if database fails to retrieve the limit or count the messages, an error message will be returned
+*/
+func CheckMessageLimit(store storage.Storage, uid string, numberOfMessages int) (int, error) {
+	conn := store.Get()
+	defer conn.Close()
+
+	limit, err := getRateLimit(conn, uid, RATE_LIMIT_KIND_MESSAGES, MaxMessagesPerConnection)
+	if err != nil {
+		return 0, fmt.Errorf("database error when retrieving the rate limit")
+	}
+
+	accepted := numberOfMessages
+	if limit > 0 && accepted > limit {
+		accepted = limit
+	}
+
+	err = addRateStats(conn, uid, RATE_LIMIT_KIND_MESSAGES, accepted, numberOfMessages-accepted)
+	if err != nil {
+		return 0, fmt.Errorf("database error when counting the messages")
+	}
+	return accepted, nil
+}
+
+/*
+		SetRateLimits sets the limits of an account, which replace the default limits for the account.
+	input --
+		adminUid: user id of the requester, MUST BE an admin account
+		uid: user id of the account to limit
+		limits: RATE_LIMIT_KIND_* to limit, 0 means unlimited and a negative limit restores the default limit
+	output --
+		err:
+		if adminUid is not an admin account, an error message will be returned
+		if uid does not exist, an error message will be returned
+		if a kind is unknown, an error message will be returned
+		if database fails to store the limits, an error message will be returned
+*/
+func SetRateLimits(store storage.Storage, adminUid string, uid string, limits map[string]int) error {
+	for kind := range limits {
+		if kind != RATE_LIMIT_KIND_ORDERS && kind != RATE_LIMIT_KIND_CANCELS && kind != RATE_LIMIT_KIND_MESSAGES {
+			return fmt.Errorf("invalid rate limit kind")
+		}
+	}
+
+	conn := store.Get()
+	defer conn.Close()
+
+	err := checkAdminAndAccount(conn, adminUid, uid)
+	if err != nil {
+		return err
+	}
+
+	err = setRateLimits(conn, uid, limits)
+	if err != nil {
+		return fmt.Errorf("database error when storing the rate limits")
+	}
+	return nil
+}
+
+/*
+		QueryRateStats returns the accepted and throttled counts of orders, cancels and messages for monitoring.
+	input --
+		adminUid: user id of the requester, MUST BE an admin account
+		uid: user id of the account, empty for every account which has sent a message
+	output --
+		the statistics of the accounts, sorted by uid
+		err:
+		if adminUid is not an admin account, an error message will be returned
+		if database fails to retrieve the statistics, an error message will be returned
+*/
+func QueryRateStats(store storage.Storage, adminUid string, uid string) ([]RateStatsTuple, error) {
+	conn := store.Get()
+	defer conn.Close()
+
+	isAdmin, err := checkAdminAccount(conn, adminUid)
+	if err != nil {
+		return []RateStatsTuple{}, fmt.Errorf("database error when checking admin account")
+	}
+	if !isAdmin {
+		return []RateStatsTuple{}, fmt.Errorf("permission denied")
+	}
+
+	uids := []string{uid}
+	if uid == "" {
+		uids, err = getRateStatsAccounts(conn)
+		if err != nil {
+			return []RateStatsTuple{}, fmt.Errorf("database error when retrieving the rate limit statistics")
+		}
+		sort.Strings(uids)
+	}
+
+	var statsList []RateStatsTuple
+	for _, statsUid := range uids {
+		stats, err := getRateStats(conn, statsUid)
+		if err != nil {
+			return []RateStatsTuple{}, fmt.Errorf("database error when retrieving the rate limit statistics")
+		}
+		statsList = append(statsList, stats)
+	}
+	return statsList, nil
+}
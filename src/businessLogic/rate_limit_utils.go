@@ -0,0 +1,141 @@
+package businessLogic
+
+import (
+	"app/storage"
+	"strconv"
+)
+
+const (
+	DB_RATE_LIMIT_PREFIX          = "rateLimit:"
+	DB_RATE_COUNTER_PREFIX        = "rateCounter:"
+	DB_RATE_STATS_PREFIX          = "rateStats:"
+	DB_RATE_STATS_ACCOUNTS        = "rateStatsAccounts"
+	DB_RATE_STATS_FIELD_ACCEPTED  = ":accepted"
+	DB_RATE_STATS_FIELD_THROTTLED = ":throttled"
+	DB_RATE_COUNTER_TTL_SECONDS   = 2
+)
+
+/*
+		Get the limit of an account for a kind of message, the default limit is returned if the account has no limit of its own.
+	input --
+		uid: user id, no restriction on the length and characters
+		kind: orders/cancels/messages
+		defaultLimit: the limit used if the account has no limit of its own
+	err --
+		from HMGet, Atoi
+*/
+func getRateLimit(conn storage.Conn, uid string, kind string, defaultLimit int) (int, error) {
+	values, err := conn.HMGet(DB_RATE_LIMIT_PREFIX+uid, []string{kind})
+	if err != nil {
+		return 0, err
+	}
+	if values[0] == "" {
+		return defaultLimit, nil
+	}
+	return strconv.Atoi(values[0])
+}
+
+/*
+		Set the limits of an account, a negative limit removes the account's own limit of that kind.
+	input --
+		uid: user id, no restriction on the length and characters
+		limits: kind(orders/cancels/messages) to limit
+	err --
+		from HSet, HDel
+*/
+func setRateLimits(conn storage.Conn, uid string, limits map[string]int) error {
+	for kind, limit := range limits {
+		var err error
+		if limit < 0 {
+			err = conn.HDel(DB_RATE_LIMIT_PREFIX+uid, kind)
+		} else {
+			err = conn.HSet(DB_RATE_LIMIT_PREFIX+uid, kind, limit)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+		Count messages of a kind sent by an account in the current second.
+		The counter is forgotten after DB_RATE_COUNTER_TTL_SECONDS.
+	input --
+		uid: user id, no restriction on the length and characters
+		kind: orders/cancels
+		second: unix epoch of the current second
+	output --
+		the number of messages of the kind in the second, including this one
+	err --
+		from Incr, Expire
+*/
+func incrRateCounter(conn storage.Conn, uid string, kind string, second int64) (int, error) {
+	key := DB_RATE_COUNTER_PREFIX + uid + ":" + kind + ":" + strconv.FormatInt(second, 10)
+	count, err := conn.Incr(key)
+	if err != nil {
+		return 0, err
+	}
+	if count == 1 {
+		err = conn.Expire(key, DB_RATE_COUNTER_TTL_SECONDS)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return count, nil
+}
+
+/*
+		Add accepted and throttled messages of a kind to the statistics of an account.
+	input --
+		uid: user id, no restriction on the length and characters
+		kind: orders/cancels/messages
+	err --
+		from HIncrBy, SAdd
+*/
+func addRateStats(conn storage.Conn, uid string, kind string, accepted int, throttled int) error {
+	_, err := conn.HIncrBy(DB_RATE_STATS_PREFIX+uid, kind+DB_RATE_STATS_FIELD_ACCEPTED, accepted)
+	if err != nil {
+		return err
+	}
+	_, err = conn.HIncrBy(DB_RATE_STATS_PREFIX+uid, kind+DB_RATE_STATS_FIELD_THROTTLED, throttled)
+	if err != nil {
+		return err
+	}
+	return conn.SAdd(DB_RATE_STATS_ACCOUNTS, uid)
+}
+
+/*
+		Get the accepted and throttled counts of every kind of an account.
+		An account without statistics has all counts 0.
+	input --
+		uid: user id, no restriction on the length and characters
+	err --
+		from HMGet
+*/
+func getRateStats(conn storage.Conn, uid string) (RateStatsTuple, error) {
+	var fields []string
+	for _, kind := range RATE_LIMIT_KINDS {
+		fields = append(fields, kind+DB_RATE_STATS_FIELD_ACCEPTED, kind+DB_RATE_STATS_FIELD_THROTTLED)
+	}
+	values, err := conn.HMGet(DB_RATE_STATS_PREFIX+uid, fields)
+	if err != nil {
+		return RateStatsTuple{}, err
+	}
+
+	stats := RateStatsTuple{Uid: uid, Accepted: map[string]string{}, Throttled: map[string]string{}}
+	for i, kind := range RATE_LIMIT_KINDS {
+		stats.Accepted[kind] = zeroIfEmpty(values[i*2])
+		stats.Throttled[kind] = zeroIfEmpty(values[i*2+1])
+	}
+	return stats, nil
+}
+
+/*
+		Get every account with rate limit statistics.
+	err --
+		from SMembers
+*/
+func getRateStatsAccounts(conn storage.Conn) ([]string, error) {
+	return conn.SMembers(DB_RATE_STATS_ACCOUNTS)
+}
@@ -0,0 +1,220 @@
+package businessLogic
+
+import (
+	"app/storage"
+	"fmt"
+	"math"
+	"sort"
+)
+
+const (
+	RECONCILIATION_ISSUE_IMBALANCE          = "imbalance"
+	RECONCILIATION_ISSUE_RESERVED_MISMATCH  = "reservedMismatch"
+	RECONCILIATION_ISSUE_BOOK_WITHOUT_ORDER = "bookEntryWithoutOrder"
+	RECONCILIATION_ISSUE_ORDER_WITHOUT_BOOK = "orderWithoutBookEntry"
+)
+
+type AssetReconciliationTuple struct {
+	Asset       string
+	Available   string
+	Reserved    string
+	NetDeposits string
+	Difference  string
+}
+
+type ReconciliationIssueTuple struct {
+	Kind   string
+	Id     string
+	Detail string
+}
+
+/*
+		Reconcile checks that no cash or symbol has been created or destroyed, eg: by a crash in the middle of a match.
+		For every asset(cash or a symbol), the available amount of all accounts plus the amount held by all open orders
+		should equal the net deposits(deposits minus withdrawals) posted to the journal.
+		It also checks that every account's reserved amount equals the amount held by its open orders,
+		that every order book entry has an open order, and that every open order is in its order book.
+		No data is changed.
+	input --
+		adminUid: user id of the requester, MUST BE an admin account
+	output --
+		the reconciliation of every asset sorted by asset, and the issues found sorted by kind and id(empty if everything reconciles)
+		err:
+		if adminUid is not an admin account, an error message will be returned
+		if database fails to retrieve accounts, orders, order books or the journal, an error message will be returned
+*/
+func Reconcile(store storage.Storage, adminUid string) ([]AssetReconciliationTuple, []ReconciliationIssueTuple, error) {
+	conn := store.Get()
+	defer conn.Close()
+
+	isAdmin, err := checkAdminAccount(conn, adminUid)
+	if err != nil {
+		return []AssetReconciliationTuple{}, []ReconciliationIssueTuple{}, fmt.Errorf("database error when checking admin account")
+	}
+	if !isAdmin {
+		return []AssetReconciliationTuple{}, []ReconciliationIssueTuple{}, fmt.Errorf("permission denied")
+	}
+
+	var issues []ReconciliationIssueTuple
+
+	// amounts held by open orders, per account and per asset
+	orderBooks, err := scanOrderBooks(conn)
+	if err != nil {
+		return []AssetReconciliationTuple{}, []ReconciliationIssueTuple{}, fmt.Errorf("database error when retrieving the order books")
+	}
+	inOrderBook := make(map[string]bool)
+	for orderBookKey, orderIds := range orderBooks {
+		for _, orderId := range orderIds {
+			inOrderBook[orderId] = true
+
+			var exists bool
+			exists, err = checkOrderExists(conn, orderId)
+			if err != nil {
+				return []AssetReconciliationTuple{}, []ReconciliationIssueTuple{}, fmt.Errorf("database error when retrieving the open orders")
+			}
+			if !exists {
+				issues = append(issues, ReconciliationIssueTuple{
+					Kind:   RECONCILIATION_ISSUE_BOOK_WITHOUT_ORDER,
+					Id:     orderId,
+					Detail: fmt.Sprintf("order is in %s but has no order", orderBookKey),
+				})
+			}
+		}
+	}
+
+	orderIds, err := scanOpenOrderIds(conn)
+	if err != nil {
+		return []AssetReconciliationTuple{}, []ReconciliationIssueTuple{}, fmt.Errorf("database error when retrieving the open orders")
+	}
+	reservedByOrders := make(map[string]map[string]float64)
+	totalReserved := make(map[string]float64)
+	for _, orderId := range orderIds {
+		var restingOrder RestingOrderTuple
+		restingOrder, err = getRestingOrder(conn, orderId)
+		if err != nil {
+			return []AssetReconciliationTuple{}, []ReconciliationIssueTuple{}, fmt.Errorf("database error when retrieving the open orders")
+		}
+		var symbolName_n_orderType []string
+		symbolName_n_orderType, err = GetSymbolNameAndOrderType(conn, orderId)
+		if err != nil {
+			return []AssetReconciliationTuple{}, []ReconciliationIssueTuple{}, fmt.Errorf("database error when retrieving the open orders")
+		}
+
+		if !inOrderBook[orderId] {
+			issues = append(issues, ReconciliationIssueTuple{
+				Kind:   RECONCILIATION_ISSUE_ORDER_WITHOUT_BOOK,
+				Id:     orderId,
+				Detail: fmt.Sprintf("open %s order of %s is not in its order book", restingOrder.OrderType, symbolName_n_orderType[0]),
+			})
+		}
+
+		asset, amount, Err_in_parse := getOpenOrderReservation(restingOrder, symbolName_n_orderType[0])
+		if Err_in_parse != nil {
+			return []AssetReconciliationTuple{}, []ReconciliationIssueTuple{}, fmt.Errorf("database error when retrieving the open orders")
+		}
+		if reservedByOrders[restingOrder.Uid] == nil {
+			reservedByOrders[restingOrder.Uid] = make(map[string]float64)
+		}
+		reservedByOrders[restingOrder.Uid][asset] += amount
+		totalReserved[asset] += amount
+	}
+
+	// amounts held by accounts
+	uids, err := scanAccountUids(conn)
+	if err != nil {
+		return []AssetReconciliationTuple{}, []ReconciliationIssueTuple{}, fmt.Errorf("database error when retrieving the accounts")
+	}
+	sort.Strings(uids)
+	totalAvailable := make(map[string]float64)
+	for _, uid := range uids {
+		reserved := make(map[string]float64)
+
+		var balance, reservedBalance float64
+		balance, reservedBalance, err = getAccountBalanceAndReservedBalance(conn, uid)
+		if err != nil {
+			return []AssetReconciliationTuple{}, []ReconciliationIssueTuple{}, fmt.Errorf("database error when retrieving the accounts")
+		}
+		totalAvailable[JOURNAL_ASSET_CASH] += balance
+		reserved[JOURNAL_ASSET_CASH] = reservedBalance
+
+		var symbolNames []string
+		symbolNames, err = getAccountSymbols(conn, uid)
+		if err != nil {
+			return []AssetReconciliationTuple{}, []ReconciliationIssueTuple{}, fmt.Errorf("database error when retrieving the accounts")
+		}
+		for _, symbolName := range symbolNames {
+			var amount, reservedAmount float64
+			amount, reservedAmount, err = getSymbolPositionAndReservedSymbolPosition(conn, uid, symbolName)
+			if err != nil {
+				return []AssetReconciliationTuple{}, []ReconciliationIssueTuple{}, fmt.Errorf("database error when retrieving the accounts")
+			}
+			totalAvailable[symbolName] += amount
+			reserved[symbolName] = reservedAmount
+		}
+
+		for asset := range reservedByOrders[uid] {
+			if _, ok := reserved[asset]; !ok {
+				reserved[asset] = 0
+			}
+		}
+		for asset, reservedAmount := range reserved {
+			if math.Abs(reservedAmount-reservedByOrders[uid][asset]) > RECONCILIATION_TOLERANCE {
+				issues = append(issues, ReconciliationIssueTuple{
+					Kind:   RECONCILIATION_ISSUE_RESERVED_MISMATCH,
+					Id:     uid,
+					Detail: fmt.Sprintf("%s reserved %f but open orders hold %f", asset, reservedAmount, reservedByOrders[uid][asset]),
+				})
+			}
+		}
+	}
+
+	// compare against the journal
+	netDeposits, err := getNetDepositsFromJournal(conn)
+	if err != nil {
+		return []AssetReconciliationTuple{}, []ReconciliationIssueTuple{}, fmt.Errorf("database error when retrieving the journal")
+	}
+
+	assetSet := make(map[string]bool)
+	for asset := range totalAvailable {
+		assetSet[asset] = true
+	}
+	for asset := range totalReserved {
+		assetSet[asset] = true
+	}
+	for asset := range netDeposits {
+		assetSet[asset] = true
+	}
+	var assets []string
+	for asset := range assetSet {
+		assets = append(assets, asset)
+	}
+	sort.Strings(assets)
+
+	var assetReconciliations []AssetReconciliationTuple
+	for _, asset := range assets {
+		difference := totalAvailable[asset] + totalReserved[asset] - netDeposits[asset]
+		assetReconciliations = append(assetReconciliations, AssetReconciliationTuple{
+			Asset:       asset,
+			Available:   fmt.Sprintf("%f", totalAvailable[asset]),
+			Reserved:    fmt.Sprintf("%f", totalReserved[asset]),
+			NetDeposits: fmt.Sprintf("%f", netDeposits[asset]),
+			Difference:  fmt.Sprintf("%f", difference),
+		})
+		if math.Abs(difference) > RECONCILIATION_TOLERANCE {
+			issues = append(issues, ReconciliationIssueTuple{
+				Kind:   RECONCILIATION_ISSUE_IMBALANCE,
+				Id:     asset,
+				Detail: fmt.Sprintf("accounts and open orders hold %f but net deposits are %f", totalAvailable[asset]+totalReserved[asset], netDeposits[asset]),
+			})
+		}
+	}
+
+	sort.Slice(issues, func(i, j int) bool {
+		if issues[i].Kind != issues[j].Kind {
+			return issues[i].Kind < issues[j].Kind
+		}
+		return issues[i].Id < issues[j].Id
+	})
+
+	return assetReconciliations, issues, nil
+}
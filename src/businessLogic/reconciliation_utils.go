@@ -0,0 +1,132 @@
+package businessLogic
+
+import (
+	"app/storage"
+	"strconv"
+	"strings"
+)
+
+const (
+	RECONCILIATION_TOLERANCE = 1e-6
+)
+
+/*
+		Get the user ids of all accounts, found by scanning account hashes.
+		Symbol position hashes share the account prefix and are skipped.
+	err --
+		from Scan
+*/
+func scanAccountUids(conn storage.Conn) ([]string, error) {
+	keys, err := conn.Scan(DB_ACCOUNT_PREFIX+"*")
+	if err != nil {
+		return []string{}, err
+	}
+
+	var uids []string
+	for _, key := range keys {
+		uid := strings.TrimPrefix(key, DB_ACCOUNT_PREFIX)
+		if isBase10NumberSequense(uid) {
+			uids = append(uids, uid)
+		}
+	}
+	return uids, nil
+}
+
+/*
+		Get the ids of all open orders, found by scanning order hashes.
+	err --
+		from Scan
+*/
+func scanOpenOrderIds(conn storage.Conn) ([]string, error) {
+	keys, err := conn.Scan(DB_ORDER_PREFIX+"*")
+	if err != nil {
+		return []string{}, err
+	}
+
+	var orderIds []string
+	for _, key := range keys {
+		orderIds = append(orderIds, strings.TrimPrefix(key, DB_ORDER_PREFIX))
+	}
+	return orderIds, nil
+}
+
+/*
+		Get the order ids in every buy and sell order book, grouped by the order book key.
+	output --
+		order book key --> order ids in the order book
+	err --
+		from Scan, ZRange
+*/
+func scanOrderBooks(conn storage.Conn) (map[string][]string, error) {
+	orderBooks := make(map[string][]string)
+	for _, prefix := range []string{DB_BUY_ORDER_BOOK_PREFIX, DB_SELL_ORDER_BOOK_PREFIX} {
+		keys, err := conn.Scan(prefix+"*")
+		if err != nil {
+			return map[string][]string{}, err
+		}
+
+		for _, key := range keys {
+			var orderIds []string
+			orderIds, err = conn.ZRange(key, 0, -1, false)
+			if err != nil {
+				return map[string][]string{}, err
+			}
+			orderBooks[key] = orderIds
+		}
+	}
+	return orderBooks, nil
+}
+
+/*
+		Get the net amount of every asset deposited into the exchange, deposits minus withdrawals.
+		It is the negated journal balance of the external ledger account.
+	output --
+		asset --> net deposits
+	err --
+		from Scan, HExists, HGet, strconv.ParseFloat
+*/
+func getNetDepositsFromJournal(conn storage.Conn) (map[string]float64, error) {
+	keys, err := conn.Scan(DB_JOURNAL_BALANCES_PREFIX+"*")
+	if err != nil {
+		return map[string]float64{}, err
+	}
+
+	netDeposits := make(map[string]float64)
+	for _, key := range keys {
+		asset := strings.TrimPrefix(key, DB_JOURNAL_BALANCES_PREFIX)
+		var external float64
+		external, err = getJournalBalance(conn, asset, JOURNAL_LEDGER_ACCOUNT_EXTERNAL)
+		if err != nil {
+			return map[string]float64{}, err
+		}
+		netDeposits[asset] = -external
+	}
+	return netDeposits, nil
+}
+
+/*
+		Compute the amount of cash or symbol an open order holds: limit price * amount of cash for a buy order, amount of symbol for a sell order.
+	input --
+		restingOrder: the open order
+		symbolName: the symbol of the open order
+	output --
+		the asset and the amount held
+	err --
+		from strconv.ParseFloat
+*/
+func getOpenOrderReservation(restingOrder RestingOrderTuple, symbolName string) (string, float64, error) {
+	amount, err := strconv.ParseFloat(restingOrder.CurrentAmount, 64)
+	if err != nil {
+		return "", 0, err
+	}
+	if restingOrder.OrderType == ORDER_TYPE_SELL {
+		return symbolName, amount, nil
+	}
+
+	var limitPrice float64
+	limitPrice, err = strconv.ParseFloat(restingOrder.LimitPrice, 64)
+	if err != nil {
+		return "", 0, err
+	}
+	return JOURNAL_ASSET_CASH, limitPrice * amount, nil
+}
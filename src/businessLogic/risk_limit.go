@@ -0,0 +1,167 @@
+package businessLogic
+
+import (
+	"app/storage"
+	"fmt"
+	"math"
+)
+
+// 0 means no limit
+type RiskLimitTuple struct {
+	MaxOrderAmount   float64
+	MaxOrderNotional float64
+	MaxOpenOrders    int
+	MaxGrossPosition float64
+	MaxNetPosition   float64
+}
+
+/*
+		checkPreTradeRisk returns an error naming the breached limit if a new order would break a risk limit.
+		The limits of the account, of the symbol and of the account in the symbol are all checked, so the tightest one applies.
+		Open orders are counted in the whole account for the account limits, and in the symbol for the other limits.
+		Positions are checked as if every open order of the account in the symbol and the new order were filled:
+		the gross position is the available amount plus every open buy and sell amount, the reserved amount is not added
+		since it is the amount of the open sell orders, and the amount of a new sell is taken out of the available amount
+		since it is not reserved yet,
+		the net position is the largest of the held amount plus the open buy amount and the held amount minus the open sell amount.
+		It should be called while holding the write lock, so the order is entered with the exposure it was checked against.
+*/
+func checkPreTradeRisk(conn storage.Conn, uid string, symbolName string, orderType string, limitPrice float64, amount float64) error {
+	accountOpenOrders, symbolOpenOrders, openBuyAmount, openSellAmount, err := getAccountOpenOrderExposure(conn, uid, symbolName)
+	if err != nil {
+		return fmt.Errorf("database error when retrieving open orders for risk checks")
+	}
+
+	var held, reserved float64
+	held, reserved, err = getSymbolPositionAndReservedSymbolPosition(conn, uid, symbolName)
+	if err != nil {
+		return fmt.Errorf("database error when retrieving the symbol position for risk checks")
+	}
+	available := held
+	held += reserved
+
+	if orderType == ORDER_TYPE_BUY {
+		openBuyAmount += amount
+	} else {
+		available -= amount
+		openSellAmount += amount
+	}
+	grossPosition := available + openBuyAmount + openSellAmount
+	netPosition := math.Max(math.Abs(held+openBuyAmount), math.Abs(held-openSellAmount))
+	notional := limitPrice * amount
+
+	for _, scope := range [][]string{{uid, ""}, {"", symbolName}, {uid, symbolName}} {
+		limits, err := getRiskLimits(conn, scope[0], scope[1])
+		if err != nil {
+			return fmt.Errorf("database error when retrieving risk limits")
+		}
+
+		openOrders := symbolOpenOrders
+		if scope[1] == "" {
+			openOrders = accountOpenOrders
+		}
+
+		if limits.MaxOrderAmount > 0 && amount > limits.MaxOrderAmount {
+			return fmt.Errorf("risk reject: max order amount %s exceeded", formatPriceLevel(limits.MaxOrderAmount))
+		}
+		if limits.MaxOrderNotional > 0 && notional > limits.MaxOrderNotional {
+			return fmt.Errorf("risk reject: max order notional %s exceeded", formatPriceLevel(limits.MaxOrderNotional))
+		}
+		if limits.MaxOpenOrders > 0 && openOrders >= limits.MaxOpenOrders {
+			return fmt.Errorf("risk reject: max open orders %d reached", limits.MaxOpenOrders)
+		}
+		if limits.MaxGrossPosition > 0 && grossPosition > limits.MaxGrossPosition {
+			return fmt.Errorf("risk reject: max gross position %s exceeded", formatPriceLevel(limits.MaxGrossPosition))
+		}
+		if limits.MaxNetPosition > 0 && netPosition > limits.MaxNetPosition {
+			return fmt.Errorf("risk reject: max net position %s exceeded", formatPriceLevel(limits.MaxNetPosition))
+		}
+	}
+	return nil
+}
+
+/*
+		SetRiskLimits sets the pre-trade risk limits of an account, a symbol, or an account in a symbol.
+		The limits of a symbol apply to every account trading the symbol.
+	input --
+		adminUid: user id of the requester, MUST BE an admin account
+		uid: user id of the account, empty for the limits of a symbol
+		symbolName: symbol name, empty for the limits of an account
+		limits: the risk limits, should be non-negative, 0 means no limit
+	output --
+		err:
+		if adminUid is not an admin account, an error message will be returned
+		if both uid and symbolName are empty, or uid does not exist, an error message will be returned
+		if a limit is negative, an error message will be returned
+		if database fails to store the limits, an error message will be returned
+*/
+func SetRiskLimits(store storage.Storage, adminUid string, uid string, symbolName string, limits RiskLimitTuple) error {
+	if uid == "" && symbolName == "" {
+		return fmt.Errorf("account or symbol is required")
+	}
+	if limits.MaxOrderAmount < 0 || limits.MaxOrderNotional < 0 || limits.MaxOpenOrders < 0 ||
+		limits.MaxGrossPosition < 0 || limits.MaxNetPosition < 0 {
+		return fmt.Errorf("invalid risk limit")
+	}
+
+	conn := store.Get()
+	defer conn.Close()
+
+	isAdmin, err := checkAdminAccount(conn, adminUid)
+	if err != nil {
+		return fmt.Errorf("database error when checking admin account")
+	}
+	if !isAdmin {
+		return fmt.Errorf("permission denied")
+	}
+
+	if uid != "" {
+		exists, err := checkAccountExists(conn, uid)
+		if err != nil || !exists {
+			return fmt.Errorf("user doesn't exist")
+		}
+	}
+
+	err = setRiskLimits(conn, uid, symbolName, limits)
+	if err != nil {
+		return fmt.Errorf("database error when storing the risk limits")
+	}
+	return nil
+}
+
+/*
+		QueryRiskLimits returns the pre-trade risk limits of an account, a symbol, or an account in a symbol.
+	input --
+		adminUid: user id of the requester, MUST BE an admin account
+		uid: user id of the account, empty for the limits of a symbol
+		symbolName: symbol name, empty for the limits of an account
+	output --
+		the risk limits, 0 means no limit
+		err:
+		if adminUid is not an admin account, an error message will be returned
+		if both uid and symbolName are empty, an error message will be returned
+		if database fails to retrieve the limits, an error message will be returned
+*/
+func QueryRiskLimits(store storage.Storage, adminUid string, uid string, symbolName string) (RiskLimitTuple, error) {
+	if uid == "" && symbolName == "" {
+		return RiskLimitTuple{}, fmt.Errorf("account or symbol is required")
+	}
+
+	conn := store.Get()
+	defer conn.Close()
+
+	isAdmin, err := checkAdminAccount(conn, adminUid)
+	if err != nil {
+		return RiskLimitTuple{}, fmt.Errorf("database error when checking admin account")
+	}
+	if !isAdmin {
+		return RiskLimitTuple{}, fmt.Errorf("permission denied")
+	}
+
+	var limits RiskLimitTuple
+	limits, err = getRiskLimits(conn, uid, symbolName)
+	if err != nil {
+		return RiskLimitTuple{}, fmt.Errorf("database error when retrieving the risk limits")
+	}
+	return limits, nil
+}
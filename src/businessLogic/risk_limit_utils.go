@@ -0,0 +1,122 @@
+package businessLogic
+
+import (
+	"app/storage"
+)
+
+const (
+	DB_RISK_LIMIT_PREFIX                   = "riskLimit:"
+	DB_RISK_LIMIT_FIELD_MAX_ORDER_AMOUNT   = "maxOrderAmount"
+	DB_RISK_LIMIT_FIELD_MAX_ORDER_NOTIONAL = "maxOrderNotional"
+	DB_RISK_LIMIT_FIELD_MAX_OPEN_ORDERS    = "maxOpenOrders"
+	DB_RISK_LIMIT_FIELD_MAX_GROSS_POSITION = "maxGrossPosition"
+	DB_RISK_LIMIT_FIELD_MAX_NET_POSITION   = "maxNetPosition"
+)
+
+// the key of the risk limits of an account, a symbol, or an account in a symbol
+func riskLimitKey(uid string, symbolName string) string {
+	if symbolName == "" {
+		return DB_RISK_LIMIT_PREFIX + "account:" + uid
+	}
+	if uid == "" {
+		return DB_RISK_LIMIT_PREFIX + "symbol:" + symbolName
+	}
+	return DB_RISK_LIMIT_PREFIX + "account:" + uid + ":symbol:" + symbolName
+}
+
+/*
+		Store the risk limits of an account, a symbol, or an account in a symbol. The old limits are REPLACED.
+	input --
+		uid: user id, empty for the limits of a symbol
+		symbolName: symbol name, empty for the limits of an account
+		limits: the risk limits, 0 means no limit
+	err --
+		from HMSet
+*/
+func setRiskLimits(conn storage.Conn, uid string, symbolName string, limits RiskLimitTuple) error {
+	return conn.HMSet(riskLimitKey(uid, symbolName), map[string]interface{}{
+		DB_RISK_LIMIT_FIELD_MAX_ORDER_AMOUNT:   limits.MaxOrderAmount,
+		DB_RISK_LIMIT_FIELD_MAX_ORDER_NOTIONAL: limits.MaxOrderNotional,
+		DB_RISK_LIMIT_FIELD_MAX_OPEN_ORDERS:    limits.MaxOpenOrders,
+		DB_RISK_LIMIT_FIELD_MAX_GROSS_POSITION: limits.MaxGrossPosition,
+		DB_RISK_LIMIT_FIELD_MAX_NET_POSITION:   limits.MaxNetPosition})
+}
+
+/*
+		Get the risk limits of an account, a symbol, or an account in a symbol.
+		If no limit is stored, every limit is 0(no limit).
+	input --
+		uid: user id, empty for the limits of a symbol
+		symbolName: symbol name, empty for the limits of an account
+	err --
+		from HMGet, from strconv.ParseFloat
+*/
+func getRiskLimits(conn storage.Conn, uid string, symbolName string) (RiskLimitTuple, error) {
+	values, err := conn.HMGet(riskLimitKey(uid, symbolName), []string{
+		DB_RISK_LIMIT_FIELD_MAX_ORDER_AMOUNT,
+		DB_RISK_LIMIT_FIELD_MAX_ORDER_NOTIONAL,
+		DB_RISK_LIMIT_FIELD_MAX_OPEN_ORDERS,
+		DB_RISK_LIMIT_FIELD_MAX_GROSS_POSITION,
+		DB_RISK_LIMIT_FIELD_MAX_NET_POSITION})
+	if err != nil {
+		return RiskLimitTuple{}, err
+	}
+
+	var parsed [5]float64
+	for i, value := range values {
+		parsed[i], err = parseFloatOrZero(value)
+		if err != nil {
+			return RiskLimitTuple{}, err
+		}
+	}
+
+	return RiskLimitTuple{
+		MaxOrderAmount:   parsed[0],
+		MaxOrderNotional: parsed[1],
+		MaxOpenOrders:    int(parsed[2]),
+		MaxGrossPosition: parsed[3],
+		MaxNetPosition:   parsed[4]}, nil
+}
+
+/*
+		Get the number of open orders of an account, and the open amounts of its buy and sell orders for a symbol.
+	input --
+		uid: user id, no restriction on the length and characters
+		symbolName: symbol name, no restriction on the length and characters
+	output --
+		the number of open orders of the account in every symbol, the number of open orders in symbolName,
+		the open buy amount and the open sell amount in symbolName
+	err --
+		from SMembers, HMGet, from strconv.ParseFloat
+*/
+func getAccountOpenOrderExposure(conn storage.Conn, uid string, symbolName string) (int, int, float64, float64, error) {
+	openOrderIds, err := getAccountOpenOrderIds(conn, uid)
+	if err != nil {
+		return 0, 0, 0, 0, err
+	}
+
+	symbolOpenOrders := 0
+	var openBuyAmount, openSellAmount float64
+	for _, orderId := range openOrderIds {
+		symbolName_n_orderType, err := GetSymbolNameAndOrderType(conn, orderId)
+		if err != nil {
+			return 0, 0, 0, 0, err
+		}
+		if symbolName_n_orderType[0] != symbolName {
+			continue
+		}
+		symbolOpenOrders++
+
+		amount, err := GetOrderAmount(conn, orderId)
+		if err != nil {
+			return 0, 0, 0, 0, err
+		}
+		if symbolName_n_orderType[1] == ORDER_TYPE_BUY {
+			openBuyAmount += amount
+		} else {
+			openSellAmount += amount
+		}
+	}
+
+	return len(openOrderIds), symbolOpenOrders, openBuyAmount, openSellAmount, nil
+}
@@ -0,0 +1,70 @@
+package businessLogic
+
+import (
+	"app/storage"
+	"fmt"
+)
+
+// SCHEMA_VERSION is the layout of the data this engine reads and writes, recorded in the database with the data
+const SCHEMA_VERSION = 1
+
+/*
+		schemaMigrations[v] migrates the data from version v to version v+1, in one transaction with the new version.
+		Add a migration and increase SCHEMA_VERSION whenever the layout of existing keys changes.
+*/
+var schemaMigrations = []func(conn storage.Conn) error{
+	// 0 -> 1: the data written before the version was recorded already has the layout of version 1
+	func(conn storage.Conn) error { return nil },
+}
+
+/*
+		MigrateSchema checks the schema version of the data in the database at startup,
+		and migrates the data of an older version, one version at a time, up to SCHEMA_VERSION.
+		An empty database is marked with SCHEMA_VERSION.
+	output --
+		the version the database had, SCHEMA_VERSION if it was empty
+	err --
+		the database has a newer version than this engine, a migration fails
+*/
+func MigrateSchema(store storage.Storage) (int, error) {
+	conn := store.Get()
+	defer conn.Close()
+
+	version, err := getSchemaVersion(conn)
+	if err != nil {
+		return 0, fmt.Errorf("database error when getting the schema version")
+	}
+	if version > SCHEMA_VERSION {
+		return version, fmt.Errorf("the database has schema version %d, this engine supports up to %d", version, SCHEMA_VERSION)
+	}
+
+	if version == 0 {
+		var empty bool
+		empty, err = databaseIsEmpty(conn)
+		if err != nil {
+			return 0, fmt.Errorf("database error when checking if the database is empty")
+		}
+		if empty {
+			err = setSchemaVersion(conn, SCHEMA_VERSION)
+			if err != nil {
+				return 0, fmt.Errorf("database error when setting the schema version")
+			}
+			return SCHEMA_VERSION, nil
+		}
+	}
+
+	for from := version; from < SCHEMA_VERSION; from++ {
+		migration := schemaMigrations[from]
+		err = runAtomically(conn, func(conn storage.Conn) error {
+			err := migration(conn)
+			if err != nil {
+				return err
+			}
+			return setSchemaVersion(conn, from+1)
+		})
+		if err != nil {
+			return version, fmt.Errorf("migration of the schema from version %d to %d failed: %s", from, from+1, err)
+		}
+	}
+	return version, nil
+}
@@ -0,0 +1,50 @@
+package businessLogic
+
+import (
+	"app/storage"
+	"strconv"
+)
+
+const (
+	DB_KEY_FOR_SCHEMA_VERSION = "schemaVersion"
+)
+
+/*
+		Get the schema version of the data in the database.
+	output --
+		the version, 0 if no version is recorded
+	err --
+		from Get, the version is not a number
+*/
+func getSchemaVersion(conn storage.Conn) (int, error) {
+	version, err := conn.Get(DB_KEY_FOR_SCHEMA_VERSION)
+	if err == storage.ErrNil {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(version)
+}
+
+/*
+		Record the schema version of the data in the database.
+	err --
+		from Set
+*/
+func setSchemaVersion(conn storage.Conn, version int) error {
+	return conn.Set(DB_KEY_FOR_SCHEMA_VERSION, strconv.Itoa(version))
+}
+
+/*
+		Check if the database has no key at all, eg: a new deployment.
+	err --
+		from Scan
+*/
+func databaseIsEmpty(conn storage.Conn) (bool, error) {
+	keys, err := conn.Scan("*")
+	if err != nil {
+		return false, err
+	}
+	return len(keys) == 0, nil
+}
@@ -0,0 +1,229 @@
+package businessLogic
+
+import (
+	"app/storage"
+	"app/uniqueKeyGenerator"
+	"fmt"
+	"strconv"
+)
+
+type TransferTuple struct {
+	TransferId string
+	AdminUid   string
+	FromUid    string
+	ToUid      string
+	Asset      string
+	Amount     string
+	Reason     string
+	Time       string
+}
+
+/*
+		Transfer moves cash or a symbol position from an account to another account.
+		Only the available amount can be moved, amounts reserved by open orders can not.
+		The transfer is recorded in the transfer audit log and posted to the journal,
+		a cash transfer is also recorded in the cash ledger of both accounts.
+	input --
+		adminUid: user id of the requester, MUST BE an admin account
+		fromUid: user id of the account the asset is moved out
+		toUid: user id of the account the asset is moved in, should not be fromUid
+		symbolName: the symbol to move, empty to move cash
+		amount: should be positive(> 0)
+		reason: why the asset is moved, can be empty
+	output --
+		the recorded transfer tuple
+		err:
+		if adminUid is not an admin account, an error message will be returned
+		if fromUid or toUid does not exist, an error message will be returned
+		if fromUid is frozen or closed, or toUid is closed, an error message will be returned
+		if amount or toUid does not meet input restriction, or symbolName is "cash", an error message will be returned
+		if the available amount of fromUid is insufficient, an error message will be returned
+		if database fails to move the asset or record the transfer, an error message will be returned
+*/
+func Transfer(store storage.Storage, adminUid string, fromUid string, toUid string, symbolName string, amount float64, reason string) (TransferTuple, error) {
+	if amount <= 0 {
+		return TransferTuple{}, fmt.Errorf("invalid amount")
+	}
+	if fromUid == toUid {
+		return TransferTuple{}, fmt.Errorf("cannot transfer to the same account")
+	}
+	if symbolName != "" {
+		err := checkSymbolName(symbolName)
+		if err != nil {
+			return TransferTuple{}, err
+		}
+	}
+
+	conn := store.Get()
+	defer conn.Close()
+
+	isAdmin, err := checkAdminAccount(conn, adminUid)
+	if err != nil {
+		return TransferTuple{}, fmt.Errorf("database error when checking admin account")
+	}
+	if !isAdmin {
+		return TransferTuple{}, fmt.Errorf("permission denied")
+	}
+
+	var exists bool
+	exists, err = checkAccountExists(conn, fromUid)
+	if err != nil || !exists {
+		return TransferTuple{}, fmt.Errorf("user %s doesn't exist", fromUid)
+	}
+	exists, err = checkAccountExists(conn, toUid)
+	if err != nil || !exists {
+		return TransferTuple{}, fmt.Errorf("user %s doesn't exist", toUid)
+	}
+	err = checkAccountIsActive(conn, fromUid)
+	if err != nil {
+		return TransferTuple{}, fmt.Errorf("user %s: %s", fromUid, err)
+	}
+	err = checkAccountIsNotClosed(conn, toUid)
+	if err != nil {
+		return TransferTuple{}, fmt.Errorf("user %s: %s", toUid, err)
+	}
+
+	asset := JOURNAL_ASSET_CASH
+	if symbolName != "" {
+		asset = symbolName
+	}
+
+	// check the available amount before moving anything
+	if symbolName == "" {
+		var balance float64
+		balance, err = GetAccountBalance(conn, fromUid)
+		if err != nil {
+			return TransferTuple{}, fmt.Errorf("database error when retrieving the balance")
+		}
+		if balance < amount {
+			return TransferTuple{}, fmt.Errorf("insufficient funds")
+		}
+	} else {
+		exists, err = checkSymbolPositionExists(conn, fromUid, symbolName)
+		if err != nil || !exists {
+			return TransferTuple{}, fmt.Errorf("symbol position doesn't exist under this account")
+		}
+		var position float64
+		position, err = GetSymbolPosition(conn, fromUid, symbolName)
+		if err != nil || position < amount {
+			return TransferTuple{}, fmt.Errorf("insufficient symbols")
+		}
+	}
+
+	var id int
+	id, err = uniqueKeyGenerator.GetNewTransferId(conn)
+	if err != nil {
+		return TransferTuple{}, fmt.Errorf("error when generating transferId")
+	}
+	transfer := TransferTuple{
+		TransferId: strconv.Itoa(id),
+		AdminUid:   adminUid,
+		FromUid:    fromUid,
+		ToUid:      toUid,
+		Asset:      asset,
+		Amount:     fmt.Sprintf("%f", amount),
+		Reason:     reason,
+		Time:       getCurrentTimeInString(),
+	}
+
+	// read before the atomic step, a transaction can not read what it wrote
+	var toPositionExists bool
+	if symbolName != "" {
+		toPositionExists, err = checkSymbolPositionExists(conn, toUid, symbolName)
+		if err != nil {
+			return TransferTuple{}, fmt.Errorf("database error when adding amount to symbol")
+		}
+	}
+
+	// the debit, the credit, their records and the journal posting are applied together, or not at all
+	err = runAtomically(conn, func(conn storage.Conn) error {
+		if symbolName == "" {
+			balance, err := decreaseAccountBalance(conn, fromUid, amount)
+			if err != nil {
+				return fmt.Errorf("database error when deducting balance from account")
+			}
+			_, err = insertCashMovementToCashLedger(conn, fromUid, CASH_MOVEMENT_TRANSFER_OUT, amount, reason, balance)
+			if err != nil {
+				return fmt.Errorf("database error when recording the transfer in the cash ledger")
+			}
+
+			balance, err = increaseAccountBalance(conn, toUid, amount)
+			if err != nil {
+				return fmt.Errorf("database error when adding balance to account")
+			}
+			_, err = insertCashMovementToCashLedger(conn, toUid, CASH_MOVEMENT_TRANSFER_IN, amount, reason, balance)
+			if err != nil {
+				return fmt.Errorf("database error when recording the transfer in the cash ledger")
+			}
+		} else {
+			_, err := decreaseSymbolPosition(conn, fromUid, symbolName, amount)
+			if err != nil {
+				return fmt.Errorf("database error when deducting amount from symbol")
+			}
+
+			if toPositionExists {
+				_, err = increaseSymbolPosition(conn, toUid, symbolName, amount)
+			} else {
+				err = setSymbolPosition(conn, toUid, symbolName, amount)
+			}
+			if err != nil {
+				return fmt.Errorf("database error when adding amount to symbol")
+			}
+		}
+
+		err := postJournalEntry(conn, JOURNAL_KIND_TRANSFER, transfer.TransferId, transfer.Time,
+			journalTransfer(asset, availableLedgerAccount(fromUid), availableLedgerAccount(toUid), amount))
+		if err != nil {
+			return fmt.Errorf("database error when posting the transfer to the journal")
+		}
+
+		err = insertTransferToTransferLog(conn, transfer)
+		if err != nil {
+			return fmt.Errorf("database error when recording the transfer")
+		}
+		return nil
+	})
+	if err != nil {
+		return TransferTuple{}, err
+	}
+
+	return transfer, nil
+}
+
+/*
+		QueryTransfers query the transfer audit log, from the oldest to the latest.
+	input --
+		adminUid: user id of the requester, MUST BE an admin account
+		sinceTransferId: transfer id, transfers after it(exclusive) are returned, 0 to read from the first transfer
+		limit: the maximum number of transfers to return, should be positive
+	output --
+		a list of transfer tuples
+		err:
+		if adminUid is not an admin account, an error message will be returned
+		if sinceTransferId or limit does not meet input restriction, an error message will be returned
+		if database fails to retrieve the transfers, an error message will be returned
+*/
+func QueryTransfers(store storage.Storage, adminUid string, sinceTransferId int, limit int) ([]TransferTuple, error) {
+	if sinceTransferId < 0 || limit <= 0 {
+		return []TransferTuple{}, fmt.Errorf("invalid since or limit")
+	}
+
+	conn := store.Get()
+	defer conn.Close()
+
+	isAdmin, err := checkAdminAccount(conn, adminUid)
+	if err != nil {
+		return []TransferTuple{}, fmt.Errorf("database error when checking admin account")
+	}
+	if !isAdmin {
+		return []TransferTuple{}, fmt.Errorf("permission denied")
+	}
+
+	var transfers []TransferTuple
+	transfers, err = getTransfersFromTransferLog(conn, sinceTransferId, limit)
+	if err != nil {
+		return []TransferTuple{}, fmt.Errorf("database error when retrieving the transfers")
+	}
+
+	return transfers, nil
+}
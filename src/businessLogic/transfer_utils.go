@@ -0,0 +1,88 @@
+package businessLogic
+
+import (
+	"app/storage"
+	"fmt"
+)
+
+const (
+	DB_TRANSFER_PREFIX       = "transfer:"
+	DB_TRANSFER_LOG          = "transfers"
+	DB_TRANSFER_FIELD_ADMIN  = "admin"
+	DB_TRANSFER_FIELD_FROM   = "from"
+	DB_TRANSFER_FIELD_TO     = "to"
+	DB_TRANSFER_FIELD_ASSET  = "asset"
+	DB_TRANSFER_FIELD_AMOUNT = "amount"
+	DB_TRANSFER_FIELD_REASON = "reason"
+	DB_TRANSFER_FIELD_TIME   = "time"
+)
+
+/*
+		Record a transfer in the transfer audit log.
+	input --
+		transfer: the transfer, MAKE SURE its transfer id is unique
+	err --
+		from HMSet, ZAdd
+*/
+func insertTransferToTransferLog(conn storage.Conn, transfer TransferTuple) error {
+	err := conn.HMSet(
+		DB_TRANSFER_PREFIX+transfer.TransferId,
+		map[string]interface{}{
+			DB_TRANSFER_FIELD_ADMIN:  transfer.AdminUid,
+			DB_TRANSFER_FIELD_FROM:   transfer.FromUid,
+			DB_TRANSFER_FIELD_TO:     transfer.ToUid,
+			DB_TRANSFER_FIELD_ASSET:  transfer.Asset,
+			DB_TRANSFER_FIELD_AMOUNT: transfer.Amount,
+			DB_TRANSFER_FIELD_REASON: transfer.Reason,
+			DB_TRANSFER_FIELD_TIME:   transfer.Time})
+	if err != nil {
+		return err
+	}
+
+	return conn.ZAdd(DB_TRANSFER_LOG, transfer.TransferId, transfer.TransferId)
+}
+
+/*
+		Query transfers from the transfer audit log with transfer id greater than sinceTransferId, from the oldest to the latest.
+		If the transfer log does not exist, an EMPTY list is returned.
+	input --
+		sinceTransferId: transfer id, transfers after it(exclusive) are returned, 0 to read from the first transfer
+		limit: the maximum number of transfers to return
+	err --
+		from ZRangeByScoreWithLimit, HMGet
+*/
+func getTransfersFromTransferLog(conn storage.Conn, sinceTransferId int, limit int) ([]TransferTuple, error) {
+	transferIds, err := conn.ZRangeByScoreWithLimit(DB_TRANSFER_LOG, fmt.Sprintf("(%d", sinceTransferId), "+inf", 0, limit)
+	if err != nil {
+		return []TransferTuple{}, err
+	}
+
+	var transfers []TransferTuple
+	for _, transferId := range transferIds {
+		var values []string
+		values, err = conn.HMGet(DB_TRANSFER_PREFIX+transferId, []string{
+			DB_TRANSFER_FIELD_ADMIN,
+			DB_TRANSFER_FIELD_FROM,
+			DB_TRANSFER_FIELD_TO,
+			DB_TRANSFER_FIELD_ASSET,
+			DB_TRANSFER_FIELD_AMOUNT,
+			DB_TRANSFER_FIELD_REASON,
+			DB_TRANSFER_FIELD_TIME})
+		if err != nil {
+			return []TransferTuple{}, err
+		}
+
+		transfers = append(transfers, TransferTuple{
+			TransferId: transferId,
+			AdminUid:   values[0],
+			FromUid:    values[1],
+			ToUid:      values[2],
+			Asset:      values[3],
+			Amount:     values[4],
+			Reason:     values[5],
+			Time:       values[6],
+		})
+	}
+
+	return transfers, nil
+}
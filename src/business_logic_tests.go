@@ -1,14 +1,12 @@
 package main
 
 import (
-	test "businessLogic"
+	test "app/businessLogic"
+	"app/redis"
+	"app/storage"
+	keyGenerator "app/uniqueKeyGenerator"
 	"fmt"
-	redis "redis"
 	"time"
-
-	keyGenerator "uniqueKeyGenerator"
-
-	redigo "github.com/gomodule/redigo/redis"
 )
 
 func main() {
@@ -25,94 +23,94 @@ func main() {
 		},
 	)
 
-	connection := pool.Get()
-	defer connection.Close()
-	conn := (&connection)
+	store := storage.NewRedisStorage(pool)
+	conn := store.Get()
+	defer conn.Close()
 
-	redis.FlushAll(conn)
+	conn.FlushAll()
 
 	for i := 0; i < 20; i++ {
-		key, _ := keyGenerator.GetNewOrderId(pool)
+		key, _ := keyGenerator.GetNewOrderId(store)
 		fmt.Println(key)
 	}
 
 	// 	buyer := "12345"
 	// 	seller := "34567"
-	// 	createAccount(pool, buyer, 10000, false)
-	// 	createAccount(pool, seller, 0, false)
-	// 	addBitcoin(pool, buyer, 0, false)
-	// 	addBitcoin(pool, seller, 100, false)
+	// 	createAccount(store, buyer, 10000, false)
+	// 	createAccount(store, seller, 0, false)
+	// 	addBitcoin(store, buyer, 0, false)
+	// 	addBitcoin(store, seller, 100, false)
 
-	// 	setBuyOrder(pool, "1", buyer, 100, 10, false)
-	// 	setSellOrder(pool, "11", seller, 100, 10, false)
+	// 	setBuyOrder(store, "1", buyer, 100, 10, false)
+	// 	setSellOrder(store, "11", seller, 100, 10, false)
 
-	// 	setSellOrder(pool, "12", seller, 4, 10, false)
-	// 	setSellOrder(pool, "13", seller, 5, 10, false)
-	// 	setSellOrder(pool, "14", seller, 6, 10, false)
+	// 	setSellOrder(store, "12", seller, 4, 10, false)
+	// 	setSellOrder(store, "13", seller, 5, 10, false)
+	// 	setSellOrder(store, "14", seller, 6, 10, false)
 
-	// 	setBuyOrder(pool, "2", buyer, 7, 50, false)
+	// 	setBuyOrder(store, "2", buyer, 7, 50, false)
 
 	// 	queryAccount(conn, buyer)
 	// 	queryAccount(conn, seller)
 	// 	fmt.Println("--------------  buy order -------------------------")
-	// 	queryOrder(pool, "1")
-	// 	queryOrder(pool, "2")
+	// 	queryOrder(store, buyer, "1")
+	// 	queryOrder(store, buyer, "2")
 	// 	fmt.Println("--------------  sell order -------------------------")
-	// 	queryOrder(pool, "11")
-	// 	queryOrder(pool, "12")
-	// 	queryOrder(pool, "13")
-	// 	queryOrder(pool, "14")
+	// 	queryOrder(store, seller, "11")
+	// 	queryOrder(store, seller, "12")
+	// 	queryOrder(store, seller, "13")
+	// 	queryOrder(store, seller, "14")
 
 	// 	fmt.Println("--------------  second -------------------------")
 
-	// 	setBuyOrder(pool, "3", buyer, 8, 10, false)
-	// 	setBuyOrder(pool, "4", buyer, 9, 10, false)
-	// 	setSellOrder(pool, "15", seller, 6, 50, false)
+	// 	setBuyOrder(store, "3", buyer, 8, 10, false)
+	// 	setBuyOrder(store, "4", buyer, 9, 10, false)
+	// 	setSellOrder(store, "15", seller, 6, 50, false)
 
 	// 	queryAccount(conn, buyer)
 	// 	queryAccount(conn, seller)
 	// 	fmt.Println("--------------  buy order -------------------------")
-	// 	queryOrder(pool, "3")
-	// 	queryOrder(pool, "4")
+	// 	queryOrder(store, buyer, "3")
+	// 	queryOrder(store, buyer, "4")
 	// 	fmt.Println("--------------  sell order -------------------------")
-	// 	queryOrder(pool, "15")
+	// 	queryOrder(store, seller, "15")
 	// }
 
-	// func createAccount(pool *redigo.Pool, uid string, balance float64, display bool) {
-	// 	test.CreateAccount(pool, uid, balance)
+	// func createAccount(store storage.Storage, uid string, balance float64, display bool) {
+	// 	test.CreateAccount(store, uid, balance)
 	// 	if display {
 	// 		fmt.Printf("Create account: \"%s\", balance: %.2f\n", uid, balance)
 	// 	}
 }
 
-func addBitcoin(pool *redigo.Pool, uid string, amount float64, display bool) {
-	test.SetOrAddSymbolPositionToAccount(pool, uid, "bitcoin", amount)
+func addBitcoin(store storage.Storage, uid string, amount float64, display bool) {
+	test.SetOrAddSymbolPositionToAccount(store, uid, "bitcoin", amount)
 	if display {
 		fmt.Printf("Add bitcoin to account: \"%s\", amount: %.2f\n", uid, amount)
 	}
 }
 
-func setBuyOrder(pool *redigo.Pool, orderId string, uid string, limitPrice float64, amount float64, display bool) {
-	test.SetBuyOrder(pool, orderId, uid, "bitcoin", limitPrice, amount)
+func setBuyOrder(store storage.Storage, orderId string, uid string, limitPrice float64, amount float64, display bool) {
+	test.SetBuyOrder(store, orderId, uid, "bitcoin", limitPrice, amount)
 	if display {
 		fmt.Printf("Set buy order: \"%s\" for account: \"%s\", limitPrice: %.2f, amount: %.2f\n", orderId, uid, limitPrice, amount)
 	}
 }
 
-func setSellOrder(pool *redigo.Pool, orderId string, uid string, limitPrice float64, amount float64, display bool) {
-	test.SetSellOrder(pool, orderId, uid, "bitcoin", limitPrice, amount)
+func setSellOrder(store storage.Storage, orderId string, uid string, limitPrice float64, amount float64, display bool) {
+	test.SetSellOrder(store, orderId, uid, "bitcoin", limitPrice, amount)
 	if display {
 		fmt.Printf("Set sell order: \"%s\" for account: \"%s\", limitPrice: %.2f, amount: %.2f\n", orderId, uid, limitPrice, amount)
 	}
 }
 
-func queryAccount(conn *redigo.Conn, uid string) {
+func queryAccount(conn storage.Conn, uid string) {
 	balance, _ := test.GetAccountBalance(conn, uid)
 	amount, _ := test.GetSymbolPosition(conn, uid, "bitcoin")
 	fmt.Printf("Query account: \"%s\", balance: %.2f, bitcoin amount:%.2f\n", uid, balance, amount)
 }
 
-func queryOrder(pool *redigo.Pool, orderId string) {
-	op, ex, can, err := test.QueryOrderStatusAndHistory(pool, orderId)
+func queryOrder(store storage.Storage, uid string, orderId string) {
+	op, ex, can, err := test.QueryOrderStatusAndHistory(store, uid, orderId)
 	fmt.Println("        QueryOrderStatusAndHistory:", orderId, err, "\n", "open:", op, "\n", "exec:", ex, "\n", "canc", can)
 }
@@ -28,7 +28,7 @@ func main() {
 	redis.FlushAll(conn)
 
 	for i := 0; i < 100000; i++ {
-		test.InsertExcutedOrderToExcutedHistory(conn, "3", 100, 100, "time")
+		test.InsertExcutedOrderToExcutedHistory(conn, "3", 100, 100, "time", "1")
 	}
 
 	exists, _ := test.ExecutedOrderExists(conn, "3")
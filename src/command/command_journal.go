@@ -0,0 +1,325 @@
+package command
+
+import (
+	"app/businessLogic"
+	"app/storage"
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// the commands which change the state of the exchange, by their name in the command journal.
+// Queries are not journaled. An api key is journaled with its generated id and secret, the snapshots hold the secrets as well,
+// so the journal directory must be kept as private as the database.
+var journaledCommands = map[string]func() Command{
+	"create":     func() Command { return &CreateAccoutCommand{} },
+	"symbol":     func() Command { return &SetOrAddSymbolPositionToAccountCommand{} },
+	"buy":        func() Command { return &SetBuyOrderCommand{} },
+	"sell":       func() Command { return &SetSellOrderCommand{} },
+	"cancel":     func() Command { return &CancelOpenOrderCommand{} },
+	"deposit":    func() Command { return &DepositCommand{} },
+	"withdraw":   func() Command { return &WithdrawCommand{} },
+	"transfer":   func() Command { return &TransferCommand{} },
+	"freeze":     func() Command { return &FreezeAccountCommand{} },
+	"unfreeze":   func() Command { return &UnfreezeAccountCommand{} },
+	"close":      func() Command { return &CloseAccountCommand{} },
+	"ratelimit":  func() Command { return &SetRateLimitsCommand{} },
+	"risklimit":  func() Command { return &SetRiskLimitsCommand{} },
+	"group":      func() Command { return &SetAccountGroupCommand{} },
+	"killswitch": func() Command { return &KillSwitchCommand{} },
+	"apikey":     func() Command { return &CreateApiKeyCommand{} },
+	"revoke":     func() Command { return &RevokeApiKeyCommand{} },
+}
+
+// journaledCommandName returns the name of a command in the command journal, empty if it is not journaled
+func journaledCommandName(command Command) string {
+	switch command.(type) {
+	case *CreateAccoutCommand:
+		return "create"
+	case *SetOrAddSymbolPositionToAccountCommand:
+		return "symbol"
+	case *SetBuyOrderCommand:
+		return "buy"
+	case *SetSellOrderCommand:
+		return "sell"
+	case *CancelOpenOrderCommand:
+		return "cancel"
+	case *DepositCommand:
+		return "deposit"
+	case *WithdrawCommand:
+		return "withdraw"
+	case *TransferCommand:
+		return "transfer"
+	case *FreezeAccountCommand:
+		return "freeze"
+	case *UnfreezeAccountCommand:
+		return "unfreeze"
+	case *CloseAccountCommand:
+		return "close"
+	case *SetRateLimitsCommand:
+		return "ratelimit"
+	case *SetRiskLimitsCommand:
+		return "risklimit"
+	case *SetAccountGroupCommand:
+		return "group"
+	case *KillSwitchCommand:
+		return "killswitch"
+	case *CreateApiKeyCommand:
+		return "apikey"
+	case *RevokeApiKeyCommand:
+		return "revoke"
+	}
+	return ""
+}
+
+// CommandJournalEntry is an accepted command in the command journal, with the time its timestamps are taken at
+type CommandJournalEntry struct {
+	Sequence int64           `json:"seq"`
+	Time     int64           `json:"time"`
+	Name     string          `json:"name"`
+	Command  json.RawMessage `json:"command"`
+}
+
+/*
+		CommandJournal is an append-only log of every accepted command which changes the state of the exchange, one json line per command.
+		A command is written and fsync'd before it is executed, and the journaled commands are executed one at a time
+		in the order of their sequence, so replaying the journal into an empty store executes the same commands in the same order,
+		with the same timestamps, and gets the same order, trade and other ids.
+		The journal is a directory of segment files, named by the sequence of their first entry. A snapshot starts a new segment,
+		and the segments before it are removed, the snapshot covers their entries.
+*/
+type CommandJournal struct {
+	// lock serializes writing and executing the journaled commands
+	lock         sync.Mutex
+	dir          string
+	file         *os.File // the last segment
+	nextSequence int64
+
+	// snapshotLock serializes the snapshots
+	snapshotLock sync.Mutex
+}
+
+const COMMAND_JOURNAL_SEGMENT_PREFIX = "journal-"
+const COMMAND_JOURNAL_SEGMENT_SUFFIX = ".log"
+
+func commandJournalSegmentName(firstSequence int64) string {
+	return fmt.Sprintf("%s%020d%s", COMMAND_JOURNAL_SEGMENT_PREFIX, firstSequence, COMMAND_JOURNAL_SEGMENT_SUFFIX)
+}
+
+// commandJournalSegments returns the first sequences of the segments in dir, in order
+func commandJournalSegments(dir string) ([]int64, error) {
+	names, err := filepath.Glob(filepath.Join(dir, COMMAND_JOURNAL_SEGMENT_PREFIX+"*"+COMMAND_JOURNAL_SEGMENT_SUFFIX))
+	if err != nil {
+		return nil, err
+	}
+
+	segments := []int64{}
+	for _, name := range names {
+		firstSequence := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(name), COMMAND_JOURNAL_SEGMENT_PREFIX), COMMAND_JOURNAL_SEGMENT_SUFFIX)
+		sequence, err := strconv.ParseInt(firstSequence, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("command journal: invalid segment %s", name)
+		}
+		segments = append(segments, sequence)
+	}
+	sort.Slice(segments, func(i, j int) bool { return segments[i] < segments[j] })
+	return segments, nil
+}
+
+/*
+	OpenCommandJournal
+		Open the command journal in dir to append commands after its last entry, the directory is created if it does not exist.
+		A torn last line, written when the engine stopped in the middle of an append, is removed, its command was never executed.
+	output:
+		*CommandJournal, the entries in the journal, which start after the latest snapshot if the older segments were removed
+	err:
+		a segment can not be read, or has an invalid entry
+*/
+func OpenCommandJournal(dir string) (*CommandJournal, []CommandJournalEntry, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, nil, err
+	}
+	segments, err := commandJournalSegments(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(segments) == 0 {
+		segments = []int64{1}
+	}
+
+	entries := []CommandJournalEntry{}
+	var file *os.File
+	for i, firstSequence := range segments {
+		file, err = os.OpenFile(filepath.Join(dir, commandJournalSegmentName(firstSequence)), os.O_CREATE|os.O_RDWR, 0600)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		var segmentEntries []CommandJournalEntry
+		var validLength int64
+		segmentEntries, validLength, err = readCommandJournalSegment(file, firstSequence)
+		if err == nil && i == len(segments)-1 {
+			err = file.Truncate(validLength)
+			if err == nil {
+				_, err = file.Seek(validLength, io.SeekStart)
+			}
+		} else if err == nil {
+			err = file.Close()
+		}
+		if err == nil && i+1 < len(segments) && firstSequence+int64(len(segmentEntries)) != segments[i+1] {
+			err = fmt.Errorf("command journal: segment %d does not end before segment %d", firstSequence, segments[i+1])
+		}
+		if err != nil {
+			file.Close()
+			return nil, nil, err
+		}
+		entries = append(entries, segmentEntries...)
+	}
+
+	lastSegment := segments[len(segments)-1]
+	journal := &CommandJournal{dir: dir, file: file, nextSequence: lastSegment}
+	if len(entries) > 0 {
+		journal.nextSequence = entries[len(entries)-1].Sequence + 1
+	}
+	return journal, entries, nil
+}
+
+// readCommandJournalSegment reads the entries of a segment and the length of the file up to the end of the last valid entry
+func readCommandJournalSegment(file *os.File, firstSequence int64) ([]CommandJournalEntry, int64, error) {
+	entries := []CommandJournalEntry{}
+	var validLength int64
+
+	reader := bufio.NewReader(file)
+	for lineNumber := 1; ; lineNumber++ {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			// a line without its newline was torn by a crash
+			return entries, validLength, nil
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+
+		var entry CommandJournalEntry
+		err = json.Unmarshal(line, &entry)
+		if err != nil {
+			return nil, 0, fmt.Errorf("command journal: segment %d line %d: %v", firstSequence, lineNumber, err)
+		}
+		if entry.Sequence != firstSequence+int64(len(entries)) {
+			return nil, 0, fmt.Errorf("command journal: segment %d line %d: unexpected sequence %d", firstSequence, lineNumber, entry.Sequence)
+		}
+		entries = append(entries, entry)
+		validLength += int64(len(line))
+	}
+}
+
+// append writes a command to the journal and fsyncs it. MUST hold j.lock.
+func (j *CommandJournal) append(name string, command Command) (CommandJournalEntry, error) {
+	commandInJson, err := json.Marshal(command)
+	if err != nil {
+		return CommandJournalEntry{}, err
+	}
+	entry := CommandJournalEntry{Sequence: j.nextSequence, Time: time.Now().Unix(), Name: name, Command: commandInJson}
+
+	var line []byte
+	line, err = json.Marshal(entry)
+	if err != nil {
+		return CommandJournalEntry{}, err
+	}
+	_, err = j.file.Write(append(line, '\n'))
+	if err == nil {
+		err = j.file.Sync()
+	}
+	if err != nil {
+		return CommandJournalEntry{}, err
+	}
+
+	j.nextSequence++
+	return entry, nil
+}
+
+// startSegment closes the last segment and starts a new one with the next entry. MUST hold j.lock.
+func (j *CommandJournal) startSegment() error {
+	file, err := os.OpenFile(filepath.Join(j.dir, commandJournalSegmentName(j.nextSequence)), os.O_CREATE|os.O_RDWR|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	err = syncDir(j.dir)
+	if err != nil {
+		file.Close()
+		return err
+	}
+	j.file.Close()
+	j.file = file
+	return nil
+}
+
+func (j *CommandJournal) Close() error {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	return j.file.Close()
+}
+
+// syncDir fsyncs a directory, so the files created, renamed or removed in it survive a crash
+func syncDir(dir string) error {
+	file, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return file.Sync()
+}
+
+// executeAt executes a journaled command with every timestamp taken at the time of its journal entry
+func executeAt(command Command, epoch int64, store storage.Storage, readWriteLock *sync.RWMutex) {
+	businessLogic.SetCommandTime(epoch)
+	defer businessLogic.ClearCommandTime()
+	command.execute(store, readWriteLock)
+}
+
+/*
+	ReplayCommandJournal
+		Rebuild the state of the exchange by executing the entries of the command journal after a sequence in order,
+		into an EMPTY store, or into the store the snapshot of that sequence is restored to.
+		The admin accounts must be registered before, admin commands are checked against them.
+	input:
+		store: an empty store, or restored from the snapshot of afterSequence
+		entries: from OpenCommandJournal
+		afterSequence: the sequence of the snapshot, 0 without snapshot
+	err:
+		an entry is missing, names an unknown command or can not be decoded
+*/
+func ReplayCommandJournal(store storage.Storage, entries []CommandJournalEntry, afterSequence int64) error {
+	var readWriteLock sync.RWMutex
+	nextSequence := afterSequence + 1
+	for _, entry := range entries {
+		if entry.Sequence <= afterSequence {
+			continue
+		}
+		if entry.Sequence != nextSequence {
+			return fmt.Errorf("command journal: entry %d is missing", nextSequence)
+		}
+		nextSequence++
+
+		newCommand, known := journaledCommands[entry.Name]
+		if !known {
+			return fmt.Errorf("command journal: unknown command %s in entry %d", entry.Name, entry.Sequence)
+		}
+		command := newCommand()
+		err := json.Unmarshal(entry.Command, command)
+		if err != nil {
+			return fmt.Errorf("command journal: entry %d: %v", entry.Sequence, err)
+		}
+		executeAt(command, entry.Time, store, &readWriteLock)
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package command
+
+import (
+	"app/storage"
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const COMMAND_JOURNAL_SNAPSHOT_FILE = "snapshot.json"
+
+// CommandJournalSnapshot is the state of the exchange after the journal entry Sequence, every key of the store
+type CommandJournalSnapshot struct {
+	Sequence int64           `json:"seq"`
+	Time     int64           `json:"time"`
+	Entries  []storage.Entry `json:"entries"`
+}
+
+/*
+	WriteSnapshot
+		Write a point-in-time image of the store (accounts, positions, order books, histories and id counters)
+		to the snapshot file of the journal, with the sequence of the last journal entry it covers,
+		then remove the journal segments before it.
+		The store is exported holding the journal lock and the write lock of the executor, so neither journaled commands
+		nor the other commands which write the store run meanwhile, queries do.
+		Only MemoryStorage and WriteBehindStorage export a point-in-time image. RedisStorage scans the keys,
+		the image is consistent only if nothing else writes to the Redis server during the export.
+	input:
+		store: the store of the executor
+		readWriteLock: the ReadWriteLock of the executor
+	output:
+		the sequence the snapshot covers
+	err:
+		the store can not be exported, or the snapshot can not be written
+*/
+func (j *CommandJournal) WriteSnapshot(store storage.Storage, readWriteLock *sync.RWMutex) (int64, error) {
+	j.snapshotLock.Lock()
+	defer j.snapshotLock.Unlock()
+
+	// in the order of executeCommand, the journal lock first
+	j.lock.Lock()
+	snapshot := CommandJournalSnapshot{Sequence: j.nextSequence - 1, Time: time.Now().Unix()}
+	var err error
+	readWriteLock.Lock()
+	snapshot.Entries, err = store.Export()
+	readWriteLock.Unlock()
+	if err == nil {
+		err = j.startSegment()
+	}
+	j.lock.Unlock()
+	if err != nil {
+		return 0, err
+	}
+
+	path := filepath.Join(j.dir, COMMAND_JOURNAL_SNAPSHOT_FILE)
+	err = writeFileAtomically(path, snapshot)
+	if err != nil {
+		return 0, err
+	}
+
+	// the snapshot covers every segment before the one started with it
+	var segments []int64
+	segments, err = commandJournalSegments(j.dir)
+	if err != nil {
+		return 0, err
+	}
+	for _, firstSequence := range segments {
+		if firstSequence > snapshot.Sequence {
+			break
+		}
+		err = os.Remove(filepath.Join(j.dir, commandJournalSegmentName(firstSequence)))
+		if err != nil {
+			return 0, err
+		}
+	}
+	return snapshot.Sequence, syncDir(j.dir)
+}
+
+// writeFileAtomically writes value as json to a temporary file, then renames it to path, so path is never partially written
+func writeFileAtomically(path string, value interface{}) error {
+	temporaryPath := path + ".tmp"
+	file, err := os.OpenFile(temporaryPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	err = json.NewEncoder(file).Encode(value)
+	if err == nil {
+		err = file.Sync()
+	}
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(temporaryPath, path)
+	}
+	if err != nil {
+		os.Remove(temporaryPath)
+		return err
+	}
+	return syncDir(filepath.Dir(path))
+}
+
+/*
+	ReadSnapshot
+		Read the latest snapshot of the journal.
+	output:
+		the snapshot, false if the journal has no snapshot
+	err:
+		the snapshot file can not be read
+*/
+func (j *CommandJournal) ReadSnapshot() (CommandJournalSnapshot, bool, error) {
+	var snapshot CommandJournalSnapshot
+	file, err := os.Open(filepath.Join(j.dir, COMMAND_JOURNAL_SNAPSHOT_FILE))
+	if os.IsNotExist(err) {
+		return snapshot, false, nil
+	}
+	if err != nil {
+		return snapshot, false, err
+	}
+	defer file.Close()
+
+	err = json.NewDecoder(file).Decode(&snapshot)
+	if err != nil {
+		return snapshot, false, err
+	}
+	return snapshot, true, nil
+}
+
+/*
+		RestoreSnapshot writes the keys of a snapshot into an EMPTY store, replay the journal after snapshot.Sequence then.
+		Keys which have expired since the snapshot are restored too, with the time they had left at the snapshot,
+		the journal after it was executed with them. The business logic checks expiry against the recorded command time.
+*/
+func RestoreSnapshot(store storage.Storage, snapshot CommandJournalSnapshot) error {
+	conn := store.Get()
+	defer conn.Close()
+	return storage.WriteEntries(conn, snapshot.Entries, time.Unix(snapshot.Time, 0))
+}
+
+/*
+		StartSnapshotter writes a snapshot of the store every interval, in a goroutine,
+		so recovery replays only the journal after the latest snapshot.
+*/
+func (j *CommandJournal) StartSnapshotter(store storage.Storage, readWriteLock *sync.RWMutex, interval time.Duration) {
+	go func() {
+		for range time.Tick(interval) {
+			_, err := j.WriteSnapshot(store, readWriteLock)
+			if err != nil {
+				log.Println("command journal: can not write a snapshot", err)
+			}
+		}
+	}()
+}
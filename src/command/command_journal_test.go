@@ -0,0 +1,242 @@
+package command
+
+import (
+	"app/businessLogic"
+	"app/storage"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+const TEST_ADMIN_UID = "1"
+
+func newTestStore(t *testing.T) storage.Storage {
+	store := storage.NewMemoryStorage()
+	err := businessLogic.RegisterAdminAccount(store, TEST_ADMIN_UID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+// exportWithoutExpiry exports the store without the expiry times of the keys, the database expires keys by the wall clock
+func exportWithoutExpiry(t *testing.T, store storage.Storage) []storage.Entry {
+	entries, err := store.Export()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range entries {
+		entries[i].ExpireAt = time.Time{}
+	}
+	return entries
+}
+
+// the commands of the tests, every kind of journaled command, with accepted and rejected ones
+func testCommands() []Command {
+	return []Command{
+		&CreateAccoutCommand{Uid: "2", Balance: 1000},
+		&CreateAccoutCommand{Uid: "3", Balance: 1000},
+		&CreateAccoutCommand{Uid: "2", Balance: 5},
+		&SetOrAddSymbolPositionToAccountCommand{Uid: "2", SymbolName: "SPY", Amount: 100},
+		&SetOrAddSymbolPositionToAccountCommand{Uid: "3", SymbolName: "SPY", Amount: 100},
+		&SetSellOrderCommand{ClOrdId: "s-1", Uid: "3", SymbolName: "SPY", LimitPrice: 10, Amount: 5},
+		&SetSellOrderCommand{ClOrdId: "s-2", Uid: "3", SymbolName: "SPY", LimitPrice: 11, Amount: 5},
+		&SetBuyOrderCommand{ClOrdId: "b-1", Uid: "2", SymbolName: "SPY", LimitPrice: 12, Amount: 7},
+		&SetBuyOrderCommand{ClOrdId: "b-1", Uid: "2", SymbolName: "SPY", LimitPrice: 12, Amount: 7},
+		&SetBuyOrderCommand{ClOrdId: "b-2", Uid: "2", SymbolName: "SPY", LimitPrice: 12, Amount: 1000},
+		&SetBuyOrderCommand{Uid: "2", SymbolName: "SPY", LimitPrice: 9, Amount: 10},
+		&CancelOpenOrderCommand{Uid: "3", ClOrdId: "s-2"},
+		&DepositCommand{AdminUid: TEST_ADMIN_UID, Uid: "2", Amount: 250, Reason: "wire"},
+		&WithdrawCommand{Uid: "3", Amount: 100, Reason: "wire"},
+		&WithdrawCommand{Uid: "3", Amount: 1e9, Reason: "too much"},
+		&TransferCommand{AdminUid: TEST_ADMIN_UID, FromUid: "3", ToUid: "2", SymbolName: "SPY", Amount: 10},
+		&SetRiskLimitsCommand{AdminUid: TEST_ADMIN_UID, AccountId: "2", MaxOpenOrders: 5},
+		&CreateApiKeyCommand{AdminUid: TEST_ADMIN_UID, AccountId: "2"},
+		&KillSwitchCommand{AdminUid: TEST_ADMIN_UID, AccountId: "2", Reason: "test"},
+		&KillSwitchCommand{AdminUid: TEST_ADMIN_UID, AccountId: "2", Release: true, Reason: "test"},
+		&FreezeAccountCommand{AdminUid: TEST_ADMIN_UID, AccountId: "3"},
+	}
+}
+
+// executeJournaled executes commands through an executor which journals them into a new journal in dir
+func executeJournaled(t *testing.T, store storage.Storage, dir string, commands []Command) *CommandJournal {
+	journal, entries, err := OpenCommandJournal(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("new journal has %d entries", len(entries))
+	}
+
+	executor := CommandListExecutor{Pool: store, ReadWriteLock: &sync.RWMutex{}, Journal: journal}
+	executor.Execute(commands)
+	return journal
+}
+
+func TestReplayCommandJournal(t *testing.T) {
+	tests := []struct {
+		name string
+		// the number of commands executed before a snapshot is written, -1 for no snapshot
+		snapshotAfter int
+	}{
+		{"whole journal", -1},
+		{"snapshot then the rest of the journal", 10},
+		{"snapshot of every command", len(testCommands())},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "command-journal")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			store := newTestStore(t)
+			commands := testCommands()
+			var journal *CommandJournal
+			if test.snapshotAfter < 0 {
+				journal = executeJournaled(t, store, dir, commands)
+			} else {
+				journal = executeJournaled(t, store, dir, commands[:test.snapshotAfter])
+				_, err = journal.WriteSnapshot(store, &sync.RWMutex{})
+				if err != nil {
+					t.Fatal(err)
+				}
+				executor := CommandListExecutor{Pool: store, ReadWriteLock: &sync.RWMutex{}, Journal: journal}
+				executor.Execute(commands[test.snapshotAfter:])
+			}
+			journal.Close()
+
+			// recover the way main does: snapshot, admin accounts, then the journal after the snapshot
+			reopened, entries, err := OpenCommandJournal(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer reopened.Close()
+			snapshot, _, err := reopened.ReadSnapshot()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			recovered := storage.NewMemoryStorage()
+			err = RestoreSnapshot(recovered, snapshot)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = businessLogic.RegisterAdminAccount(recovered, TEST_ADMIN_UID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = ReplayCommandJournal(recovered, entries, snapshot.Sequence)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := exportWithoutExpiry(t, store)
+			got := exportWithoutExpiry(t, recovered)
+			if len(got) != len(want) {
+				t.Fatalf("replayed state has %d keys, want %d keys of the original state", len(got), len(want))
+			}
+			for i := range want {
+				if !reflect.DeepEqual(got[i], want[i]) {
+					t.Fatalf("replayed key %s is %+v, want %+v", got[i].Key, got[i], want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestReplayCommandJournalRejectsMissingEntry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "command-journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	journal := executeJournaled(t, newTestStore(t), dir, testCommands()[:3])
+	journal.Close()
+	reopened, entries, err := OpenCommandJournal(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reopened.Close()
+
+	tests := []struct {
+		name          string
+		entries       []CommandJournalEntry
+		afterSequence int64
+	}{
+		{"gap", append([]CommandJournalEntry{entries[0]}, entries[2]), 0},
+		{"first entry missing", entries[1:], 0},
+		{"unknown command", []CommandJournalEntry{{Sequence: 1, Name: "unknown"}}, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := ReplayCommandJournal(newTestStore(t), test.entries, test.afterSequence)
+			if err == nil {
+				t.Fatal("replay succeeded")
+			}
+		})
+	}
+}
+
+func TestReplayCommandJournalAfterOldSnapshot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "command-journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	retention := businessLogic.ClientOrderIdRetention
+	businessLogic.ClientOrderIdRetention = 2 * time.Second
+	defer func() { businessLogic.ClientOrderIdRetention = retention }()
+
+	// the client order id is recorded before the snapshot, and resubmitted in the journal after it
+	store := newTestStore(t)
+	commands := testCommands()
+	journal := executeJournaled(t, store, dir, commands[:8])
+	_, err = journal.WriteSnapshot(store, &sync.RWMutex{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	executor := CommandListExecutor{Pool: store, ReadWriteLock: &sync.RWMutex{}, Journal: journal}
+	executor.Execute(commands[8:])
+	journal.Close()
+	want := exportWithoutExpiry(t, store)
+
+	// recover once the snapshot is older than the retention of the client order ids
+	time.Sleep(businessLogic.ClientOrderIdRetention + time.Second)
+	reopened, entries, err := OpenCommandJournal(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	snapshot, _, err := reopened.ReadSnapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recovered := storage.NewMemoryStorage()
+	err = RestoreSnapshot(recovered, snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ReplayCommandJournal(recovered, entries, snapshot.Sequence)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := exportWithoutExpiry(t, recovered)
+	if len(got) != len(want) {
+		t.Fatalf("replayed state has %d keys, want %d keys of the original state", len(got), len(want))
+	}
+	for i := range want {
+		if !reflect.DeepEqual(got[i], want[i]) {
+			t.Fatalf("replayed key %s is %+v, want %+v", got[i].Key, got[i], want[i])
+		}
+	}
+}
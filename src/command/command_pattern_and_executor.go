@@ -2,16 +2,16 @@ package command
 
 import (
 	"app/businessLogic"
+	"app/storage"
 	"fmt"
+	"html"
 	"strconv"
 	"sync"
 	"app/uniqueKeyGenerator"
-
-	redigo "github.com/gomodule/redigo/redis"
 )
 
 type Command interface {
-	execute(pool *redigo.Pool, readWriteLock *sync.RWMutex)
+	execute(store storage.Storage, readWriteLock *sync.RWMutex)
 	getResponse() string
 }
 
@@ -19,15 +19,15 @@ type CreateAccoutCommand struct {
 	Uid     string
 	Balance float64
 
-	Err      error
-	Response string
+	Err      error  `json:"-"`
+	Response string `json:"-"`
 }
 
-func (c *CreateAccoutCommand) execute(pool *redigo.Pool, readWriteLock *sync.RWMutex) {
+func (c *CreateAccoutCommand) execute(store storage.Storage, readWriteLock *sync.RWMutex) {
 	readWriteLock.Lock()
 	defer readWriteLock.Unlock()
 
-	Err := businessLogic.CreateAccount(pool, c.Uid, c.Balance)
+	Err := businessLogic.CreateAccount(store, c.Uid, c.Balance)
 	if Err != nil {
 		c.Response = fmt.Sprintf("<error id=\"%s\">%s</error>", c.Uid, Err)
 		return
@@ -45,15 +45,15 @@ type SetOrAddSymbolPositionToAccountCommand struct {
 	SymbolName string
 	Amount     float64
 
-	Err      error
-	Response string
+	Err      error  `json:"-"`
+	Response string `json:"-"`
 }
 
-func (c *SetOrAddSymbolPositionToAccountCommand) execute(pool *redigo.Pool, readWriteLock *sync.RWMutex) {
+func (c *SetOrAddSymbolPositionToAccountCommand) execute(store storage.Storage, readWriteLock *sync.RWMutex) {
 	readWriteLock.Lock()
 	defer readWriteLock.Unlock()
 
-	Err := businessLogic.SetOrAddSymbolPositionToAccount(pool, c.Uid, c.SymbolName, c.Amount)
+	Err := businessLogic.SetOrAddSymbolPositionToAccount(store, c.Uid, c.SymbolName, c.Amount)
 	if Err != nil {
 		c.Response = fmt.Sprintf("<error sym=\"%s\" id=\"%s\">%s</error>", c.SymbolName, c.Uid, Err)
 		return
@@ -68,33 +68,59 @@ func (c *SetOrAddSymbolPositionToAccountCommand) getResponse() string {
 
 type SetBuyOrderCommand struct {
 	OrderId    string
+	ClOrdId    string
 	Uid        string
 	SymbolName string
 	LimitPrice float64
 	Amount     float64
 
-	Err      error
-	Response string
+	Err      error  `json:"-"`
+	Response string `json:"-"`
 }
 
-func (c *SetBuyOrderCommand) execute(pool *redigo.Pool, readWriteLock *sync.RWMutex) {
+func (c *SetBuyOrderCommand) execute(store storage.Storage, readWriteLock *sync.RWMutex) {
 	readWriteLock.Lock()
 	defer readWriteLock.Unlock()
 
-	orderId, err := uniqueKeyGenerator.GetNewOrderId(pool)
+	if c.ClOrdId != "" {
+		orderId, response, found, err := businessLogic.LookupClientOrder(store, c.Uid, c.ClOrdId)
+		if err != nil {
+			c.Response = fmt.Sprintf("<error sym=\"%s\" Amount=\"%.2f\" limit=\"%.2f\"%s >%s</error>", c.SymbolName, c.Amount, c.LimitPrice, clOrdIdAttr(c.ClOrdId), err)
+			return
+		}
+		if found {
+			// a resubmitted order gets the original result
+			c.OrderId = orderId
+			c.Response = response
+			return
+		}
+	}
+
+	orderId, err := uniqueKeyGenerator.GetNewOrderId(store)
 	c.OrderId = strconv.Itoa(orderId)
 
 	if err != nil {
-		c.Response = fmt.Sprintf("<error sym=\"%s\" Amount=\"%.2f\" limit=\"%.2f\" >%s</error>", c.SymbolName, c.Amount, c.LimitPrice, "error when generating orderId")
+		c.Err = err
+		c.Response = fmt.Sprintf("<error sym=\"%s\" Amount=\"%.2f\" limit=\"%.2f\"%s >%s</error>", c.SymbolName, c.Amount, c.LimitPrice, clOrdIdAttr(c.ClOrdId), "error when generating orderId")
 		return
 	}
 
-	err = businessLogic.SetBuyOrder(pool, c.OrderId, c.Uid, c.SymbolName, c.LimitPrice, c.Amount)
+	openedResponse := fmt.Sprintf("<opened sym=\"%s\" Amount=\"%.2f\" limit=\"%.2f\" id=\"%s\"%s/>", c.SymbolName, c.Amount, c.LimitPrice, c.OrderId, clOrdIdAttr(c.ClOrdId))
+	err = businessLogic.SetBuyOrderForClientOrder(store, c.OrderId, c.Uid, c.SymbolName, c.LimitPrice, c.Amount,
+		businessLogic.ClientOrderTuple{ClOrdId: c.ClOrdId, Response: openedResponse})
 	if err != nil {
-		c.Response = fmt.Sprintf("<error sym=\"%s\" Amount=\"%.2f\" limit=\"%.2f\" >%s</error>", c.SymbolName, c.Amount, c.LimitPrice, err)
+		c.Err = err
+		c.Response = fmt.Sprintf("<error sym=\"%s\" Amount=\"%.2f\" limit=\"%.2f\"%s >%s</error>", c.SymbolName, c.Amount, c.LimitPrice, clOrdIdAttr(c.ClOrdId), err)
+		// a rejection is answered again when the order is resubmitted, a database error is not
+		if c.ClOrdId != "" && businessLogic.IsOrderRejection(err) {
+			err = businessLogic.RecordClientOrder(store, c.Uid, c.ClOrdId, "", c.Response)
+			if err != nil {
+				c.Response = fmt.Sprintf("<error sym=\"%s\" Amount=\"%.2f\" limit=\"%.2f\"%s >%s</error>", c.SymbolName, c.Amount, c.LimitPrice, clOrdIdAttr(c.ClOrdId), err)
+			}
+		}
 		return
 	} else {
-		c.Response = fmt.Sprintf("<opened sym=\"%s\" Amount=\"%.2f\" limit=\"%.2f\" id=\"%s\"/>", c.SymbolName, c.Amount, c.LimitPrice, c.OrderId)
+		c.Response = openedResponse
 	}
 }
 
@@ -102,36 +128,69 @@ func (c *SetBuyOrderCommand) getResponse() string {
 	return c.Response
 }
 
+// clOrdIdAttr formats the clOrdId attribute of an order response, empty if the order has no client order id
+func clOrdIdAttr(clOrdId string) string {
+	if clOrdId == "" {
+		return ""
+	}
+	return fmt.Sprintf(" clOrdId=\"%s\"", html.EscapeString(clOrdId))
+}
+
 type SetSellOrderCommand struct {
 	OrderId    string
+	ClOrdId    string
 	Uid        string
 	SymbolName string
 	LimitPrice float64
 	Amount     float64
 
-	Err      error
-	Response string
+	Err      error  `json:"-"`
+	Response string `json:"-"`
 }
 
-func (c *SetSellOrderCommand) execute(pool *redigo.Pool, readWriteLock *sync.RWMutex) {
+func (c *SetSellOrderCommand) execute(store storage.Storage, readWriteLock *sync.RWMutex) {
 	readWriteLock.Lock()
 	defer readWriteLock.Unlock()
 
-	orderId, err := uniqueKeyGenerator.GetNewOrderId(pool)
+	if c.ClOrdId != "" {
+		orderId, response, found, err := businessLogic.LookupClientOrder(store, c.Uid, c.ClOrdId)
+		if err != nil {
+			c.Response = fmt.Sprintf("<error sym=\"%s\" Amount=\"%.2f\" limit=\"%.2f\"%s >%s</error>", c.SymbolName, -c.Amount, c.LimitPrice, clOrdIdAttr(c.ClOrdId), err)
+			return
+		}
+		if found {
+			// a resubmitted order gets the original result
+			c.OrderId = orderId
+			c.Response = response
+			return
+		}
+	}
+
+	orderId, err := uniqueKeyGenerator.GetNewOrderId(store)
 	c.OrderId = strconv.Itoa(orderId)
 
 	if err != nil {
-		c.Response = fmt.Sprintf("<error sym=\"%s\" Amount=\"%.2f\" limit=\"%.2f\" >%s</error>", c.SymbolName, -c.Amount, c.LimitPrice, "error when generating orderId")
+		c.Err = err
+		c.Response = fmt.Sprintf("<error sym=\"%s\" Amount=\"%.2f\" limit=\"%.2f\"%s >%s</error>", c.SymbolName, -c.Amount, c.LimitPrice, clOrdIdAttr(c.ClOrdId), "error when generating orderId")
 		return
 	}
 
-	err = businessLogic.SetSellOrder(pool, c.OrderId, c.Uid, c.SymbolName, c.LimitPrice, c.Amount)
+	openedResponse := fmt.Sprintf("<opened sym=\"%s\" Amount=\"%.2f\" limit=\"%.2f\" id=\"%s\"%s/>", c.SymbolName, -c.Amount, c.LimitPrice, c.OrderId, clOrdIdAttr(c.ClOrdId))
+	err = businessLogic.SetSellOrderForClientOrder(store, c.OrderId, c.Uid, c.SymbolName, c.LimitPrice, c.Amount,
+		businessLogic.ClientOrderTuple{ClOrdId: c.ClOrdId, Response: openedResponse})
 	if err != nil {
-		c.Response = fmt.Sprintf("<error sym=\"%s\" Amount=\"%.2f\" limit=\"%.2f\" >%s</error>", c.SymbolName, -c.Amount, c.LimitPrice, err)
+		c.Err = err
+		c.Response = fmt.Sprintf("<error sym=\"%s\" Amount=\"%.2f\" limit=\"%.2f\"%s >%s</error>", c.SymbolName, -c.Amount, c.LimitPrice, clOrdIdAttr(c.ClOrdId), err)
+		// a rejection is answered again when the order is resubmitted, a database error is not
+		if c.ClOrdId != "" && businessLogic.IsOrderRejection(err) {
+			err = businessLogic.RecordClientOrder(store, c.Uid, c.ClOrdId, "", c.Response)
+			if err != nil {
+				c.Response = fmt.Sprintf("<error sym=\"%s\" Amount=\"%.2f\" limit=\"%.2f\"%s >%s</error>", c.SymbolName, -c.Amount, c.LimitPrice, clOrdIdAttr(c.ClOrdId), err)
+			}
+		}
 		return
 	} else {
-
-		c.Response = fmt.Sprintf("<opened sym=\"%s\" Amount=\"%.2f\" limit=\"%.2f\" id=\"%s\"/>", c.SymbolName, -c.Amount, c.LimitPrice, c.OrderId)
+		c.Response = openedResponse
 	}
 }
 
@@ -140,23 +199,34 @@ func (c *SetSellOrderCommand) getResponse() string {
 }
 
 type CancelOpenOrderCommand struct {
+	Uid     string
 	OrderId string
+	ClOrdId string
 
-	Err      error
-	Response string
+	Err      error  `json:"-"`
+	Response string `json:"-"`
 }
 
-func (c *CancelOpenOrderCommand) execute(pool *redigo.Pool, readWriteLock *sync.RWMutex) {
+func (c *CancelOpenOrderCommand) execute(store storage.Storage, readWriteLock *sync.RWMutex) {
 	readWriteLock.Lock()
 	defer readWriteLock.Unlock()
 
-	Err_in_cancel := businessLogic.CancelOpenOrder(pool, c.OrderId)
+	if c.OrderId == "" {
+		orderId, Err_in_lookup := businessLogic.GetOrderIdByClientOrderId(store, c.Uid, c.ClOrdId)
+		if Err_in_lookup != nil {
+			c.Response = fmt.Sprintf("<error%s>%s</error>", clOrdIdAttr(c.ClOrdId), Err_in_lookup)
+			return
+		}
+		c.OrderId = orderId
+	}
+
+	Err_in_cancel := businessLogic.CancelOpenOrder(store, c.Uid, c.OrderId)
 
 	if Err_in_cancel != nil {
 		c.Response = fmt.Sprintf("<error id=\"%s\">%s</error>", c.OrderId, Err_in_cancel)
 		return
 	}
-	_, executedOrderHistory, cancelledOrderHistory, Err_in_query := businessLogic.QueryOrderStatusAndHistory(pool, c.OrderId)
+	_, executedOrderHistory, cancelledOrderHistory, Err_in_query := businessLogic.QueryOrderStatusAndHistory(store, c.Uid, c.OrderId)
 	if Err_in_query != nil {
 		c.Response = fmt.Sprintf("<error id=\"%s\">%s</error>", c.OrderId, Err_in_query)
 		return
@@ -164,10 +234,11 @@ func (c *CancelOpenOrderCommand) execute(pool *redigo.Pool, readWriteLock *sync.
 		var executedHistoryResponse string
 		for _, executedHistoryTuple := range executedOrderHistory {
 			executedHistoryResponse +=
-				fmt.Sprintf("  <executed shares=%s price=%s time=%s/>",
+				fmt.Sprintf("  <executed shares=%s price=%s time=%s trade=%s/>",
 					executedHistoryTuple.TransactionAmount,
 					executedHistoryTuple.TransactionPrice,
-					executedHistoryTuple.TransactionTime) + "\n"
+					executedHistoryTuple.TransactionTime,
+					executedHistoryTuple.TradeId) + "\n"
 		}
 
 		c.Response =
@@ -185,17 +256,28 @@ func (c *CancelOpenOrderCommand) getResponse() string {
 }
 
 type QueryOrderStatusAndHistoryCommand struct {
+	Uid     string
 	OrderId string
+	ClOrdId string
 
-	Err      error
-	Response string
+	Err      error  `json:"-"`
+	Response string `json:"-"`
 }
 
-func (c *QueryOrderStatusAndHistoryCommand) execute(pool *redigo.Pool, readWriteLock *sync.RWMutex) {
+func (c *QueryOrderStatusAndHistoryCommand) execute(store storage.Storage, readWriteLock *sync.RWMutex) {
 	readWriteLock.RLock()
 	defer readWriteLock.RUnlock()
 
-	openOrderTuples, executedOrderHistory, cancelledOrderHistory, Err_in_query := businessLogic.QueryOrderStatusAndHistory(pool, c.OrderId)
+	if c.OrderId == "" {
+		orderId, Err_in_lookup := businessLogic.GetOrderIdByClientOrderId(store, c.Uid, c.ClOrdId)
+		if Err_in_lookup != nil {
+			c.Response = fmt.Sprintf("<error%s>%s</error>", clOrdIdAttr(c.ClOrdId), Err_in_lookup)
+			return
+		}
+		c.OrderId = orderId
+	}
+
+	openOrderTuples, executedOrderHistory, cancelledOrderHistory, Err_in_query := businessLogic.QueryOrderStatusAndHistory(store, c.Uid, c.OrderId)
 	if Err_in_query != nil {
 		c.Response = fmt.Sprintf("<error id=\"%s\">%s</error>", c.OrderId, Err_in_query)
 		return
@@ -212,10 +294,11 @@ func (c *QueryOrderStatusAndHistoryCommand) execute(pool *redigo.Pool, readWrite
 		if len(executedOrderHistory) > 0 {
 			for _, executedHistoryTuple := range executedOrderHistory {
 				executedHistoryResponse +=
-					fmt.Sprintf("  <executed shares=%s price=%s time=%s/>",
+					fmt.Sprintf("  <executed shares=%s price=%s time=%s trade=%s/>",
 						executedHistoryTuple.TransactionAmount,
 						executedHistoryTuple.TransactionPrice,
-						executedHistoryTuple.TransactionTime) + "\n"
+						executedHistoryTuple.TransactionTime,
+						executedHistoryTuple.TradeId) + "\n"
 			}
 		}
 
@@ -226,8 +309,25 @@ func (c *QueryOrderStatusAndHistoryCommand) execute(pool *redigo.Pool, readWrite
 					openOrderTuples[0].CurrentAmount) + "\n"
 		}
 
+		// details of a closed order are not available once its archive expires
+		var orderDetailAttr string
+		orderDetail, Err_in_detail := businessLogic.QueryOrderDetail(store, c.Uid, c.OrderId)
+		if Err_in_detail == nil {
+			orderDetailAttr =
+				fmt.Sprintf(" sym=\"%s\" side=\"%s\" limit=\"%s\" amount=\"%s\" time=\"%s\" state=\"%s\"",
+					orderDetail.SymbolName,
+					orderDetail.OrderType,
+					orderDetail.LimitPrice,
+					orderDetail.InitialAmount,
+					orderDetail.EntryTime,
+					orderDetail.State)
+			if orderDetail.CloseTime != "" {
+				orderDetailAttr += fmt.Sprintf(" closed=\"%s\"", orderDetail.CloseTime)
+			}
+		}
+
 		c.Response =
-			fmt.Sprintf("<status id=\"%s\">", c.OrderId) + "\n" +
+			fmt.Sprintf("<status id=\"%s\"%s>", c.OrderId, orderDetailAttr) + "\n" +
 				openOrderTupleResponse + cancelledHistoryResponse + executedHistoryResponse +
 				fmt.Sprintf("</status>")
 	}
@@ -237,20 +337,1103 @@ func (c *QueryOrderStatusAndHistoryCommand) getResponse() string {
 	return c.Response
 }
 
-type CommandListExecutor struct {
-	Pool     *redigo.Pool
-	Response string
+type QueryAccountCommand struct {
+	Uid       string
+	AccountId string
 
-	ReadWriteLock *sync.RWMutex
+	Err      error  `json:"-"`
+	Response string `json:"-"`
 }
 
-func (e *CommandListExecutor) Execute(commandList []Command) {
-	e.Response += "<results>" + "\n"
-	for _, command := range commandList {
-		command.execute(e.Pool, e.ReadWriteLock)
-		e.Response += "  " + command.getResponse() + "\n"
+func (c *QueryAccountCommand) execute(store storage.Storage, readWriteLock *sync.RWMutex) {
+	readWriteLock.RLock()
+	defer readWriteLock.RUnlock()
+
+	account, Err_in_query := businessLogic.QueryAccount(store, c.Uid, c.AccountId)
+	if Err_in_query != nil {
+		c.Response = fmt.Sprintf("<error account=\"%s\">%s</error>", c.AccountId, Err_in_query)
+		return
 	}
-	e.Response += "</results>" + "\n"
+
+	var positionResponse string
+	for _, position := range account.Positions {
+		positionResponse +=
+			fmt.Sprintf("  <position sym=\"%s\" available=\"%s\" reserved=\"%s\"/>",
+				position.SymbolName,
+				position.AvailableAmount,
+				position.ReservedAmount) + "\n"
+	}
+
+	c.Response =
+		fmt.Sprintf("<account id=\"%s\" status=\"%s\">", c.AccountId, account.Status) + "\n" +
+			fmt.Sprintf("  <balance available=\"%s\" reserved=\"%s\"/>",
+				account.AvailableBalance,
+				account.ReservedBalance) + "\n" +
+			positionResponse +
+			fmt.Sprintf("</account>")
+}
+
+func (c *QueryAccountCommand) getResponse() string {
+	return c.Response
+}
+
+type QueryAccountOrdersCommand struct {
+	Uid        string
+	Status     string
+	SymbolName string
+	OrderType  string
+	From       int64
+	To         int64
+	Cursor     string
+	Limit      int
+
+	Err      error  `json:"-"`
+	Response string `json:"-"`
+}
+
+func (c *QueryAccountOrdersCommand) execute(store storage.Storage, readWriteLock *sync.RWMutex) {
+	readWriteLock.RLock()
+	defer readWriteLock.RUnlock()
+
+	filter := businessLogic.AccountOrderFilter{
+		Status:     c.Status,
+		SymbolName: c.SymbolName,
+		OrderType:  c.OrderType,
+		From:       c.From,
+		To:         c.To,
+	}
+
+	accountOrders, nextCursor, Err_in_query := businessLogic.QueryAccountOrders(store, c.Uid, c.Uid, filter, c.Cursor, c.Limit)
+	if Err_in_query != nil {
+		c.Response = fmt.Sprintf("<error account=\"%s\">%s</error>", c.Uid, Err_in_query)
+		return
+	}
+
+	var accountOrderResponse string
+	for _, accountOrder := range accountOrders {
+		accountOrderResponse +=
+			fmt.Sprintf("  <order id=\"%s\" sym=\"%s\" side=\"%s\" limit=\"%s\" shares=\"%s\" time=\"%s\" status=\"%s\"/>",
+				accountOrder.OrderId,
+				accountOrder.SymbolName,
+				accountOrder.OrderType,
+				accountOrder.LimitPrice,
+				accountOrder.InitialAmount,
+				accountOrder.EntryTime,
+				accountOrder.Status) + "\n"
+	}
+
+	var nextCursorAttr string
+	if nextCursor != "" {
+		nextCursorAttr = fmt.Sprintf(" next=\"%s\"", nextCursor)
+	}
+
+	c.Response =
+		fmt.Sprintf("<orders account=\"%s\"%s>", c.Uid, nextCursorAttr) + "\n" +
+			accountOrderResponse +
+			fmt.Sprintf("</orders>")
+}
+
+func (c *QueryAccountOrdersCommand) getResponse() string {
+	return c.Response
+}
+
+type QueryOrderBookDepthCommand struct {
+	SymbolName string
+	Depth      int
+
+	Err      error  `json:"-"`
+	Response string `json:"-"`
+}
+
+func (c *QueryOrderBookDepthCommand) execute(store storage.Storage, readWriteLock *sync.RWMutex) {
+	readWriteLock.RLock()
+	defer readWriteLock.RUnlock()
+
+	bids, asks, Err_in_query := businessLogic.QueryOrderBookDepth(store, c.SymbolName, c.Depth)
+	if Err_in_query != nil {
+		c.Response = fmt.Sprintf("<error sym=\"%s\">%s</error>", c.SymbolName, Err_in_query)
+		return
+	}
+
+	var levelResponse string
+	for _, bid := range bids {
+		levelResponse +=
+			fmt.Sprintf("  <bid price=\"%s\" shares=\"%s\" orders=\"%s\"/>",
+				bid.Price,
+				bid.TotalAmount,
+				bid.OrderCount) + "\n"
+	}
+	for _, ask := range asks {
+		levelResponse +=
+			fmt.Sprintf("  <ask price=\"%s\" shares=\"%s\" orders=\"%s\"/>",
+				ask.Price,
+				ask.TotalAmount,
+				ask.OrderCount) + "\n"
+	}
+
+	c.Response =
+		fmt.Sprintf("<book sym=\"%s\">", c.SymbolName) + "\n" +
+			levelResponse +
+			fmt.Sprintf("</book>")
+}
+
+func (c *QueryOrderBookDepthCommand) getResponse() string {
+	return c.Response
+}
+
+type QueryOrderBookSnapshotCommand struct {
+	AdminUid   string
+	SymbolName string
+	Cursor     string
+	Limit      int
+
+	Err      error  `json:"-"`
+	Response string `json:"-"`
+}
+
+func (c *QueryOrderBookSnapshotCommand) execute(store storage.Storage, readWriteLock *sync.RWMutex) {
+	// the first page writes the snapshot, no order may be matched or cancelled while it is taken
+	if c.Cursor == "" {
+		readWriteLock.Lock()
+		defer readWriteLock.Unlock()
+	} else {
+		readWriteLock.RLock()
+		defer readWriteLock.RUnlock()
+	}
+
+	restingOrders, nextCursor, Err_in_query := businessLogic.QueryOrderBookSnapshot(store, c.AdminUid, c.SymbolName, c.Cursor, c.Limit)
+	if Err_in_query != nil {
+		c.Response = fmt.Sprintf("<error sym=\"%s\">%s</error>", c.SymbolName, Err_in_query)
+		return
+	}
+
+	var restingOrderResponse string
+	for _, restingOrder := range restingOrders {
+		restingOrderResponse +=
+			fmt.Sprintf("  <order id=\"%s\" side=\"%s\" price=\"%s\" shares=\"%s\" time=\"%s\" account=\"%s\"/>",
+				restingOrder.OrderId,
+				restingOrder.OrderType,
+				restingOrder.LimitPrice,
+				restingOrder.CurrentAmount,
+				restingOrder.EntryTime,
+				restingOrder.Uid) + "\n"
+	}
+
+	var nextCursorAttr string
+	if nextCursor != "" {
+		nextCursorAttr = fmt.Sprintf(" next=\"%s\"", nextCursor)
+	}
+
+	c.Response =
+		fmt.Sprintf("<orderbook sym=\"%s\"%s>", c.SymbolName, nextCursorAttr) + "\n" +
+			restingOrderResponse +
+			fmt.Sprintf("</orderbook>")
+}
+
+func (c *QueryOrderBookSnapshotCommand) getResponse() string {
+	return c.Response
+}
+
+type QueryTickerCommand struct {
+	SymbolName string
+
+	Err      error  `json:"-"`
+	Response string `json:"-"`
+}
+
+func (c *QueryTickerCommand) execute(store storage.Storage, readWriteLock *sync.RWMutex) {
+	readWriteLock.RLock()
+	defer readWriteLock.RUnlock()
+
+	ticker, Err_in_query := businessLogic.QueryTicker(store, c.SymbolName)
+	if Err_in_query != nil {
+		c.Response = fmt.Sprintf("<error sym=\"%s\">%s</error>", c.SymbolName, Err_in_query)
+		return
+	}
+
+	c.Response =
+		fmt.Sprintf("<ticker sym=\"%s\" bid=\"%s\" ask=\"%s\" spread=\"%s\" last=\"%s\" lastShares=\"%s\" lastTime=\"%s\" "+
+			"open=\"%s\" high=\"%s\" low=\"%s\" close=\"%s\" volume=\"%s\" notional=\"%s\"/>",
+			c.SymbolName,
+			ticker.BestBid,
+			ticker.BestAsk,
+			ticker.Spread,
+			ticker.LastPrice,
+			ticker.LastAmount,
+			ticker.LastTime,
+			ticker.Open,
+			ticker.High,
+			ticker.Low,
+			ticker.Close,
+			ticker.Volume,
+			ticker.Notional)
+}
+
+func (c *QueryTickerCommand) getResponse() string {
+	return c.Response
+}
+
+type QueryCandlesCommand struct {
+	SymbolName string
+	Interval   string
+	From       int64
+	To         int64
+
+	Err      error  `json:"-"`
+	Response string `json:"-"`
+}
+
+func (c *QueryCandlesCommand) execute(store storage.Storage, readWriteLock *sync.RWMutex) {
+	readWriteLock.RLock()
+	defer readWriteLock.RUnlock()
+
+	candles, Err_in_query := businessLogic.QueryCandles(store, c.SymbolName, c.Interval, c.From, c.To)
+	if Err_in_query != nil {
+		c.Response = fmt.Sprintf("<error sym=\"%s\" interval=\"%s\">%s</error>", c.SymbolName, c.Interval, Err_in_query)
+		return
+	}
+
+	var candleResponse string
+	for _, candle := range candles {
+		candleResponse +=
+			fmt.Sprintf("  <candle time=\"%s\" open=\"%s\" high=\"%s\" low=\"%s\" close=\"%s\" volume=\"%s\"/>",
+				candle.StartTime,
+				candle.Open,
+				candle.High,
+				candle.Low,
+				candle.Close,
+				candle.Volume) + "\n"
+	}
+
+	c.Response =
+		fmt.Sprintf("<candles sym=\"%s\" interval=\"%s\">", c.SymbolName, c.Interval) + "\n" +
+			candleResponse +
+			fmt.Sprintf("</candles>")
+}
+
+func (c *QueryCandlesCommand) getResponse() string {
+	return c.Response
+}
+
+type QueryTradesCommand struct {
+	SymbolName   string
+	SinceTradeId int
+	Limit        int
+
+	Err      error  `json:"-"`
+	Response string `json:"-"`
+}
+
+func (c *QueryTradesCommand) execute(store storage.Storage, readWriteLock *sync.RWMutex) {
+	readWriteLock.RLock()
+	defer readWriteLock.RUnlock()
+
+	trades, Err_in_query := businessLogic.QueryTrades(store, c.SymbolName, c.SinceTradeId, c.Limit)
+	if Err_in_query != nil {
+		c.Response = fmt.Sprintf("<error sym=\"%s\">%s</error>", c.SymbolName, Err_in_query)
+		return
+	}
+
+	var tradeResponse string
+	for _, trade := range trades {
+		tradeResponse +=
+			fmt.Sprintf("  <trade id=\"%s\" buy=\"%s\" sell=\"%s\" aggressor=\"%s\" price=\"%s\" shares=\"%s\" time=\"%s\"/>",
+				trade.TradeId,
+				trade.BuyOrderId,
+				trade.SellOrderId,
+				trade.Aggressor,
+				trade.Price,
+				trade.Amount,
+				trade.Time) + "\n"
+	}
+
+	c.Response =
+		fmt.Sprintf("<trades sym=\"%s\">", c.SymbolName) + "\n" +
+			tradeResponse +
+			fmt.Sprintf("</trades>")
+}
+
+func (c *QueryTradesCommand) getResponse() string {
+	return c.Response
+}
+
+type DepositCommand struct {
+	AdminUid string
+	Uid      string
+	Amount   float64
+	Reason   string
+
+	Err      error  `json:"-"`
+	Response string `json:"-"`
+}
+
+func (c *DepositCommand) execute(store storage.Storage, readWriteLock *sync.RWMutex) {
+	readWriteLock.Lock()
+	defer readWriteLock.Unlock()
+
+	movement, Err := businessLogic.Deposit(store, c.AdminUid, c.Uid, c.Amount, c.Reason)
+	if Err != nil {
+		c.Response = fmt.Sprintf("<error account=\"%s\" amount=\"%.2f\">%s</error>", c.Uid, c.Amount, Err)
+		return
+	}
+
+	c.Response = fmt.Sprintf("<deposited account=\"%s\" id=\"%s\" amount=\"%s\" balance=\"%s\" time=\"%s\"/>",
+		c.Uid,
+		movement.MovementId,
+		movement.Amount,
+		movement.Balance,
+		movement.Time)
+}
+
+func (c *DepositCommand) getResponse() string {
+	return c.Response
+}
+
+type WithdrawCommand struct {
+	Uid    string
+	Amount float64
+	Reason string
+
+	Err      error  `json:"-"`
+	Response string `json:"-"`
+}
+
+func (c *WithdrawCommand) execute(store storage.Storage, readWriteLock *sync.RWMutex) {
+	readWriteLock.Lock()
+	defer readWriteLock.Unlock()
+
+	movement, Err := businessLogic.Withdraw(store, c.Uid, c.Amount, c.Reason)
+	if Err != nil {
+		c.Response = fmt.Sprintf("<error amount=\"%.2f\">%s</error>", c.Amount, Err)
+		return
+	}
+
+	c.Response = fmt.Sprintf("<withdrawn id=\"%s\" amount=\"%s\" balance=\"%s\" time=\"%s\"/>",
+		movement.MovementId,
+		movement.Amount,
+		movement.Balance,
+		movement.Time)
+}
+
+func (c *WithdrawCommand) getResponse() string {
+	return c.Response
+}
+
+type QueryCashLedgerCommand struct {
+	Uid             string
+	SinceMovementId int
+	Limit           int
+
+	Err      error  `json:"-"`
+	Response string `json:"-"`
+}
+
+func (c *QueryCashLedgerCommand) execute(store storage.Storage, readWriteLock *sync.RWMutex) {
+	readWriteLock.RLock()
+	defer readWriteLock.RUnlock()
+
+	movements, Err_in_query := businessLogic.QueryCashLedger(store, c.Uid, c.Uid, c.SinceMovementId, c.Limit)
+	if Err_in_query != nil {
+		c.Response = fmt.Sprintf("<error account=\"%s\">%s</error>", c.Uid, Err_in_query)
+		return
+	}
+
+	var movementResponse string
+	for _, movement := range movements {
+		movementResponse +=
+			fmt.Sprintf("  <%s id=\"%s\" amount=\"%s\" balance=\"%s\" reason=\"%s\" time=\"%s\"/>",
+				movement.Type,
+				movement.MovementId,
+				movement.Amount,
+				movement.Balance,
+				html.EscapeString(movement.Reason),
+				movement.Time) + "\n"
+	}
+
+	c.Response =
+		fmt.Sprintf("<ledger account=\"%s\">", c.Uid) + "\n" +
+			movementResponse +
+			fmt.Sprintf("</ledger>")
+}
+
+func (c *QueryCashLedgerCommand) getResponse() string {
+	return c.Response
+}
+
+type QueryJournalCommand struct {
+	Uid          string
+	SinceEntryId int
+	Limit        int
+
+	Err      error  `json:"-"`
+	Response string `json:"-"`
+}
+
+func (c *QueryJournalCommand) execute(store storage.Storage, readWriteLock *sync.RWMutex) {
+	readWriteLock.RLock()
+	defer readWriteLock.RUnlock()
+
+	entries, Err_in_query := businessLogic.QueryJournal(store, c.Uid, c.Uid, c.SinceEntryId, c.Limit)
+	if Err_in_query != nil {
+		c.Response = fmt.Sprintf("<error account=\"%s\">%s</error>", c.Uid, Err_in_query)
+		return
+	}
+
+	var entryResponse string
+	for _, entry := range entries {
+		entryResponse += fmt.Sprintf("  <entry id=\"%s\" kind=\"%s\" ref=\"%s\" time=\"%s\">", entry.EntryId, entry.Kind, entry.Ref, entry.Time) + "\n"
+		for _, posting := range entry.Postings {
+			entryResponse +=
+				fmt.Sprintf("    <posting account=\"%s\" asset=\"%s\" amount=\"%s\"/>",
+					posting.LedgerAccount,
+					html.EscapeString(posting.Asset),
+					posting.Amount) + "\n"
+		}
+		entryResponse += "  </entry>" + "\n"
+	}
+
+	c.Response =
+		fmt.Sprintf("<journal account=\"%s\">", c.Uid) + "\n" +
+			entryResponse +
+			fmt.Sprintf("</journal>")
+}
+
+func (c *QueryJournalCommand) getResponse() string {
+	return c.Response
+}
+
+type ReconcileCommand struct {
+	AdminUid string
+
+	Err      error  `json:"-"`
+	Response string `json:"-"`
+}
+
+func (c *ReconcileCommand) execute(store storage.Storage, readWriteLock *sync.RWMutex) {
+	readWriteLock.RLock()
+	defer readWriteLock.RUnlock()
+
+	assetReconciliations, issues, Err_in_reconcile := businessLogic.Reconcile(store, c.AdminUid)
+	if Err_in_reconcile != nil {
+		c.Response = fmt.Sprintf("<error>%s</error>", Err_in_reconcile)
+		return
+	}
+
+	var assetResponse string
+	for _, assetReconciliation := range assetReconciliations {
+		assetResponse +=
+			fmt.Sprintf("  <asset name=\"%s\" available=\"%s\" reserved=\"%s\" deposits=\"%s\" difference=\"%s\"/>",
+				html.EscapeString(assetReconciliation.Asset),
+				assetReconciliation.Available,
+				assetReconciliation.Reserved,
+				assetReconciliation.NetDeposits,
+				assetReconciliation.Difference) + "\n"
+	}
+
+	var issueResponse string
+	for _, issue := range issues {
+		issueResponse +=
+			fmt.Sprintf("  <issue kind=\"%s\" id=\"%s\">%s</issue>",
+				issue.Kind,
+				html.EscapeString(issue.Id),
+				html.EscapeString(issue.Detail)) + "\n"
+	}
+
+	c.Response =
+		fmt.Sprintf("<reconcile ok=\"%t\">", len(issues) == 0) + "\n" +
+			assetResponse +
+			issueResponse +
+			fmt.Sprintf("</reconcile>")
+}
+
+func (c *ReconcileCommand) getResponse() string {
+	return c.Response
+}
+
+type TransferCommand struct {
+	AdminUid   string
+	FromUid    string
+	ToUid      string
+	SymbolName string
+	Amount     float64
+	Reason     string
+
+	Err      error  `json:"-"`
+	Response string `json:"-"`
+}
+
+func (c *TransferCommand) execute(store storage.Storage, readWriteLock *sync.RWMutex) {
+	readWriteLock.Lock()
+	defer readWriteLock.Unlock()
+
+	transfer, Err := businessLogic.Transfer(store, c.AdminUid, c.FromUid, c.ToUid, c.SymbolName, c.Amount, c.Reason)
+	if Err != nil {
+		c.Response = fmt.Sprintf("<error from=\"%s\" to=\"%s\" amount=\"%.2f\">%s</error>", c.FromUid, c.ToUid, c.Amount, Err)
+		return
+	}
+
+	c.Response = fmt.Sprintf("<transferred id=\"%s\" from=\"%s\" to=\"%s\" asset=\"%s\" amount=\"%s\" time=\"%s\"/>",
+		transfer.TransferId,
+		transfer.FromUid,
+		transfer.ToUid,
+		html.EscapeString(transfer.Asset),
+		transfer.Amount,
+		transfer.Time)
+}
+
+func (c *TransferCommand) getResponse() string {
+	return c.Response
+}
+
+type QueryTransfersCommand struct {
+	AdminUid        string
+	SinceTransferId int
+	Limit           int
+
+	Err      error  `json:"-"`
+	Response string `json:"-"`
+}
+
+func (c *QueryTransfersCommand) execute(store storage.Storage, readWriteLock *sync.RWMutex) {
+	readWriteLock.RLock()
+	defer readWriteLock.RUnlock()
+
+	transfers, Err_in_query := businessLogic.QueryTransfers(store, c.AdminUid, c.SinceTransferId, c.Limit)
+	if Err_in_query != nil {
+		c.Response = fmt.Sprintf("<error>%s</error>", Err_in_query)
+		return
+	}
+
+	var transferResponse string
+	for _, transfer := range transfers {
+		transferResponse +=
+			fmt.Sprintf("  <transfer id=\"%s\" admin=\"%s\" from=\"%s\" to=\"%s\" asset=\"%s\" amount=\"%s\" reason=\"%s\" time=\"%s\"/>",
+				transfer.TransferId,
+				transfer.AdminUid,
+				transfer.FromUid,
+				transfer.ToUid,
+				html.EscapeString(transfer.Asset),
+				transfer.Amount,
+				html.EscapeString(transfer.Reason),
+				transfer.Time) + "\n"
+	}
+
+	c.Response =
+		fmt.Sprintf("<transfers>") + "\n" +
+			transferResponse +
+			fmt.Sprintf("</transfers>")
+}
+
+func (c *QueryTransfersCommand) getResponse() string {
+	return c.Response
+}
+
+type FreezeAccountCommand struct {
+	AdminUid     string
+	AccountId    string
+	CancelOrders bool
+
+	Err      error  `json:"-"`
+	Response string `json:"-"`
+}
+
+func (c *FreezeAccountCommand) execute(store storage.Storage, readWriteLock *sync.RWMutex) {
+	readWriteLock.Lock()
+	defer readWriteLock.Unlock()
+
+	cancelledOrderIds, Err := businessLogic.FreezeAccount(store, c.AdminUid, c.AccountId, c.CancelOrders)
+	if Err != nil {
+		c.Response = fmt.Sprintf("<error account=\"%s\">%s</error>", c.AccountId, Err)
+		return
+	}
+
+	var cancelledResponse string
+	for _, orderId := range cancelledOrderIds {
+		cancelledResponse += fmt.Sprintf("  <canceled id=\"%s\"/>", orderId) + "\n"
+	}
+
+	c.Response =
+		fmt.Sprintf("<frozen account=\"%s\">", c.AccountId) + "\n" +
+			cancelledResponse +
+			fmt.Sprintf("</frozen>")
+}
+
+func (c *FreezeAccountCommand) getResponse() string {
+	return c.Response
+}
+
+type UnfreezeAccountCommand struct {
+	AdminUid  string
+	AccountId string
+
+	Err      error  `json:"-"`
+	Response string `json:"-"`
+}
+
+func (c *UnfreezeAccountCommand) execute(store storage.Storage, readWriteLock *sync.RWMutex) {
+	readWriteLock.Lock()
+	defer readWriteLock.Unlock()
+
+	Err := businessLogic.UnfreezeAccount(store, c.AdminUid, c.AccountId)
+	if Err != nil {
+		c.Response = fmt.Sprintf("<error account=\"%s\">%s</error>", c.AccountId, Err)
+		return
+	}
+
+	c.Response = fmt.Sprintf("<unfrozen account=\"%s\"/>", c.AccountId)
+}
+
+func (c *UnfreezeAccountCommand) getResponse() string {
+	return c.Response
+}
+
+type CloseAccountCommand struct {
+	AdminUid  string
+	AccountId string
+
+	Err      error  `json:"-"`
+	Response string `json:"-"`
+}
+
+func (c *CloseAccountCommand) execute(store storage.Storage, readWriteLock *sync.RWMutex) {
+	readWriteLock.Lock()
+	defer readWriteLock.Unlock()
+
+	Err := businessLogic.CloseAccount(store, c.AdminUid, c.AccountId)
+	if Err != nil {
+		c.Response = fmt.Sprintf("<error account=\"%s\">%s</error>", c.AccountId, Err)
+		return
+	}
+
+	c.Response = fmt.Sprintf("<closed account=\"%s\"/>", c.AccountId)
+}
+
+func (c *CloseAccountCommand) getResponse() string {
+	return c.Response
+}
+
+type CreateApiKeyCommand struct {
+	AdminUid  string
+	AccountId string
+	// generated before the command is journaled, so a replay stores the same key
+	KeyId  string
+	Secret string
+
+	Err      error  `json:"-"`
+	Response string `json:"-"`
+}
+
+// generateKey generates the id and the secret of the key, if they are not generated yet
+func (c *CreateApiKeyCommand) generateKey() error {
+	if c.KeyId != "" {
+		return nil
+	}
+	var Err error
+	c.KeyId, c.Secret, Err = businessLogic.GenerateApiKey()
+	return Err
+}
+
+func (c *CreateApiKeyCommand) execute(store storage.Storage, readWriteLock *sync.RWMutex) {
+	readWriteLock.Lock()
+	defer readWriteLock.Unlock()
+
+	Err := c.generateKey()
+	if Err != nil {
+		c.Response = fmt.Sprintf("<error account=\"%s\">%s</error>", c.AccountId, Err)
+		return
+	}
+
+	apiKey, Err := businessLogic.CreateApiKey(store, c.AdminUid, c.AccountId, c.KeyId, c.Secret)
+	if Err != nil {
+		c.Response = fmt.Sprintf("<error account=\"%s\">%s</error>", c.AccountId, Err)
+		return
+	}
+
+	c.Response = fmt.Sprintf("<apikey id=\"%s\" account=\"%s\" secret=\"%s\"/>", apiKey.KeyId, apiKey.Uid, apiKey.Secret)
+}
+
+func (c *CreateApiKeyCommand) getResponse() string {
+	return c.Response
+}
+
+type RevokeApiKeyCommand struct {
+	AdminUid string
+	KeyId    string
+
+	Err      error  `json:"-"`
+	Response string `json:"-"`
+}
+
+func (c *RevokeApiKeyCommand) execute(store storage.Storage, readWriteLock *sync.RWMutex) {
+	readWriteLock.Lock()
+	defer readWriteLock.Unlock()
+
+	Err := businessLogic.RevokeApiKey(store, c.AdminUid, c.KeyId)
+	if Err != nil {
+		c.Response = fmt.Sprintf("<error key=\"%s\">%s</error>", html.EscapeString(c.KeyId), Err)
+		return
+	}
+
+	c.Response = fmt.Sprintf("<revoked key=\"%s\"/>", html.EscapeString(c.KeyId))
+}
+
+func (c *RevokeApiKeyCommand) getResponse() string {
+	return c.Response
+}
+
+type SetRateLimitsCommand struct {
+	AdminUid  string
+	AccountId string
+	Limits    map[string]int
+
+	Err      error  `json:"-"`
+	Response string `json:"-"`
+}
+
+func (c *SetRateLimitsCommand) execute(store storage.Storage, readWriteLock *sync.RWMutex) {
+	readWriteLock.Lock()
+	defer readWriteLock.Unlock()
+
+	Err := businessLogic.SetRateLimits(store, c.AdminUid, c.AccountId, c.Limits)
+	if Err != nil {
+		c.Response = fmt.Sprintf("<error account=\"%s\">%s</error>", c.AccountId, Err)
+		return
+	}
+
+	c.Response = fmt.Sprintf("<ratelimit account=\"%s\"/>", c.AccountId)
+}
+
+func (c *SetRateLimitsCommand) getResponse() string {
+	return c.Response
+}
+
+type QueryRateStatsCommand struct {
+	AdminUid  string
+	AccountId string
+
+	Err      error  `json:"-"`
+	Response string `json:"-"`
+}
+
+func (c *QueryRateStatsCommand) execute(store storage.Storage, readWriteLock *sync.RWMutex) {
+	readWriteLock.RLock()
+	defer readWriteLock.RUnlock()
+
+	statsList, Err := businessLogic.QueryRateStats(store, c.AdminUid, c.AccountId)
+	if Err != nil {
+		c.Response = fmt.Sprintf("<error>%s</error>", Err)
+		return
+	}
+
+	var statsResponse string
+	for _, stats := range statsList {
+		statsResponse += fmt.Sprintf("  <account id=\"%s\">", stats.Uid) + "\n"
+		for _, kind := range businessLogic.RATE_LIMIT_KINDS {
+			statsResponse +=
+				fmt.Sprintf("    <%s accepted=\"%s\" throttled=\"%s\"/>",
+					kind,
+					stats.Accepted[kind],
+					stats.Throttled[kind]) + "\n"
+		}
+		statsResponse += fmt.Sprintf("  </account>") + "\n"
+	}
+
+	c.Response =
+		fmt.Sprintf("<throttles>") + "\n" +
+			statsResponse +
+			fmt.Sprintf("</throttles>")
+}
+
+func (c *QueryRateStatsCommand) getResponse() string {
+	return c.Response
+}
+
+type SetRiskLimitsCommand struct {
+	AdminUid      string
+	AccountId     string
+	SymbolName    string
+	MaxAmount     float64
+	MaxNotional   float64
+	MaxOpenOrders int
+	MaxGross      float64
+	MaxNet        float64
+
+	Err      error  `json:"-"`
+	Response string `json:"-"`
+}
+
+func (c *SetRiskLimitsCommand) execute(store storage.Storage, readWriteLock *sync.RWMutex) {
+	readWriteLock.Lock()
+	defer readWriteLock.Unlock()
+
+	Err := businessLogic.SetRiskLimits(store, c.AdminUid, c.AccountId, c.SymbolName,
+		businessLogic.RiskLimitTuple{
+			MaxOrderAmount:   c.MaxAmount,
+			MaxOrderNotional: c.MaxNotional,
+			MaxOpenOrders:    c.MaxOpenOrders,
+			MaxGrossPosition: c.MaxGross,
+			MaxNetPosition:   c.MaxNet})
+	if Err != nil {
+		c.Response = fmt.Sprintf("<error account=\"%s\" sym=\"%s\">%s</error>", c.AccountId, c.SymbolName, Err)
+		return
+	}
+
+	c.Response = fmt.Sprintf("<risklimit account=\"%s\" sym=\"%s\"/>", c.AccountId, c.SymbolName)
+}
+
+func (c *SetRiskLimitsCommand) getResponse() string {
+	return c.Response
+}
+
+type QueryRiskLimitsCommand struct {
+	AdminUid   string
+	AccountId  string
+	SymbolName string
+
+	Err      error  `json:"-"`
+	Response string `json:"-"`
+}
+
+func (c *QueryRiskLimitsCommand) execute(store storage.Storage, readWriteLock *sync.RWMutex) {
+	readWriteLock.RLock()
+	defer readWriteLock.RUnlock()
+
+	limits, Err := businessLogic.QueryRiskLimits(store, c.AdminUid, c.AccountId, c.SymbolName)
+	if Err != nil {
+		c.Response = fmt.Sprintf("<error account=\"%s\" sym=\"%s\">%s</error>", c.AccountId, c.SymbolName, Err)
+		return
+	}
+
+	c.Response = fmt.Sprintf("<risklimits account=\"%s\" sym=\"%s\" maxAmount=\"%s\" maxNotional=\"%s\" maxOpenOrders=\"%d\" maxGross=\"%s\" maxNet=\"%s\"/>",
+		c.AccountId,
+		c.SymbolName,
+		strconv.FormatFloat(limits.MaxOrderAmount, 'f', -1, 64),
+		strconv.FormatFloat(limits.MaxOrderNotional, 'f', -1, 64),
+		limits.MaxOpenOrders,
+		strconv.FormatFloat(limits.MaxGrossPosition, 'f', -1, 64),
+		strconv.FormatFloat(limits.MaxNetPosition, 'f', -1, 64))
+}
+
+func (c *QueryRiskLimitsCommand) getResponse() string {
+	return c.Response
+}
+
+type SetAccountGroupCommand struct {
+	AdminUid  string
+	AccountId string
+	GroupName string
+
+	Err      error  `json:"-"`
+	Response string `json:"-"`
+}
+
+func (c *SetAccountGroupCommand) execute(store storage.Storage, readWriteLock *sync.RWMutex) {
+	readWriteLock.Lock()
+	defer readWriteLock.Unlock()
+
+	Err := businessLogic.SetAccountGroup(store, c.AdminUid, c.AccountId, c.GroupName)
+	if Err != nil {
+		c.Response = fmt.Sprintf("<error account=\"%s\">%s</error>", c.AccountId, Err)
+		return
+	}
+
+	c.Response = fmt.Sprintf("<group account=\"%s\" name=\"%s\"/>", c.AccountId, html.EscapeString(c.GroupName))
+}
+
+func (c *SetAccountGroupCommand) getResponse() string {
+	return c.Response
+}
+
+type KillSwitchCommand struct {
+	AdminUid  string
+	AccountId string
+	GroupName string
+	Release   bool
+	Reason    string
+
+	Err      error  `json:"-"`
+	Response string `json:"-"`
+}
+
+func (c *KillSwitchCommand) execute(store storage.Storage, readWriteLock *sync.RWMutex) {
+	readWriteLock.Lock()
+	defer readWriteLock.Unlock()
+
+	var event businessLogic.KillSwitchEventTuple
+	var Err error
+	if c.Release {
+		event, Err = businessLogic.ReleaseKillSwitch(store, c.AdminUid, c.AccountId, c.GroupName, c.Reason)
+	} else {
+		event, Err = businessLogic.EngageKillSwitch(store, c.AdminUid, c.AccountId, c.GroupName, c.Reason)
+	}
+	if Err != nil {
+		c.Response = fmt.Sprintf("<error account=\"%s\" group=\"%s\">%s</error>", c.AccountId, html.EscapeString(c.GroupName), Err)
+		// a partial engage is recorded, with the orders it cancelled
+		if event.EventId != "" {
+			c.Response += "\n  " + killSwitchEventResponse(event, "  ")
+		}
+		return
+	}
+
+	c.Response = killSwitchEventResponse(event, "")
+}
+
+func (c *KillSwitchCommand) getResponse() string {
+	return c.Response
+}
+
+type QueryKillSwitchEventsCommand struct {
+	AdminUid     string
+	SinceEventId int
+	Limit        int
+
+	Err      error  `json:"-"`
+	Response string `json:"-"`
+}
+
+func (c *QueryKillSwitchEventsCommand) execute(store storage.Storage, readWriteLock *sync.RWMutex) {
+	readWriteLock.RLock()
+	defer readWriteLock.RUnlock()
+
+	events, Err_in_query := businessLogic.QueryKillSwitchEvents(store, c.AdminUid, c.SinceEventId, c.Limit)
+	if Err_in_query != nil {
+		c.Response = fmt.Sprintf("<error>%s</error>", Err_in_query)
+		return
+	}
+
+	var eventResponse string
+	for _, event := range events {
+		eventResponse += killSwitchEventResponse(event, "  ") + "\n"
+	}
+
+	c.Response =
+		fmt.Sprintf("<killswitches>") + "\n" +
+			eventResponse +
+			fmt.Sprintf("</killswitches>")
+}
+
+func (c *QueryKillSwitchEventsCommand) getResponse() string {
+	return c.Response
+}
+
+func killSwitchEventResponse(event businessLogic.KillSwitchEventTuple, indent string) string {
+	errorAttr := ""
+	if event.Error != "" {
+		errorAttr = fmt.Sprintf(" error=\"%s\"", html.EscapeString(event.Error))
+	}
+	response := fmt.Sprintf("%s<killswitch id=\"%s\" admin=\"%s\" target=\"%s\" action=\"%s\" reason=\"%s\" time=\"%s\"%s>",
+		indent,
+		event.EventId,
+		event.AdminUid,
+		html.EscapeString(event.Target),
+		event.Action,
+		html.EscapeString(event.Reason),
+		event.Time,
+		errorAttr) + "\n"
+	for _, orderId := range event.CancelledOrderIds {
+		response += fmt.Sprintf("%s  <canceled id=\"%s\"/>", indent, orderId) + "\n"
+	}
+	return response + fmt.Sprintf("%s</killswitch>", indent)
+}
+
+// ThrottledCommand replaces a command rejected by a rate limit, it only reports the error
+type ThrottledCommand struct {
+	Err      error  `json:"-"`
+	Response string `json:"-"`
+}
+
+func (c *ThrottledCommand) execute(store storage.Storage, readWriteLock *sync.RWMutex) {
+}
+
+func (c *ThrottledCommand) getResponse() string {
+	return c.Response
+}
+
+/*
+		ApplyRateLimits replaces the commands of a connection rejected by the limits of account uid with ThrottledCommand,
+		it should be called before the commands are executed.
+		Commands after the limit of messages per connection are throttled, then orders and cancels are checked against the per second limits.
+*/
+func ApplyRateLimits(store storage.Storage, uid string, commandList []Command) []Command {
+	accepted, Err := businessLogic.CheckMessageLimit(store, uid, len(commandList))
+	if Err != nil {
+		accepted = 0
+	}
+
+	limitedCommandList := make([]Command, len(commandList))
+	for i, command := range commandList {
+		if i >= accepted {
+			if Err == nil {
+				Err = fmt.Errorf("throttled: more than %d messages per connection", accepted)
+			}
+			limitedCommandList[i] = &ThrottledCommand{Err: Err, Response: fmt.Sprintf("<error>%s</error>", Err)}
+			continue
+		}
+
+		limitedCommandList[i] = command
+		switch c := command.(type) {
+		case *SetBuyOrderCommand:
+			if Err_in_limit := businessLogic.CheckRateLimit(store, uid, businessLogic.RATE_LIMIT_KIND_ORDERS); Err_in_limit != nil {
+				limitedCommandList[i] = &ThrottledCommand{Err: Err_in_limit,
+					Response: fmt.Sprintf("<error sym=\"%s\" Amount=\"%.2f\" limit=\"%.2f\"%s >%s</error>", c.SymbolName, c.Amount, c.LimitPrice, clOrdIdAttr(c.ClOrdId), Err_in_limit)}
+			}
+		case *SetSellOrderCommand:
+			if Err_in_limit := businessLogic.CheckRateLimit(store, uid, businessLogic.RATE_LIMIT_KIND_ORDERS); Err_in_limit != nil {
+				limitedCommandList[i] = &ThrottledCommand{Err: Err_in_limit,
+					Response: fmt.Sprintf("<error sym=\"%s\" Amount=\"%.2f\" limit=\"%.2f\"%s >%s</error>", c.SymbolName, -c.Amount, c.LimitPrice, clOrdIdAttr(c.ClOrdId), Err_in_limit)}
+			}
+		case *CancelOpenOrderCommand:
+			if Err_in_limit := businessLogic.CheckRateLimit(store, uid, businessLogic.RATE_LIMIT_KIND_CANCELS); Err_in_limit != nil {
+				limitedCommandList[i] = &ThrottledCommand{Err: Err_in_limit,
+					Response: fmt.Sprintf("<error id=\"%s\"%s>%s</error>", c.OrderId, clOrdIdAttr(c.ClOrdId), Err_in_limit)}
+			}
+		}
+	}
+	return limitedCommandList
+}
+
+type CommandListExecutor struct {
+	Pool     storage.Storage
+	Response string
+
+	ReadWriteLock *sync.RWMutex
+	// commands which change the state are written to Journal before they are executed, nil to not journal them
+	Journal *CommandJournal
+}
+
+func (e *CommandListExecutor) Execute(commandList []Command) {
+	e.Response += "<results>" + "\n"
+	for _, command := range commandList {
+		e.Response += "  " + e.executeCommand(command) + "\n"
+	}
+	e.Response += "</results>" + "\n"
+}
+
+// executeCommand executes a command, after writing it to the journal if it changes the state, and returns its response
+func (e *CommandListExecutor) executeCommand(command Command) string {
+	name := journaledCommandName(command)
+	if e.Journal == nil || name == "" {
+		command.execute(e.Pool, e.ReadWriteLock)
+		return command.getResponse()
+	}
+
+	// the random key of a new api key is journaled with the command
+	if createApiKey, isCreateApiKey := command.(*CreateApiKeyCommand); isCreateApiKey {
+		Err := createApiKey.generateKey()
+		if Err != nil {
+			return fmt.Sprintf("<error account=\"%s\">%s</error>", createApiKey.AccountId, Err)
+		}
+	}
+
+	e.Journal.lock.Lock()
+	defer e.Journal.lock.Unlock()
+
+	entry, Err := e.Journal.append(name, command)
+	if Err != nil {
+		return fmt.Sprintf("<error>error when writing the command journal: %s</error>", Err)
+	}
+	executeAt(command, entry.Time, e.Pool, e.ReadWriteLock)
+	return command.getResponse()
 }
 
 func (e *CommandListExecutor) GetResponse() string {
@@ -275,7 +1458,7 @@ func (e *CommandListExecutor) GetResponse() string {
 // 	defer connection.Close()
 // 	conn := (&connection)
 
-// 	redis.FlushAll(conn)
+// 	conn.FlushAll()
 
 // 	c1 := &CreateAccoutCommand{Uid: "12345", Balance: 10000}
 // 	c1.execute(pool)
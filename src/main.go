@@ -1,11 +1,18 @@
 package main
 
 import (
+	"flag"
+
 	"app/TCPserver"
+	"app/businessLogic"
 	"app/command"
 	"app/redis"
+	"app/storage"
 	"app/xmlParser"
 
+	"os"
+	"strings"
+
 	"sync"
 	"fmt"
 	"net"
@@ -14,30 +21,169 @@ import (
 )
 
 func main() {
-	// redis pool
-	// runtime.GOMAXPROCS(4)
-	redisPool := redis.NewRConnectionPool(
-		redis.Config{
-			Server:              "redis:6379",
-			Password:            "",
-			MaxIdle:             100,
-			MaxActive:           12000,
-			IdleTimeout:         240 * time.Second,
-			KEY_PREFIX:          "",
-			KEY_DELIMITER:       "",
-			KEY_VAR_PLACEHOLDER: "",
-		},
-	)
+	orderArchiveRetention := flag.Duration("order-archive-retention", businessLogic.OrderArchiveRetention,
+		"how long a filled or cancelled order is kept for status queries, 0 to keep it forever")
+	clientOrderIdRetention := flag.Duration("client-order-id-retention", businessLogic.ClientOrderIdRetention,
+		"how long a clOrdId is remembered to answer resubmitted orders, 0 to remember it forever")
+	maxOrdersPerSecond := flag.Int("max-orders-per-second", businessLogic.MaxOrdersPerSecond,
+		"default limit of new orders per second of an account, 0 for unlimited")
+	maxCancelsPerSecond := flag.Int("max-cancels-per-second", businessLogic.MaxCancelsPerSecond,
+		"default limit of cancels per second of an account, 0 for unlimited")
+	maxMessagesPerConnection := flag.Int("max-messages-per-connection", businessLogic.MaxMessagesPerConnection,
+		"default limit of messages in a connection of an account, 0 for unlimited")
+	storageBackend := flag.String("storage", "write-behind",
+		"where the exchange state is kept: write-behind to match in memory and persist to Redis asynchronously, redis, "+
+			"or memory to run without a Redis server, the state is lost when the engine stops")
+	writeBehindQueue := flag.String("write-behind-queue", "write-behind.queue",
+		"file of the writes not persisted to Redis yet with -storage=write-behind")
+	commandJournalPath := flag.String("command-journal", "",
+		"directory to journal every command which changes the state before it is executed, empty to not journal them")
+	recoverFromJournal := flag.Bool("recover", false,
+		"rebuild the state from the latest snapshot and the command journal after it into an empty store before accepting connections")
+	reset := flag.Bool("reset", false,
+		"wipe every account, order and history, and the command journal unless -recover rebuilds from it, before starting, for test environments")
+	snapshotInterval := flag.Duration("snapshot-interval", 5*time.Minute,
+		"how often a snapshot of the state is written to the command journal directory, 0 to not write snapshots")
+	flag.Parse()
+	businessLogic.OrderArchiveRetention = *orderArchiveRetention
+	businessLogic.ClientOrderIdRetention = *clientOrderIdRetention
+	businessLogic.MaxOrdersPerSecond = *maxOrdersPerSecond
+	businessLogic.MaxCancelsPerSecond = *maxCancelsPerSecond
+	businessLogic.MaxMessagesPerConnection = *maxMessagesPerConnection
+
+	var store storage.Storage
+	switch *storageBackend {
+	case "redis":
+		store = newRedisStorage()
+	case "write-behind":
+		var err error
+		store, err = storage.OpenWriteBehindStorage(newRedisStorage(), *writeBehindQueue)
+		if err != nil {
+			fmt.Println("err: ", err)
+			os.Exit(1)
+		}
+	case "memory":
+		store = storage.NewMemoryStorage()
+	default:
+		fmt.Println("err: unknown storage ", *storageBackend)
+		os.Exit(2)
+	}
+
+	// the data of the previous run is kept, unless -reset
+	conn := store.Get()
+	if *reset {
+		fmt.Println("reset: wiping every account, order and history")
+		err := conn.FlushAll()
+		if err != nil {
+			fmt.Println("err: ", err)
+			os.Exit(1)
+		}
+		// with -recover the journal is the source the state is rebuilt from, it is kept
+		if *commandJournalPath != "" && !*recoverFromJournal {
+			err = os.RemoveAll(*commandJournalPath)
+			if err != nil {
+				fmt.Println("err: ", err)
+				os.Exit(1)
+			}
+		}
+	}
+	keys, err := conn.Scan("*")
+	conn.Close()
+	if err != nil {
+		fmt.Println("err: ", err)
+		os.Exit(1)
+	}
+	storeIsEmpty := len(keys) == 0
+	if *recoverFromJournal && !storeIsEmpty {
+		fmt.Println("err: -recover needs an empty store, start with -reset -recover to wipe the store and rebuild it from the command journal, the journal is kept")
+		os.Exit(1)
+	}
+
+	// command journal
+	var commandJournal *command.CommandJournal
+	var journalEntries []command.CommandJournalEntry
+	var snapshot command.CommandJournalSnapshot
+	if *commandJournalPath != "" {
+		commandJournal, journalEntries, err = command.OpenCommandJournal(*commandJournalPath)
+		if err != nil {
+			fmt.Println("err: ", err)
+			os.Exit(1)
+		}
+		var snapshotFound bool
+		snapshot, snapshotFound, err = commandJournal.ReadSnapshot()
+		if err != nil {
+			fmt.Println("err: ", err)
+			os.Exit(1)
+		}
+		// the journal continues the data kept in the store, an empty store lost it
+		if (len(journalEntries) > 0 || snapshotFound) && storeIsEmpty && !*recoverFromJournal {
+			fmt.Println("err: the store is empty and the command journal is not, start with -recover to rebuild the state from it")
+			os.Exit(1)
+		}
+	} else if *recoverFromJournal {
+		fmt.Println("err: -recover needs -command-journal")
+		os.Exit(2)
+	}
+	if *recoverFromJournal {
+		err = command.RestoreSnapshot(store, snapshot)
+		if err != nil {
+			fmt.Println("err: ", err)
+			os.Exit(1)
+		}
+	}
+
+	// schema version, the journal is replayed on the current schema
+	version, err := businessLogic.MigrateSchema(store)
+	if err != nil {
+		fmt.Println("err: ", err)
+		os.Exit(1)
+	}
+	if version != businessLogic.SCHEMA_VERSION {
+		fmt.Println("migrated the schema from version", version, "to", businessLogic.SCHEMA_VERSION)
+	}
 
-	_ = redisPool
+	// admin accounts, eg: EXCHANGE_ADMIN_ACCOUNTS=1,2
+	for _, adminUid := range strings.Split(os.Getenv("EXCHANGE_ADMIN_ACCOUNTS"), ",") {
+		if adminUid == "" {
+			continue
+		}
+		err := businessLogic.RegisterAdminAccount(store, adminUid)
+		if err != nil {
+			fmt.Println("err: ", err)
+		}
+	}
 
-	connection := redisPool.Get()
-	conn := &connection
-	redis.FlushAll(conn)
-	connection.Close()
+	// admin api keys, eg: EXCHANGE_ADMIN_API_KEYS=keyId1:1:secret1,keyId2:2:secret2
+	for _, adminApiKey := range strings.Split(os.Getenv("EXCHANGE_ADMIN_API_KEYS"), ",") {
+		if adminApiKey == "" {
+			continue
+		}
+		keyFields := strings.SplitN(adminApiKey, ":", 3)
+		if len(keyFields) != 3 {
+			fmt.Println("err: invalid admin api key ", keyFields[0])
+			continue
+		}
+		err := businessLogic.RegisterApiKey(store, keyFields[0], keyFields[1], keyFields[2], true)
+		if err != nil {
+			fmt.Println("err: ", err)
+		}
+	}
 
+	// the admin accounts are registered before the replay, admin commands in the journal are checked against them
+	if *recoverFromJournal {
+		err = command.ReplayCommandJournal(store, journalEntries, snapshot.Sequence)
+		if err != nil {
+			fmt.Println("err: ", err)
+			os.Exit(1)
+		}
+		fmt.Println("recovered the snapshot of entry", snapshot.Sequence, "and", len(journalEntries), "entries of the command journal")
+	}
 	var readWriteLock sync.RWMutex
 
+	if commandJournal != nil && *snapshotInterval > 0 {
+		commandJournal.StartSnapshotter(store, &readWriteLock, *snapshotInterval)
+	}
+
 	// TCPserver
 	server := TCPserver.NewTCPServer(":12345") // set to current ip address (not localhost address)
 
@@ -46,9 +192,19 @@ func main() {
 	}
 
 	server.OnConnectionRecievedNewRequestCallback = func(conn *net.Conn, request []byte) {
-		xmlParser := xmlParser.XmlParser{}
+		keyId, nonce, timestamp, signature, request_in_string, err := businessLogic.SplitSignedRequest(string(request))
+		if err != nil {
+			(*conn).Write([]byte(fmt.Sprintf("%s", err)))
+			return
+		}
 
-		request_in_string := string(request)
+		apiKey, err := businessLogic.AuthenticateRequest(store, keyId, nonce, timestamp, signature, request_in_string)
+		if err != nil {
+			(*conn).Write([]byte(fmt.Sprintf("%s", err)))
+			return
+		}
+
+		xmlParser := xmlParser.XmlParser{Uid: apiKey.Uid, Admin: apiKey.Admin}
 
 		commandList, err := xmlParser.Parse(request_in_string)
 		if err != nil {
@@ -56,7 +212,9 @@ func main() {
 			return
 		}
 
-		commandExecutor := command.CommandListExecutor{Pool: redisPool, ReadWriteLock: &readWriteLock}
+		commandList = command.ApplyRateLimits(store, apiKey.Uid, commandList)
+
+		commandExecutor := command.CommandListExecutor{Pool: store, ReadWriteLock: &readWriteLock, Journal: commandJournal}
 		commandExecutor.Execute(commandList)
 		response_in_string := commandExecutor.GetResponse()
 
@@ -72,3 +230,21 @@ func main() {
 
 	server.Listen()
 }
+
+func newRedisStorage() *storage.RedisStorage {
+	// redis pool
+	// runtime.GOMAXPROCS(4)
+	redisPool := redis.NewRConnectionPool(
+		redis.Config{
+			Server:              "redis:6379",
+			Password:            "",
+			MaxIdle:             100,
+			MaxActive:           12000,
+			IdleTimeout:         240 * time.Second,
+			KEY_PREFIX:          "",
+			KEY_DELIMITER:       "",
+			KEY_VAR_PLACEHOLDER: "",
+		},
+	)
+	return storage.NewRedisStorage(redisPool)
+}
@@ -0,0 +1,310 @@
+package redis
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// commands a Transaction queues until Commit, every other command is a read and is sent right away
+var queuedCommands = map[string]bool{
+	"HSET": true, "HMSET": true, "HINCRBYFLOAT": true, "HINCRBY": true, "HDEL": true,
+	"SET": true, "DEL": true, "RENAME": true, "EXPIRE": true, "FLUSHALL": true,
+	"ZADD": true, "ZREM": true, "ZREMRANGEBYSCORE": true,
+	"SADD": true, "SREM": true, "LPUSH": true, "RPUSH": true,
+}
+
+// commands a Transaction sends right away even though they write, their reply is needed before Commit
+// INCR only generates ids, an id generated by a discarded transaction is skipped
+var passThroughWriteCommands = map[string]bool{
+	"INCR": true,
+}
+
+// Transaction is a redis.Conn which queues writes and sends them together in MULTI/EXEC on Commit.
+// Nothing is applied if the step fails, or the connection fails or the process stops before EXEC,
+// and EXEC runs the writes together, no other client runs a command in between.
+// Redis does NOT roll back: a write which fails when EXEC runs it (eg: a key of the wrong type) is skipped,
+// the other writes are still applied, and Commit returns its error.
+//
+// Reads are sent right away, so they see the data before the transaction.
+// HGET, HMGET, HINCRBY and HINCRBYFLOAT on a hash field written by the transaction see the written value,
+// any other read of a key written by the transaction returns an error, since its reply would not include the writes.
+// Use it with a lock held, so no other client writes the keys between the reads and Commit.
+type Transaction struct {
+	conn    redis.Conn
+	queued  [][]interface{}
+	fields  map[string]map[string]*string // hash fields written by the transaction, nil for a deleted field
+	deleted map[string]bool               // keys deleted or renamed by the transaction
+	written map[string]bool               // keys written by the transaction which can not be read any more
+	flushed bool                          // every key is deleted by the transaction
+}
+
+// NewTransaction starts a transaction on conn
+func NewTransaction(conn *redis.Conn) *Transaction {
+	return &Transaction{
+		conn:    *conn,
+		fields:  map[string]map[string]*string{},
+		deleted: map[string]bool{},
+		written: map[string]bool{},
+	}
+}
+
+// Do queues a write and returns its expected reply, or sends a read and returns its reply
+func (t *Transaction) Do(commandName string, args ...interface{}) (interface{}, error) {
+	if passThroughWriteCommands[commandName] {
+		return t.conn.Do(commandName, args...)
+	}
+	if !queuedCommands[commandName] {
+		return t.read(commandName, args...)
+	}
+	if commandName == "FLUSHALL" {
+		t.flushed = true
+		t.queued = append(t.queued, []interface{}{commandName})
+		return "OK", nil
+	}
+	if len(args) == 0 {
+		return nil, fmt.Errorf("transaction: %s without key", commandName)
+	}
+
+	key := formatArg(args[0])
+	var reply interface{} = "OK"
+	switch commandName {
+	case "HSET", "HMSET":
+		for i := 1; i+1 < len(args); i += 2 {
+			t.setField(key, formatArg(args[i]), formatArg(args[i+1]))
+		}
+	case "HDEL":
+		for _, field := range args[1:] {
+			t.deleteField(key, formatArg(field))
+		}
+	case "HINCRBY", "HINCRBYFLOAT":
+		if len(args) != 3 {
+			return nil, fmt.Errorf("transaction: wrong number of arguments for %s", commandName)
+		}
+		field := formatArg(args[1])
+		current, err := t.field(key, field)
+		if err != nil {
+			return nil, err
+		}
+		if commandName == "HINCRBY" {
+			var value, increment int64
+			value, err = parseIntOrZero(current)
+			if err == nil {
+				increment, err = strconv.ParseInt(formatArg(args[2]), 10, 64)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("transaction: %s %s %s: %v", commandName, key, field, err)
+			}
+			t.setField(key, field, strconv.FormatInt(value+increment, 10))
+			reply = value + increment
+		} else {
+			var value, increment float64
+			value, err = parseFloatOrZero(current)
+			if err == nil {
+				increment, err = strconv.ParseFloat(formatArg(args[2]), 64)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("transaction: %s %s %s: %v", commandName, key, field, err)
+			}
+			result := strconv.FormatFloat(value+increment, 'f', -1, 64)
+			t.setField(key, field, result)
+			reply = []byte(result)
+		}
+	case "DEL":
+		for _, deletedKey := range args {
+			t.deleteKey(formatArg(deletedKey))
+		}
+		reply = int64(1)
+	case "SET":
+		if len(args) != 2 {
+			return nil, fmt.Errorf("transaction: SET with options is not supported")
+		}
+		t.deleteKey(key)
+		t.written[key] = true
+	case "RENAME":
+		if len(args) != 2 {
+			return nil, fmt.Errorf("transaction: wrong number of arguments for %s", commandName)
+		}
+		t.deleteKey(key)
+		t.written[formatArg(args[1])] = true
+	default:
+		t.written[key] = true
+		reply = int64(1)
+	}
+
+	t.queued = append(t.queued, append([]interface{}{commandName}, args...))
+	return reply, nil
+}
+
+// read sends a read, it fails if the reply could miss a write of the transaction
+func (t *Transaction) read(commandName string, args ...interface{}) (interface{}, error) {
+	if t.flushed {
+		return nil, fmt.Errorf("transaction: %s after FLUSHALL in the same transaction", commandName)
+	}
+	if len(args) == 0 {
+		return t.conn.Do(commandName, args...)
+	}
+	key := formatArg(args[0])
+	if t.written[key] {
+		return nil, fmt.Errorf("transaction: %s of key %s written in the same transaction", commandName, key)
+	}
+	_, fieldsWritten := t.fields[key]
+
+	switch {
+	case commandName == "HGET" && len(args) == 2:
+		value, err := t.field(key, formatArg(args[1]))
+		if err != nil || value == nil {
+			return nil, err
+		}
+		return []byte(*value), nil
+	case commandName == "HMGET":
+		values := make([]interface{}, len(args)-1)
+		for i, field := range args[1:] {
+			value, err := t.field(key, formatArg(field))
+			if err != nil {
+				return nil, err
+			}
+			if value != nil {
+				values[i] = []byte(*value)
+			}
+		}
+		return values, nil
+	case t.deleted[key] || fieldsWritten:
+		return nil, fmt.Errorf("transaction: %s of key %s written in the same transaction", commandName, key)
+	}
+	return t.conn.Do(commandName, args...)
+}
+
+// field returns the value of a hash field as the transaction would leave it, nil if the field does not exist
+func (t *Transaction) field(key string, field string) (*string, error) {
+	if value, written := t.fields[key][field]; written {
+		return value, nil
+	}
+	if t.deleted[key] || t.flushed {
+		return nil, nil
+	}
+
+	value, err := redis.String(t.conn.Do("HGET", key, field))
+	if err == redis.ErrNil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &value, nil
+}
+
+func (t *Transaction) setField(key string, field string, value string) {
+	if t.fields[key] == nil {
+		t.fields[key] = map[string]*string{}
+	}
+	t.fields[key][field] = &value
+}
+
+func (t *Transaction) deleteField(key string, field string) {
+	if t.fields[key] == nil {
+		t.fields[key] = map[string]*string{}
+	}
+	t.fields[key][field] = nil
+}
+
+func (t *Transaction) deleteKey(key string) {
+	t.deleted[key] = true
+	delete(t.fields, key)
+	delete(t.written, key)
+}
+
+// Commit sends the queued writes in MULTI/EXEC, Redis applies none of them if EXEC is not reached,
+// otherwise it runs every one of them, an error of one write is returned but the others are NOT rolled back
+func (t *Transaction) Commit() error {
+	if len(t.queued) == 0 {
+		return nil
+	}
+
+	err := t.conn.Send("MULTI")
+	if err != nil {
+		return err
+	}
+	for _, command := range t.queued {
+		err = t.conn.Send(command[0].(string), command[1:]...)
+		if err != nil {
+			t.conn.Do("DISCARD")
+			return err
+		}
+	}
+
+	var replies []interface{}
+	replies, err = redis.Values(t.conn.Do("EXEC"))
+	if err != nil {
+		return err
+	}
+	for i, reply := range replies {
+		if replyErr, isErr := reply.(redis.Error); isErr {
+			return fmt.Errorf("transaction: %v in %v: %v", t.queued[i][0], t.queued[i][1], replyErr)
+		}
+	}
+	t.queued = nil
+	return nil
+}
+
+// Discard drops the queued writes, nothing has been sent for them
+func (t *Transaction) Discard() {
+	t.queued = nil
+}
+
+func (t *Transaction) Send(commandName string, args ...interface{}) error {
+	return fmt.Errorf("transaction: Send is not supported, use Do")
+}
+
+func (t *Transaction) Flush() error {
+	return nil
+}
+
+func (t *Transaction) Receive() (interface{}, error) {
+	return nil, fmt.Errorf("transaction: Receive is not supported, use Do")
+}
+
+// Close does not close the underlying connection, its owner closes it
+func (t *Transaction) Close() error {
+	return nil
+}
+
+func (t *Transaction) Err() error {
+	return t.conn.Err()
+}
+
+// formatArg formats a command argument the way redigo sends it to redis
+func formatArg(arg interface{}) string {
+	switch arg := arg.(type) {
+	case string:
+		return arg
+	case []byte:
+		return string(arg)
+	case float64:
+		return strconv.FormatFloat(arg, 'g', -1, 64)
+	case bool:
+		if arg {
+			return "1"
+		}
+		return "0"
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(arg)
+	}
+}
+
+func parseIntOrZero(value *string) (int64, error) {
+	if value == nil {
+		return 0, nil
+	}
+	return strconv.ParseInt(*value, 10, 64)
+}
+
+func parseFloatOrZero(value *string) (float64, error) {
+	if value == nil {
+		return 0, nil
+	}
+	return strconv.ParseFloat(*value, 64)
+}
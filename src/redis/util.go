@@ -81,6 +81,13 @@ func HIncrByFloat(conn *redis.Conn, key string, field string, amount float64) (s
 	return amountAfterIncrease, err
 }
 
+// HIncrBy increases a field(should be integer field) by given amount
+// return field value after increasement
+// workon redis dataType: Hash
+func HIncrBy(conn *redis.Conn, key string, field string, amount int) (int, error) {
+	return redis.Int((*conn).Do("HINCRBY", key, field, amount))
+}
+
 // Incr return the current value and increase the value by 1
 // If the key does not exist, the key will be set to 0 first, and then incr is called TWICE
 // So the value returned for calling Incr for the first time will be 1
@@ -100,6 +107,87 @@ func Exists(conn *redis.Conn, key string) (bool, error) {
 	return ok, err
 }
 
+// Rename renames key to newKey, if newKey exists, it is overwritten
+// If key does not exist, an error is returned
+// workon redis dataType: Any
+func Rename(conn *redis.Conn, key string, newKey string) error {
+	_, err := (*conn).Do("RENAME", key, newKey)
+	return err
+}
+
+// Scan returns all keys matching pattern, iterating the keyspace with SCAN instead of blocking redis with KEYS
+// Order of results: NON-PREDICTABLE
+// A key modified during the iteration may be returned more than once or missed
+// workon redis dataType: Any
+func Scan(conn *redis.Conn, pattern string) ([]string, error) {
+	var keys []string
+	cursor := 0
+	for {
+		values, err := redis.Values((*conn).Do("SCAN", cursor, "MATCH", pattern, "COUNT", 1000))
+		if err != nil {
+			return []string{}, err
+		}
+
+		var batch []string
+		_, err = redis.Scan(values, &cursor, &batch)
+		if err != nil {
+			return []string{}, err
+		}
+		keys = append(keys, batch...)
+
+		if cursor == 0 {
+			return keys, nil
+		}
+	}
+}
+
+// SetNXWithExpire sets key to value with a timeout in seconds, only if key does not exist
+// return true if key is set, false if key already exists
+// workon redis dataType: String
+func SetNXWithExpire(conn *redis.Conn, key string, value string, seconds int) (bool, error) {
+	_, err := redis.String((*conn).Do("SET", key, value, "NX", "EX", seconds))
+	if err == redis.ErrNil {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Get returns the value of key, redis.ErrNil if key does not exist
+// workon redis dataType: String
+func Get(conn *redis.Conn, key string) (string, error) {
+	return redis.String((*conn).Do("GET", key))
+}
+
+// Set sets key to value, if key exists, it is overwritten
+// workon redis dataType: String
+func Set(conn *redis.Conn, key string, value string) error {
+	_, err := (*conn).Do("SET", key, value)
+	return err
+}
+
+// Type returns the data type of key: string, hash, zset, list or set, none if key does not exist
+// workon redis dataType: Any
+func Type(conn *redis.Conn, key string) (string, error) {
+	return redis.String((*conn).Do("TYPE", key))
+}
+
+// PTTL returns the remaining time to live of key in milliseconds
+// -1 if key exists but does not expire, -2 if key does not exist
+// workon redis dataType: Any
+func PTTL(conn *redis.Conn, key string) (int64, error) {
+	return redis.Int64((*conn).Do("PTTL", key))
+}
+
+// HDel removes a field from a hash, nothing happens if the field does not exist
+// workon redis dataType: Hash
+func HDel(conn *redis.Conn, key string, field string) error {
+	_, err := (*conn).Do("HDEL", key, field)
+	return err
+}
+
 // Delete remove a hash associated with key
 // workon redis dataType: Hash
 func Delete(conn *redis.Conn, key string) error {
@@ -157,6 +245,38 @@ func ZRevRange(conn *redis.Conn, setName string, start int, stop int, withScores
 	return redis.Strings((*conn).Do("ZREVRANGE", setName, start, stop))
 }
 
+// ZRangeByScore retrieves a list of keys from a Sorted set named setName, with score between min and max(both inclusive)
+// Order of results: from lowest to highest
+// min and max can be "-inf" and "+inf", or a "(" prefixed score to be exclusive
+// If the set is empty, an EMPTY []string is returned
+// workon redis dataType: Sorted Set
+func ZRangeByScore(conn *redis.Conn, setName string, min interface{}, max interface{}) ([]string, error) {
+	return redis.Strings((*conn).Do("ZRANGEBYSCORE", setName, min, max))
+}
+
+// ZRangeByScoreWithLimit is ZRangeByScore returning at most count keys, skipping the first offset keys
+// workon redis dataType: Sorted Set
+func ZRangeByScoreWithLimit(conn *redis.Conn, setName string, min interface{}, max interface{}, offset int, count int) ([]string, error) {
+	return redis.Strings((*conn).Do("ZRANGEBYSCORE", setName, min, max, "LIMIT", offset, count))
+}
+
+// ZRevRangeByScoreWithLimit retrieves at most count keys from a Sorted set named setName, with score between max and min(both inclusive),
+// skipping the first offset keys
+// Order of results: from highest to lowest
+// min and max can be "-inf" and "+inf", or a "(" prefixed score to be exclusive
+// workon redis dataType: Sorted Set
+func ZRevRangeByScoreWithLimit(conn *redis.Conn, setName string, max interface{}, min interface{}, offset int, count int) ([]string, error) {
+	return redis.Strings((*conn).Do("ZREVRANGEBYSCORE", setName, max, min, "LIMIT", offset, count))
+}
+
+// ZRemRangeByScore removes keys from a Sorted set named setName, with score between min and max(both inclusive)
+// min and max can be "-inf" and "+inf", or a "(" prefixed score to be exclusive
+// workon redis dataType: Sorted Set
+func ZRemRangeByScore(conn *redis.Conn, setName string, min interface{}, max interface{}) error {
+	_, err := (*conn).Do("ZREMRANGEBYSCORE", setName, min, max)
+	return err
+}
+
 /*
 	Zcard returns the number of elements of the sorted set.
 	If the set does not exist, 0 is returned.
@@ -204,6 +324,44 @@ func LLen(conn *redis.Conn, listName string) (int, error) {
 	return redis.Int((*conn).Do("LLEN", listName))
 }
 
+// SAdd adds a member to a set named setName
+// If set named setName does not exist, SAdd creates a set named setName
+// If member exists, nothing happens
+// workon redis dataType: Set
+func SAdd(conn *redis.Conn, setName string, member string) error {
+	_, err := (*conn).Do("SADD", setName, member)
+	return err
+}
+
+// SRem removes a member from a set named setName
+// workon redis dataType: Set
+func SRem(conn *redis.Conn, setName string, member string) error {
+	_, err := (*conn).Do("SREM", setName, member)
+	return err
+}
+
+// SIsMember checks if member is in a set named setName
+// If the set does not exist, false is returned
+// workon redis dataType: Set
+func SIsMember(conn *redis.Conn, setName string, member string) (bool, error) {
+	return redis.Bool((*conn).Do("SISMEMBER", setName, member))
+}
+
+// SMembers returns all members of a set named setName
+// Order of results: NON-PREDICTABLE
+// If the set does not exist, an EMPTY []string is returned
+// workon redis dataType: Set
+func SMembers(conn *redis.Conn, setName string) ([]string, error) {
+	return redis.Strings((*conn).Do("SMEMBERS", setName))
+}
+
+// Expire sets a timeout in seconds on key, the key will be deleted after the timeout
+// workon redis dataType: Any
+func Expire(conn *redis.Conn, key string, seconds int) error {
+	_, err := (*conn).Do("EXPIRE", key, seconds)
+	return err
+}
+
 // FlushAll flushes all data in Redis db
 // BE CAREFUL WITH THIS FUNCTION
 func FlushAll(conn *redis.Conn) {
@@ -0,0 +1,828 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var errWrongType = fmt.Errorf("WRONGTYPE Operation against a key holding the wrong kind of value")
+
+// a value of a key, only the field of its kind is used
+type memoryValue struct {
+	kind      string
+	str       string
+	hash      map[string]string
+	sortedSet map[string]float64
+	list      []string
+	set       map[string]bool
+	expireAt  time.Time // zero if the key does not expire
+}
+
+func (v *memoryValue) empty() bool {
+	switch v.kind {
+	case KIND_HASH:
+		return len(v.hash) == 0
+	case KIND_SORTED_SET:
+		return len(v.sortedSet) == 0
+	case KIND_LIST:
+		return len(v.list) == 0
+	case KIND_SET:
+		return len(v.set) == 0
+	}
+	return false
+}
+
+func (v *memoryValue) copy() *memoryValue {
+	copied := &memoryValue{kind: v.kind, str: v.str, expireAt: v.expireAt}
+	if v.hash != nil {
+		copied.hash = make(map[string]string, len(v.hash))
+		for field, value := range v.hash {
+			copied.hash[field] = value
+		}
+	}
+	if v.sortedSet != nil {
+		copied.sortedSet = make(map[string]float64, len(v.sortedSet))
+		for member, score := range v.sortedSet {
+			copied.sortedSet[member] = score
+		}
+	}
+	if v.list != nil {
+		copied.list = append([]string{}, v.list...)
+	}
+	if v.set != nil {
+		copied.set = make(map[string]bool, len(v.set))
+		for member := range v.set {
+			copied.set[member] = true
+		}
+	}
+	return copied
+}
+
+/*
+		MemoryStorage keeps the engine's state in maps of the process, it is lost when the process stops.
+		It behaves like Redis for every command of Conn, so the engine runs on it without a Redis server,
+		eg: in unit tests, or when the engine is embedded in another program.
+		Every command is atomic. Atomically undoes the writes of a failed step, other connections can see them until then,
+		so steps which write should be serialized by the caller, as the engine does with its write lock.
+*/
+type MemoryStorage struct {
+	lock sync.Mutex
+	data map[string]*memoryValue
+	now  func() time.Time
+}
+
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{data: map[string]*memoryValue{}, now: time.Now}
+}
+
+func (s *MemoryStorage) Get() Conn {
+	return &memoryConn{storage: s}
+}
+
+// Export copies every key which has not expired, it is a point-in-time image of the storage
+func (s *MemoryStorage) Export() ([]Entry, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	keys := make([]string, 0, len(s.data))
+	for key := range s.data {
+		if s.lookup(key) != nil {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	entries := make([]Entry, 0, len(keys))
+	for _, key := range keys {
+		value := s.data[key].copy()
+		entry := Entry{Key: key, Kind: value.kind, ExpireAt: value.expireAt}
+		switch value.kind {
+		case KIND_STRING:
+			entry.String = value.str
+		case KIND_HASH:
+			entry.Hash = value.hash
+		case KIND_SORTED_SET:
+			entry.SortedSet = value.sortedSet
+		case KIND_LIST:
+			entry.List = value.list
+		case KIND_SET:
+			for member := range value.set {
+				entry.Set = append(entry.Set, member)
+			}
+			sort.Strings(entry.Set)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// Import REPLACES every key of the storage with the entries, eg: from Export of another storage
+func (s *MemoryStorage) Import(entries []Entry) error {
+	data := make(map[string]*memoryValue, len(entries))
+	for _, entry := range entries {
+		value := &memoryValue{kind: entry.Kind, expireAt: entry.ExpireAt}
+		switch entry.Kind {
+		case KIND_STRING:
+			value.str = entry.String
+		case KIND_HASH:
+			value.hash = map[string]string{}
+			for field, fieldValue := range entry.Hash {
+				value.hash[field] = fieldValue
+			}
+		case KIND_SORTED_SET:
+			value.sortedSet = map[string]float64{}
+			for member, score := range entry.SortedSet {
+				value.sortedSet[member] = score
+			}
+		case KIND_LIST:
+			value.list = append([]string{}, entry.List...)
+		case KIND_SET:
+			value.set = map[string]bool{}
+			for _, member := range entry.Set {
+				value.set[member] = true
+			}
+		default:
+			return fmt.Errorf("unknown kind %s of key %s", entry.Kind, entry.Key)
+		}
+		if !value.empty() || entry.Kind == KIND_STRING {
+			data[entry.Key] = value
+		}
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.data = data
+	return nil
+}
+
+func (s *MemoryStorage) Close() error {
+	return nil
+}
+
+// lookup returns the value of a key, nil if the key does not exist or has expired. MUST hold the lock.
+func (s *MemoryStorage) lookup(key string) *memoryValue {
+	value, ok := s.data[key]
+	if !ok {
+		return nil
+	}
+	if !value.expireAt.IsZero() && !s.now().Before(value.expireAt) {
+		delete(s.data, key)
+		return nil
+	}
+	return value
+}
+
+// lookupKind returns the value of a key if it has the kind, nil if the key does not exist. MUST hold the lock.
+func (s *MemoryStorage) lookupKind(key string, kind string) (*memoryValue, error) {
+	value := s.lookup(key)
+	if value != nil && value.kind != kind {
+		return nil, errWrongType
+	}
+	return value, nil
+}
+
+// memoryConn is a connection to a MemoryStorage, or the transaction of a connection in Atomically
+type memoryConn struct {
+	storage *MemoryStorage
+	// the values before the transaction of the keys it wrote, nil for a key which did not exist
+	undo map[string]*memoryValue
+}
+
+// write runs a command which may change the keys, after saving them for the undo of the transaction
+func (c *memoryConn) write(keys []string, command func(s *MemoryStorage) error) error {
+	c.storage.lock.Lock()
+	defer c.storage.lock.Unlock()
+
+	if c.undo != nil {
+		for _, key := range keys {
+			if _, saved := c.undo[key]; saved {
+				continue
+			}
+			value := c.storage.lookup(key)
+			if value != nil {
+				value = value.copy()
+			}
+			c.undo[key] = value
+		}
+	}
+	return command(c.storage)
+}
+
+// read runs a command which does not change any key
+func (c *memoryConn) read(command func(s *MemoryStorage) error) error {
+	c.storage.lock.Lock()
+	defer c.storage.lock.Unlock()
+	return command(c.storage)
+}
+
+// writeKind runs a command on the value of a key of a kind, the value is created if the key does not exist,
+// and the key is removed if the command leaves the value empty
+func (c *memoryConn) writeKind(key string, kind string, command func(value *memoryValue) error) error {
+	return c.write([]string{key}, func(s *MemoryStorage) error {
+		value, err := s.lookupKind(key, kind)
+		if err != nil {
+			return err
+		}
+		if value == nil {
+			value = &memoryValue{kind: kind}
+			switch kind {
+			case KIND_HASH:
+				value.hash = map[string]string{}
+			case KIND_SORTED_SET:
+				value.sortedSet = map[string]float64{}
+			case KIND_SET:
+				value.set = map[string]bool{}
+			}
+			s.data[key] = value
+		}
+
+		err = command(value)
+		if value.empty() {
+			delete(s.data, key)
+		}
+		return err
+	})
+}
+
+// readKind runs a command on the value of a key of a kind, nil if the key does not exist
+func (c *memoryConn) readKind(key string, kind string, command func(value *memoryValue) error) error {
+	return c.read(func(s *MemoryStorage) error {
+		value, err := s.lookupKind(key, kind)
+		if err != nil {
+			return err
+		}
+		return command(value)
+	})
+}
+
+func (c *memoryConn) Ping() error {
+	return nil
+}
+
+func (c *memoryConn) HSet(key string, field string, value interface{}) error {
+	return c.HMSet(key, map[string]interface{}{field: value})
+}
+
+func (c *memoryConn) HMSet(key string, fieldValueMap map[string]interface{}) error {
+	return c.writeKind(key, KIND_HASH, func(value *memoryValue) error {
+		for field, fieldValue := range fieldValueMap {
+			value.hash[field] = formatArg(fieldValue)
+		}
+		return nil
+	})
+}
+
+func (c *memoryConn) HGet(key string, field string) (string, error) {
+	var fieldValue string
+	err := c.readKind(key, KIND_HASH, func(value *memoryValue) error {
+		var ok bool
+		if value != nil {
+			fieldValue, ok = value.hash[field]
+		}
+		if !ok {
+			return ErrNil
+		}
+		return nil
+	})
+	return fieldValue, err
+}
+
+func (c *memoryConn) HMGet(key string, fields []string) ([]string, error) {
+	fieldValues := make([]string, len(fields))
+	err := c.readKind(key, KIND_HASH, func(value *memoryValue) error {
+		if value == nil {
+			return nil
+		}
+		for i, field := range fields {
+			fieldValues[i] = value.hash[field]
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return fieldValues, nil
+}
+
+func (c *memoryConn) HExists(key string, field string) (bool, error) {
+	_, err := c.HGet(key, field)
+	if err == ErrNil {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (c *memoryConn) HIncrByFloat(key string, field string, amount float64) (string, error) {
+	var result string
+	err := c.writeKind(key, KIND_HASH, func(value *memoryValue) error {
+		current, err := parseFloatField(value.hash[field])
+		if err != nil {
+			return fmt.Errorf("ERR hash value is not a float")
+		}
+		result = strconv.FormatFloat(current+amount, 'f', -1, 64)
+		value.hash[field] = result
+		return nil
+	})
+	return result, err
+}
+
+func (c *memoryConn) HIncrBy(key string, field string, amount int) (int, error) {
+	var result int
+	err := c.writeKind(key, KIND_HASH, func(value *memoryValue) error {
+		current := 0
+		if value.hash[field] != "" {
+			var err error
+			current, err = strconv.Atoi(value.hash[field])
+			if err != nil {
+				return fmt.Errorf("ERR hash value is not an integer")
+			}
+		}
+		result = current + amount
+		value.hash[field] = strconv.Itoa(result)
+		return nil
+	})
+	return result, err
+}
+
+func (c *memoryConn) HDel(key string, field string) error {
+	return c.writeKind(key, KIND_HASH, func(value *memoryValue) error {
+		delete(value.hash, field)
+		return nil
+	})
+}
+
+func (c *memoryConn) Get(key string) (string, error) {
+	var value string
+	err := c.readKind(key, KIND_STRING, func(stringValue *memoryValue) error {
+		if stringValue == nil {
+			return ErrNil
+		}
+		value = stringValue.str
+		return nil
+	})
+	return value, err
+}
+
+func (c *memoryConn) Set(key string, value string) error {
+	return c.write([]string{key}, func(s *MemoryStorage) error {
+		s.data[key] = &memoryValue{kind: KIND_STRING, str: value}
+		return nil
+	})
+}
+
+func (c *memoryConn) Incr(key string) (int, error) {
+	var result int
+	err := c.writeKind(key, KIND_STRING, func(value *memoryValue) error {
+		current := 0
+		if value.str != "" {
+			var err error
+			current, err = strconv.Atoi(value.str)
+			if err != nil {
+				return fmt.Errorf("ERR value is not an integer or out of range")
+			}
+		}
+		result = current + 1
+		value.str = strconv.Itoa(result)
+		return nil
+	})
+	return result, err
+}
+
+func (c *memoryConn) SetNXWithExpire(key string, value string, seconds int) (bool, error) {
+	set := false
+	err := c.write([]string{key}, func(s *MemoryStorage) error {
+		if s.lookup(key) != nil {
+			return nil
+		}
+		s.data[key] = &memoryValue{kind: KIND_STRING, str: value, expireAt: s.now().Add(time.Duration(seconds) * time.Second)}
+		set = true
+		return nil
+	})
+	return set, err
+}
+
+func (c *memoryConn) Exists(key string) (bool, error) {
+	exists := false
+	err := c.read(func(s *MemoryStorage) error {
+		exists = s.lookup(key) != nil
+		return nil
+	})
+	return exists, err
+}
+
+func (c *memoryConn) Rename(key string, newKey string) error {
+	return c.write([]string{key, newKey}, func(s *MemoryStorage) error {
+		value := s.lookup(key)
+		if value == nil {
+			return fmt.Errorf("ERR no such key")
+		}
+		delete(s.data, key)
+		s.data[newKey] = value
+		return nil
+	})
+}
+
+// Scan supports the * and ? wildcards of redis patterns
+func (c *memoryConn) Scan(pattern string) ([]string, error) {
+	var keys []string
+	err := c.read(func(s *MemoryStorage) error {
+		for key := range s.data {
+			if s.lookup(key) != nil && matchPattern(pattern, key) {
+				keys = append(keys, key)
+			}
+		}
+		return nil
+	})
+	return keys, err
+}
+
+func (c *memoryConn) Delete(key string) error {
+	return c.write([]string{key}, func(s *MemoryStorage) error {
+		delete(s.data, key)
+		return nil
+	})
+}
+
+func (c *memoryConn) Expire(key string, seconds int) error {
+	return c.write([]string{key}, func(s *MemoryStorage) error {
+		value := s.lookup(key)
+		if value != nil {
+			value.expireAt = s.now().Add(time.Duration(seconds) * time.Second)
+		}
+		return nil
+	})
+}
+
+func (c *memoryConn) FlushAll() error {
+	c.storage.lock.Lock()
+	keys := make([]string, 0, len(c.storage.data))
+	for key := range c.storage.data {
+		keys = append(keys, key)
+	}
+	c.storage.lock.Unlock()
+
+	return c.write(keys, func(s *MemoryStorage) error {
+		s.data = map[string]*memoryValue{}
+		return nil
+	})
+}
+
+func (c *memoryConn) ZAdd(setName string, score interface{}, key string) error {
+	parsedScore, err := strconv.ParseFloat(formatArg(score), 64)
+	if err != nil {
+		return fmt.Errorf("ERR value is not a valid float")
+	}
+	return c.writeKind(setName, KIND_SORTED_SET, func(value *memoryValue) error {
+		value.sortedSet[key] = parsedScore
+		return nil
+	})
+}
+
+func (c *memoryConn) ZRem(setName string, key string) error {
+	return c.writeKind(setName, KIND_SORTED_SET, func(value *memoryValue) error {
+		delete(value.sortedSet, key)
+		return nil
+	})
+}
+
+func (c *memoryConn) ZRange(setName string, start int, stop int, withScores bool) ([]string, error) {
+	return c.zRangeByRank(setName, start, stop, withScores, false)
+}
+
+func (c *memoryConn) ZRevRange(setName string, start int, stop int, withScores bool) ([]string, error) {
+	return c.zRangeByRank(setName, start, stop, withScores, true)
+}
+
+func (c *memoryConn) zRangeByRank(setName string, start int, stop int, withScores bool, reverse bool) ([]string, error) {
+	var result []string
+	err := c.readKind(setName, KIND_SORTED_SET, func(value *memoryValue) error {
+		if value == nil {
+			return nil
+		}
+		members := sortedMembers(value.sortedSet, reverse)
+		first, last, ok := rankRange(len(members), start, stop)
+		if !ok {
+			return nil
+		}
+		for _, member := range members[first : last+1] {
+			result = append(result, member)
+			if withScores {
+				result = append(result, strconv.FormatFloat(value.sortedSet[member], 'g', -1, 64))
+			}
+		}
+		return nil
+	})
+	if result == nil {
+		result = []string{}
+	}
+	return result, err
+}
+
+func (c *memoryConn) ZRangeByScore(setName string, min interface{}, max interface{}) ([]string, error) {
+	return c.zRangeByScore(setName, min, max, 0, -1, false)
+}
+
+func (c *memoryConn) ZRangeByScoreWithLimit(setName string, min interface{}, max interface{}, offset int, count int) ([]string, error) {
+	return c.zRangeByScore(setName, min, max, offset, count, false)
+}
+
+func (c *memoryConn) ZRevRangeByScoreWithLimit(setName string, max interface{}, min interface{}, offset int, count int) ([]string, error) {
+	return c.zRangeByScore(setName, min, max, offset, count, true)
+}
+
+// zRangeByScore returns at most count members with score between min and max, skipping the first offset, a negative count for every member
+func (c *memoryConn) zRangeByScore(setName string, min interface{}, max interface{}, offset int, count int, reverse bool) ([]string, error) {
+	minBound, err := parseScoreBound(min)
+	if err != nil {
+		return nil, err
+	}
+	var maxBound scoreBound
+	maxBound, err = parseScoreBound(max)
+	if err != nil {
+		return nil, err
+	}
+
+	result := []string{}
+	err = c.readKind(setName, KIND_SORTED_SET, func(value *memoryValue) error {
+		if value == nil {
+			return nil
+		}
+		for _, member := range sortedMembers(value.sortedSet, reverse) {
+			score := value.sortedSet[member]
+			if !minBound.below(score) || !maxBound.above(score) {
+				continue
+			}
+			if offset > 0 {
+				offset--
+				continue
+			}
+			if count == 0 {
+				break
+			}
+			result = append(result, member)
+			count--
+		}
+		return nil
+	})
+	return result, err
+}
+
+func (c *memoryConn) ZRemRangeByScore(setName string, min interface{}, max interface{}) error {
+	minBound, err := parseScoreBound(min)
+	if err != nil {
+		return err
+	}
+	var maxBound scoreBound
+	maxBound, err = parseScoreBound(max)
+	if err != nil {
+		return err
+	}
+
+	return c.writeKind(setName, KIND_SORTED_SET, func(value *memoryValue) error {
+		for member, score := range value.sortedSet {
+			if minBound.below(score) && maxBound.above(score) {
+				delete(value.sortedSet, member)
+			}
+		}
+		return nil
+	})
+}
+
+func (c *memoryConn) ZCard(setName string) (int, error) {
+	count := 0
+	err := c.readKind(setName, KIND_SORTED_SET, func(value *memoryValue) error {
+		if value != nil {
+			count = len(value.sortedSet)
+		}
+		return nil
+	})
+	return count, err
+}
+
+func (c *memoryConn) LPush(listName string, node string) error {
+	return c.writeKind(listName, KIND_LIST, func(value *memoryValue) error {
+		value.list = append([]string{node}, value.list...)
+		return nil
+	})
+}
+
+func (c *memoryConn) RPush(listName string, node string) error {
+	return c.writeKind(listName, KIND_LIST, func(value *memoryValue) error {
+		value.list = append(value.list, node)
+		return nil
+	})
+}
+
+func (c *memoryConn) LRange(listName string, start int, stop int) ([]string, error) {
+	result := []string{}
+	err := c.readKind(listName, KIND_LIST, func(value *memoryValue) error {
+		if value == nil {
+			return nil
+		}
+		first, last, ok := rankRange(len(value.list), start, stop)
+		if ok {
+			result = append(result, value.list[first:last+1]...)
+		}
+		return nil
+	})
+	return result, err
+}
+
+func (c *memoryConn) LLen(listName string) (int, error) {
+	length := 0
+	err := c.readKind(listName, KIND_LIST, func(value *memoryValue) error {
+		if value != nil {
+			length = len(value.list)
+		}
+		return nil
+	})
+	return length, err
+}
+
+func (c *memoryConn) SAdd(setName string, member string) error {
+	return c.writeKind(setName, KIND_SET, func(value *memoryValue) error {
+		value.set[member] = true
+		return nil
+	})
+}
+
+func (c *memoryConn) SRem(setName string, member string) error {
+	return c.writeKind(setName, KIND_SET, func(value *memoryValue) error {
+		delete(value.set, member)
+		return nil
+	})
+}
+
+func (c *memoryConn) SIsMember(setName string, member string) (bool, error) {
+	isMember := false
+	err := c.readKind(setName, KIND_SET, func(value *memoryValue) error {
+		isMember = value != nil && value.set[member]
+		return nil
+	})
+	return isMember, err
+}
+
+func (c *memoryConn) SMembers(setName string) ([]string, error) {
+	members := []string{}
+	err := c.readKind(setName, KIND_SET, func(value *memoryValue) error {
+		if value == nil {
+			return nil
+		}
+		for member := range value.set {
+			members = append(members, member)
+		}
+		return nil
+	})
+	return members, err
+}
+
+// Atomically saves every key before step writes it, and puts the saved values back if step fails
+func (c *memoryConn) Atomically(step func(conn Conn) error) error {
+	if c.undo != nil {
+		return step(c)
+	}
+
+	transaction := &memoryConn{storage: c.storage, undo: map[string]*memoryValue{}}
+	err := step(transaction)
+	if err == nil {
+		return nil
+	}
+
+	c.storage.lock.Lock()
+	defer c.storage.lock.Unlock()
+	for key, value := range transaction.undo {
+		if value == nil {
+			delete(c.storage.data, key)
+		} else {
+			c.storage.data[key] = value
+		}
+	}
+	return err
+}
+
+func (c *memoryConn) Close() error {
+	return nil
+}
+
+// the members of a sorted set ordered by score, then by member, like redis
+func sortedMembers(sortedSet map[string]float64, reverse bool) []string {
+	members := make([]string, 0, len(sortedSet))
+	for member := range sortedSet {
+		members = append(members, member)
+	}
+	sort.Slice(members, func(i, j int) bool {
+		scoreI, scoreJ := sortedSet[members[i]], sortedSet[members[j]]
+		if scoreI != scoreJ {
+			return (scoreI < scoreJ) != reverse
+		}
+		return (members[i] < members[j]) != reverse
+	})
+	return members
+}
+
+// rankRange turns the start and stop of ZRANGE or LRANGE into indexes of a slice of length n, false if the range is empty
+func rankRange(n int, start int, stop int) (int, int, bool) {
+	if start < 0 {
+		start += n
+	}
+	if stop < 0 {
+		stop += n
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= n {
+		stop = n - 1
+	}
+	if start > stop || start >= n {
+		return 0, 0, false
+	}
+	return start, stop, true
+}
+
+// a min or max of ZRANGEBYSCORE: a score, -inf, +inf, or a score prefixed by ( to be exclusive
+type scoreBound struct {
+	score     float64
+	exclusive bool
+}
+
+func parseScoreBound(bound interface{}) (scoreBound, error) {
+	text := formatArg(bound)
+	exclusive := strings.HasPrefix(text, "(")
+	if exclusive {
+		text = text[1:]
+	}
+	score, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return scoreBound{}, fmt.Errorf("ERR min or max is not a float")
+	}
+	return scoreBound{score: score, exclusive: exclusive}, nil
+}
+
+// below returns true if score is above the bound as a min
+func (b scoreBound) below(score float64) bool {
+	if b.exclusive {
+		return score > b.score
+	}
+	return score >= b.score
+}
+
+// above returns true if score is below the bound as a max
+func (b scoreBound) above(score float64) bool {
+	if b.exclusive {
+		return score < b.score
+	}
+	return score <= b.score
+}
+
+// matchPattern matches a key against a redis pattern with the * and ? wildcards
+func matchPattern(pattern string, key string) bool {
+	if pattern == "" {
+		return key == ""
+	}
+	switch pattern[0] {
+	case '*':
+		for i := 0; i <= len(key); i++ {
+			if matchPattern(pattern[1:], key[i:]) {
+				return true
+			}
+		}
+		return false
+	case '?':
+		return key != "" && matchPattern(pattern[1:], key[1:])
+	}
+	return key != "" && key[0] == pattern[0] && matchPattern(pattern[1:], key[1:])
+}
+
+// an empty field is treated as 0, like a missing field in redis
+func parseFloatField(value string) (float64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.ParseFloat(value, 64)
+}
+
+// formatArg formats a value the way redigo sends it to redis
+func formatArg(arg interface{}) string {
+	switch arg := arg.(type) {
+	case string:
+		return arg
+	case []byte:
+		return string(arg)
+	case float64:
+		return strconv.FormatFloat(arg, 'g', -1, 64)
+	case bool:
+		if arg {
+			return "1"
+		}
+		return "0"
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(arg)
+	}
+}
@@ -0,0 +1,269 @@
+package storage
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// newTestStorage returns a memory storage with a clock which only moves when the test moves it
+func newTestStorage() (*MemoryStorage, *time.Time) {
+	now := time.Unix(1700000000, 0)
+	s := NewMemoryStorage()
+	s.now = func() time.Time { return now }
+	return s, &now
+}
+
+func TestMemoryStorageHash(t *testing.T) {
+	s, _ := newTestStorage()
+	conn := s.Get()
+	defer conn.Close()
+
+	_, err := conn.HGet("account:1", "balance")
+	if err != ErrNil {
+		t.Fatalf("HGet of a missing key: error %v, want ErrNil", err)
+	}
+
+	err = conn.HMSet("account:1", map[string]interface{}{"balance": 100.5, "reserved": 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	balance, err := conn.HIncrByFloat("account:1", "balance", -0.5)
+	if err != nil || balance != "100" {
+		t.Fatalf("HIncrByFloat: %s %v, want 100", balance, err)
+	}
+	values, err := conn.HMGet("account:1", []string{"balance", "reserved", "missing"})
+	if err != nil || !reflect.DeepEqual(values, []string{"100", "0", ""}) {
+		t.Fatalf("HMGet: %v %v", values, err)
+	}
+
+	err = conn.HDel("account:1", "balance")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = conn.HDel("account:1", "reserved")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exists, err := conn.Exists("account:1")
+	if err != nil || exists {
+		t.Fatalf("a hash without fields exists: %v %v", exists, err)
+	}
+
+	err = conn.Set("counter", "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = conn.HGet("counter", "field")
+	if err == nil || err == ErrNil {
+		t.Fatalf("HGet of a string: error %v, want a wrong type error", err)
+	}
+}
+
+func TestMemoryStorageSortedSet(t *testing.T) {
+	s, _ := newTestStorage()
+	conn := s.Get()
+	defer conn.Close()
+
+	for member, score := range map[string]float64{"a": 1, "b": 2, "c": 2, "d": 3} {
+		err := conn.ZAdd("book", score, member)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		query func() ([]string, error)
+		want  []string
+	}{
+		{"ZRange", func() ([]string, error) { return conn.ZRange("book", 0, -1, false) }, []string{"a", "b", "c", "d"}},
+		{"ZRange with scores", func() ([]string, error) { return conn.ZRange("book", 1, 2, true) }, []string{"b", "2", "c", "2"}},
+		{"ZRevRange", func() ([]string, error) { return conn.ZRevRange("book", 0, 1, false) }, []string{"d", "c"}},
+		{"ZRange out of range", func() ([]string, error) { return conn.ZRange("book", 5, 10, false) }, []string{}},
+		{"ZRangeByScore", func() ([]string, error) { return conn.ZRangeByScore("book", 2, "+inf") }, []string{"b", "c", "d"}},
+		{"ZRangeByScore exclusive", func() ([]string, error) { return conn.ZRangeByScore("book", "(1", "(3") }, []string{"b", "c"}},
+		{"ZRangeByScoreWithLimit", func() ([]string, error) { return conn.ZRangeByScoreWithLimit("book", "-inf", "+inf", 1, 2) }, []string{"b", "c"}},
+		{"ZRevRangeByScoreWithLimit", func() ([]string, error) { return conn.ZRevRangeByScoreWithLimit("book", 2, "-inf", 0, 2) }, []string{"c", "b"}},
+		{"missing key", func() ([]string, error) { return conn.ZRange("missing", 0, -1, false) }, []string{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := test.query()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Fatalf("%v, want %v", got, test.want)
+			}
+		})
+	}
+
+	err := conn.ZRemRangeByScore("book", "-inf", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	count, err := conn.ZCard("book")
+	if err != nil || count != 1 {
+		t.Fatalf("ZCard after ZRemRangeByScore: %d %v, want 1", count, err)
+	}
+}
+
+func TestMemoryStorageExpire(t *testing.T) {
+	s, now := newTestStorage()
+	conn := s.Get()
+	defer conn.Close()
+
+	err := conn.RPush("snapshot", "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = conn.Expire("snapshot", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	set, err := conn.SetNXWithExpire("lock", "1", 5)
+	if err != nil || !set {
+		t.Fatalf("SetNXWithExpire: %v %v, want true", set, err)
+	}
+	set, err = conn.SetNXWithExpire("lock", "1", 5)
+	if err != nil || set {
+		t.Fatalf("SetNXWithExpire of an existing key: %v %v, want false", set, err)
+	}
+
+	*now = now.Add(5 * time.Second)
+	exists, err := conn.Exists("lock")
+	if err != nil || exists {
+		t.Fatalf("expired key exists: %v %v", exists, err)
+	}
+	length, err := conn.LLen("snapshot")
+	if err != nil || length != 1 {
+		t.Fatalf("LLen before the expiry: %d %v, want 1", length, err)
+	}
+
+	*now = now.Add(5 * time.Second)
+	entries, err := s.Export()
+	if err != nil || len(entries) != 0 {
+		t.Fatalf("Export after the expiry: %v %v, want no entry", entries, err)
+	}
+}
+
+func TestMemoryStorageAtomically(t *testing.T) {
+	s, _ := newTestStorage()
+	conn := s.Get()
+	defer conn.Close()
+
+	err := conn.HSet("account:1", "balance", 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = conn.Atomically(func(conn Conn) error {
+		_, err := conn.HIncrByFloat("account:1", "balance", -30)
+		if err != nil {
+			return err
+		}
+		err = conn.SAdd("accountSymbols:1", "SPY")
+		if err != nil {
+			return err
+		}
+		// a nested step joins the transaction
+		return conn.Atomically(func(conn Conn) error {
+			_, err := conn.Incr("orderIdCounter")
+			if err != nil {
+				return err
+			}
+			return fmt.Errorf("insufficient funds")
+		})
+	})
+	if err == nil || err.Error() != "insufficient funds" {
+		t.Fatalf("error %v, want the error of the step", err)
+	}
+
+	balance, err := conn.HGet("account:1", "balance")
+	if err != nil || balance != "100" {
+		t.Fatalf("balance after a failed step: %s %v, want 100", balance, err)
+	}
+	for _, key := range []string{"accountSymbols:1", "orderIdCounter"} {
+		exists, err := conn.Exists(key)
+		if err != nil || exists {
+			t.Fatalf("key %s written by a failed step exists: %v %v", key, exists, err)
+		}
+	}
+
+	err = conn.Atomically(func(conn Conn) error {
+		_, err := conn.HIncrByFloat("account:1", "balance", -30)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	balance, err = conn.HGet("account:1", "balance")
+	if err != nil || balance != "70" {
+		t.Fatalf("balance after a step: %s %v, want 70", balance, err)
+	}
+}
+
+func TestWriteEntries(t *testing.T) {
+	s, now := newTestStorage()
+	conn := s.Get()
+	defer conn.Close()
+
+	err := conn.HMSet("account:1", map[string]interface{}{"balance": 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = conn.ZAdd("openBuyOrderBook:SPY", 10, "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = conn.RPush("order-executed:1", "5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = conn.SAdd("adminAccounts", "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = conn.Set("orderIdCounter", "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = conn.Expire("order-executed:1", 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exportedAt := *now
+	entries, err := s.Export()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// restored after the expiry of order-executed:1, which keeps the 60 seconds it had left
+	restored, restoredNow := newTestStorage()
+	*restoredNow = now.Add(time.Hour)
+	restoredConn := restored.Get()
+	defer restoredConn.Close()
+	err = WriteEntries(restoredConn, entries, exportedAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := restored.Export()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(entries) {
+		t.Fatalf("restored %d keys, want %d", len(got), len(entries))
+	}
+	for i := range entries {
+		want := entries[i]
+		if !want.ExpireAt.IsZero() {
+			want.ExpireAt = want.ExpireAt.Add(time.Hour)
+		}
+		if !reflect.DeepEqual(got[i], want) {
+			t.Fatalf("restored %+v, want %+v", got[i], want)
+		}
+	}
+}
@@ -0,0 +1,278 @@
+package storage
+
+import (
+	redis "app/redis"
+	"sort"
+	"strconv"
+	"time"
+
+	redigo "github.com/gomodule/redigo/redis"
+)
+
+// RedisStorage keeps the engine's state in a Redis server, every Conn is a connection from the pool
+type RedisStorage struct {
+	pool *redigo.Pool
+}
+
+func NewRedisStorage(pool *redigo.Pool) *RedisStorage {
+	return &RedisStorage{pool: pool}
+}
+
+func (s *RedisStorage) Get() Conn {
+	return &redisConn{conn: s.pool.Get()}
+}
+
+// Export reads every key with SCAN, it is NOT a point-in-time image if the keys are written meanwhile
+func (s *RedisStorage) Export() ([]Entry, error) {
+	c := s.pool.Get()
+	defer c.Close()
+	conn := &c
+
+	keys, err := redis.Scan(conn, "*")
+	if err != nil {
+		return []Entry{}, err
+	}
+	sort.Strings(keys)
+
+	entries := []Entry{}
+	for i, key := range keys {
+		if i > 0 && keys[i-1] == key {
+			continue
+		}
+		entry := Entry{Key: key}
+		entry.Kind, err = redis.Type(conn, key)
+		if err != nil {
+			return []Entry{}, err
+		}
+
+		switch entry.Kind {
+		case KIND_STRING:
+			entry.String, err = redis.Get(conn, key)
+		case KIND_HASH:
+			var fieldValues []string
+			fieldValues, err = redis.HGetAll(conn, key)
+			entry.Hash = map[string]string{}
+			for j := 0; j+1 < len(fieldValues); j += 2 {
+				entry.Hash[fieldValues[j]] = fieldValues[j+1]
+			}
+		case KIND_SORTED_SET:
+			var memberScores []string
+			memberScores, err = redis.ZRange(conn, key, 0, -1, true)
+			entry.SortedSet = map[string]float64{}
+			for j := 0; err == nil && j+1 < len(memberScores); j += 2 {
+				entry.SortedSet[memberScores[j]], err = strconv.ParseFloat(memberScores[j+1], 64)
+			}
+		case KIND_LIST:
+			entry.List, err = redis.LRange(conn, key, 0, -1)
+		case KIND_SET:
+			entry.Set, err = redis.SMembers(conn, key)
+			sort.Strings(entry.Set)
+		default:
+			// expired since it was scanned
+			continue
+		}
+		if err == redigo.ErrNil {
+			continue
+		}
+		if err != nil {
+			return []Entry{}, err
+		}
+
+		var ttl int64
+		ttl, err = redis.PTTL(conn, key)
+		if err != nil {
+			return []Entry{}, err
+		}
+		if ttl > 0 {
+			entry.ExpireAt = time.Now().Add(time.Duration(ttl) * time.Millisecond)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func (s *RedisStorage) Close() error {
+	return s.pool.Close()
+}
+
+// redisConn is a pooled connection, or the transaction of a connection in Atomically
+type redisConn struct {
+	conn        redigo.Conn
+	transaction bool
+}
+
+func (c *redisConn) Ping() error {
+	return redis.Ping(&c.conn)
+}
+
+func (c *redisConn) HSet(key string, field string, value interface{}) error {
+	return redis.HSet(&c.conn, key, field, value)
+}
+
+func (c *redisConn) HMSet(key string, fieldValueMap map[string]interface{}) error {
+	return redis.HMSet(&c.conn, key, fieldValueMap)
+}
+
+func (c *redisConn) HGet(key string, field string) (string, error) {
+	value, err := redis.HGet(&c.conn, key, field)
+	if err == redigo.ErrNil {
+		return "", ErrNil
+	}
+	return value, err
+}
+
+func (c *redisConn) HMGet(key string, fields []string) ([]string, error) {
+	return redis.HMGet(&c.conn, key, fields)
+}
+
+func (c *redisConn) HExists(key string, field string) (bool, error) {
+	return redis.HExists(&c.conn, key, field)
+}
+
+func (c *redisConn) HIncrByFloat(key string, field string, amount float64) (string, error) {
+	return redis.HIncrByFloat(&c.conn, key, field, amount)
+}
+
+func (c *redisConn) HIncrBy(key string, field string, amount int) (int, error) {
+	return redis.HIncrBy(&c.conn, key, field, amount)
+}
+
+func (c *redisConn) HDel(key string, field string) error {
+	return redis.HDel(&c.conn, key, field)
+}
+
+func (c *redisConn) Get(key string) (string, error) {
+	value, err := redis.Get(&c.conn, key)
+	if err == redigo.ErrNil {
+		return "", ErrNil
+	}
+	return value, err
+}
+
+func (c *redisConn) Set(key string, value string) error {
+	return redis.Set(&c.conn, key, value)
+}
+
+func (c *redisConn) Incr(key string) (int, error) {
+	return redis.Incr(&c.conn, key)
+}
+
+func (c *redisConn) SetNXWithExpire(key string, value string, seconds int) (bool, error) {
+	return redis.SetNXWithExpire(&c.conn, key, value, seconds)
+}
+
+func (c *redisConn) Exists(key string) (bool, error) {
+	return redis.Exists(&c.conn, key)
+}
+
+func (c *redisConn) Rename(key string, newKey string) error {
+	return redis.Rename(&c.conn, key, newKey)
+}
+
+func (c *redisConn) Scan(pattern string) ([]string, error) {
+	return redis.Scan(&c.conn, pattern)
+}
+
+func (c *redisConn) Delete(key string) error {
+	return redis.Delete(&c.conn, key)
+}
+
+func (c *redisConn) Expire(key string, seconds int) error {
+	return redis.Expire(&c.conn, key, seconds)
+}
+
+func (c *redisConn) FlushAll() error {
+	redis.FlushAll(&c.conn)
+	return nil
+}
+
+func (c *redisConn) ZAdd(setName string, score interface{}, key string) error {
+	return redis.ZAdd(&c.conn, setName, score, key)
+}
+
+func (c *redisConn) ZRem(setName string, key string) error {
+	return redis.ZRem(&c.conn, setName, key)
+}
+
+func (c *redisConn) ZRange(setName string, start int, stop int, withScores bool) ([]string, error) {
+	return redis.ZRange(&c.conn, setName, start, stop, withScores)
+}
+
+func (c *redisConn) ZRevRange(setName string, start int, stop int, withScores bool) ([]string, error) {
+	return redis.ZRevRange(&c.conn, setName, start, stop, withScores)
+}
+
+func (c *redisConn) ZRangeByScore(setName string, min interface{}, max interface{}) ([]string, error) {
+	return redis.ZRangeByScore(&c.conn, setName, min, max)
+}
+
+func (c *redisConn) ZRangeByScoreWithLimit(setName string, min interface{}, max interface{}, offset int, count int) ([]string, error) {
+	return redis.ZRangeByScoreWithLimit(&c.conn, setName, min, max, offset, count)
+}
+
+func (c *redisConn) ZRevRangeByScoreWithLimit(setName string, max interface{}, min interface{}, offset int, count int) ([]string, error) {
+	return redis.ZRevRangeByScoreWithLimit(&c.conn, setName, max, min, offset, count)
+}
+
+func (c *redisConn) ZRemRangeByScore(setName string, min interface{}, max interface{}) error {
+	return redis.ZRemRangeByScore(&c.conn, setName, min, max)
+}
+
+func (c *redisConn) ZCard(setName string) (int, error) {
+	return redis.ZCard(&c.conn, setName)
+}
+
+func (c *redisConn) LPush(listName string, node string) error {
+	return redis.LPush(&c.conn, listName, node)
+}
+
+func (c *redisConn) RPush(listName string, node string) error {
+	return redis.RPush(&c.conn, listName, node)
+}
+
+func (c *redisConn) LRange(listName string, start int, stop int) ([]string, error) {
+	return redis.LRange(&c.conn, listName, start, stop)
+}
+
+func (c *redisConn) LLen(listName string) (int, error) {
+	return redis.LLen(&c.conn, listName)
+}
+
+func (c *redisConn) SAdd(setName string, member string) error {
+	return redis.SAdd(&c.conn, setName, member)
+}
+
+func (c *redisConn) SRem(setName string, member string) error {
+	return redis.SRem(&c.conn, setName, member)
+}
+
+func (c *redisConn) SIsMember(setName string, member string) (bool, error) {
+	return redis.SIsMember(&c.conn, setName, member)
+}
+
+func (c *redisConn) SMembers(setName string) ([]string, error) {
+	return redis.SMembers(&c.conn, setName)
+}
+
+// Atomically queues the writes of step in a redis.Transaction, and commits them with MULTI/EXEC when step succeeds
+func (c *redisConn) Atomically(step func(conn Conn) error) error {
+	if c.transaction {
+		return step(c)
+	}
+
+	transaction := redis.NewTransaction(&c.conn)
+	err := step(&redisConn{conn: transaction, transaction: true})
+	if err != nil {
+		transaction.Discard()
+		return err
+	}
+	return transaction.Commit()
+}
+
+// Close returns the connection to the pool, a transaction is closed by its connection
+func (c *redisConn) Close() error {
+	if c.transaction {
+		return nil
+	}
+	return c.conn.Close()
+}
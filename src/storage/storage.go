@@ -0,0 +1,160 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrNil is returned by HGet and Get when the key or the field does not exist
+var ErrNil = errors.New("storage: nil returned")
+
+// the kinds of Entry, named like the redis TYPE command
+const (
+	KIND_STRING     = "string"
+	KIND_HASH       = "hash"
+	KIND_SORTED_SET = "zset"
+	KIND_LIST       = "list"
+	KIND_SET        = "set"
+)
+
+// Entry is a key with its value, to copy the whole state of a storage. Only the field of its Kind is set.
+type Entry struct {
+	Key       string
+	Kind      string
+	String    string             `json:",omitempty"`
+	Hash      map[string]string  `json:",omitempty"`
+	SortedSet map[string]float64 `json:",omitempty"`
+	List      []string           `json:",omitempty"`
+	Set       []string           `json:",omitempty"`
+	ExpireAt  time.Time          // zero if the key does not expire
+}
+
+/*
+		WriteEntries writes entries through conn, eg: to restore the Export of a storage into an empty one.
+		Every entry is written, an entry keeps the time it had left to live at exportedAt, to the second,
+		even if it has expired since, so the restored storage is the exported one.
+*/
+func WriteEntries(conn Conn, entries []Entry, exportedAt time.Time) error {
+	for _, entry := range entries {
+		seconds := 0
+		if !entry.ExpireAt.IsZero() {
+			seconds = int((entry.ExpireAt.Sub(exportedAt) + time.Second - 1) / time.Second)
+			if seconds <= 0 {
+				seconds = 1
+			}
+		}
+
+		var err error
+		switch entry.Kind {
+		case KIND_STRING:
+			err = conn.Set(entry.Key, entry.String)
+		case KIND_HASH:
+			fieldValueMap := make(map[string]interface{}, len(entry.Hash))
+			for field, value := range entry.Hash {
+				fieldValueMap[field] = value
+			}
+			err = conn.HMSet(entry.Key, fieldValueMap)
+		case KIND_SORTED_SET:
+			for member, score := range entry.SortedSet {
+				if err == nil {
+					err = conn.ZAdd(entry.Key, score, member)
+				}
+			}
+		case KIND_LIST:
+			for _, node := range entry.List {
+				if err == nil {
+					err = conn.RPush(entry.Key, node)
+				}
+			}
+		case KIND_SET:
+			for _, member := range entry.Set {
+				if err == nil {
+					err = conn.SAdd(entry.Key, member)
+				}
+			}
+		default:
+			err = fmt.Errorf("unknown kind %s of key %s", entry.Kind, entry.Key)
+		}
+		if err == nil && seconds > 0 {
+			err = conn.Expire(entry.Key, seconds)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Storage is where the engine keeps accounts, positions, orders, order books and histories.
+// RedisStorage keeps them in a Redis server, MemoryStorage in the process.
+type Storage interface {
+	// Get returns a connection, the caller MUST Close it
+	Get() Conn
+	// Export returns every key with its value, ordered by key. Writes during Export may or may not be included.
+	Export() ([]Entry, error)
+	Close() error
+}
+
+// Conn works on the data structures the engine stores its state in: hashes, sorted sets, sets, lists and counters.
+// Every method behaves like the Redis command with the same name, see app/redis for the details.
+type Conn interface {
+	Ping() error
+
+	// workon dataType: Hash
+	HSet(key string, field string, value interface{}) error
+	HMSet(key string, fieldValueMap map[string]interface{}) error
+	HGet(key string, field string) (string, error)
+	HMGet(key string, fields []string) ([]string, error)
+	HExists(key string, field string) (bool, error)
+	HIncrByFloat(key string, field string, amount float64) (string, error)
+	HIncrBy(key string, field string, amount int) (int, error)
+	HDel(key string, field string) error
+
+	// workon dataType: String
+	Get(key string) (string, error)
+	Set(key string, value string) error
+	Incr(key string) (int, error)
+	SetNXWithExpire(key string, value string, seconds int) (bool, error)
+
+	// workon dataType: Any
+	Exists(key string) (bool, error)
+	Rename(key string, newKey string) error
+	Scan(pattern string) ([]string, error)
+	Delete(key string) error
+	Expire(key string, seconds int) error
+	FlushAll() error
+
+	// workon dataType: Sorted Set
+	ZAdd(setName string, score interface{}, key string) error
+	ZRem(setName string, key string) error
+	ZRange(setName string, start int, stop int, withScores bool) ([]string, error)
+	ZRevRange(setName string, start int, stop int, withScores bool) ([]string, error)
+	ZRangeByScore(setName string, min interface{}, max interface{}) ([]string, error)
+	ZRangeByScoreWithLimit(setName string, min interface{}, max interface{}, offset int, count int) ([]string, error)
+	ZRevRangeByScoreWithLimit(setName string, max interface{}, min interface{}, offset int, count int) ([]string, error)
+	ZRemRangeByScore(setName string, min interface{}, max interface{}) error
+	ZCard(setName string) (int, error)
+
+	// workon dataType: List
+	LPush(listName string, node string) error
+	RPush(listName string, node string) error
+	LRange(listName string, start int, stop int) ([]string, error)
+	LLen(listName string) (int, error)
+
+	// workon dataType: Set
+	SAdd(setName string, member string) error
+	SRem(setName string, member string) error
+	SIsMember(setName string, member string) (bool, error)
+	SMembers(setName string) ([]string, error)
+
+	// Atomically runs step, and applies the writes step does through the connection it is given together.
+	// If step returns an error, none of its writes are applied and the error is returned.
+	// Redis runs the writes in MULTI/EXEC, which does not roll back: if a write fails when EXEC runs it,
+	// the other writes are applied, and the error is returned.
+	// Reads in step should be done before the writes to the same key, the Redis implementation can not read its own writes.
+	// Atomically in step joins the transaction of step.
+	Atomically(step func(conn Conn) error) error
+
+	Close() error
+}
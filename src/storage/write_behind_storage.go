@@ -0,0 +1,694 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// WRITE_BEHIND_SEQUENCE_KEY is the key of the backend holding the sequence of the last batch applied to it
+const WRITE_BEHIND_SEQUENCE_KEY = "writeBehindSequence"
+
+// how long the drainer waits before it retries a batch the backend failed to apply
+var WriteBehindRetryInterval = time.Second
+
+// writeBehindCommand is a write to apply to the backend, named like the redis command
+type writeBehindCommand struct {
+	Name string   `json:"name"`
+	Args []string `json:"args"`
+}
+
+// writeBehindBatch is the writes of one Atomically, applied to the backend together
+type writeBehindBatch struct {
+	Sequence int64                `json:"seq"`
+	Commands []writeBehindCommand `json:"commands"`
+}
+
+/*
+		WriteBehindStorage keeps the engine's state in a MemoryStorage, so reads and writes do not wait for the network,
+		and persists it to a backend storage (eg: RedisStorage) asynchronously.
+		Every Atomically (or single write) is a batch: its writes are appended to the queue file and fsync'd
+		before Atomically returns, then a drainer applies the batches to the backend in order, each in one
+		Atomically of the backend together with WRITE_BEHIND_SEQUENCE_KEY, so a batch is applied exactly once
+		even if the engine stops between applying it and removing it from the queue.
+		At startup the batches of the queue the backend has not applied are applied, and the whole state is loaded
+		from the backend into memory.
+*/
+type WriteBehindStorage struct {
+	memory  *MemoryStorage
+	backend Storage
+
+	// lock serializes the batches, so they are queued in the order they are applied to memory
+	lock sync.Mutex
+
+	// queueLock guards the queue file, the pending batches and closed
+	queueLock    sync.Mutex
+	queueChanged *sync.Cond
+	queue        *os.File
+	pending      []writeBehindBatch
+	nextSequence int64
+	closed       bool
+	drained      chan struct{}
+}
+
+/*
+	OpenWriteBehindStorage
+		Apply the batches of the queue file the backend has not applied, load the state of the backend into memory,
+		and start draining new batches to the backend.
+	input:
+		backend: where the state is persisted
+		queuePath: the queue file, created if it does not exist
+	output:
+		*WriteBehindStorage
+	err:
+		the queue file can not be read or the backend fails
+*/
+func OpenWriteBehindStorage(backend Storage, queuePath string) (*WriteBehindStorage, error) {
+	queue, err := os.OpenFile(queuePath, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	s := &WriteBehindStorage{
+		memory:  NewMemoryStorage(),
+		backend: backend,
+		queue:   queue,
+		drained: make(chan struct{}),
+	}
+	s.queueChanged = sync.NewCond(&s.queueLock)
+
+	err = s.recover()
+	if err != nil {
+		queue.Close()
+		return nil, err
+	}
+
+	go s.drain()
+	return s, nil
+}
+
+// recover applies the queued batches to the backend, then loads the backend into memory and empties the queue
+func (s *WriteBehindStorage) recover() error {
+	batches, err := readWriteBehindQueue(s.queue)
+	if err != nil {
+		return err
+	}
+	for _, batch := range batches {
+		err = s.apply(batch)
+		if err != nil {
+			return err
+		}
+	}
+
+	conn := s.backend.Get()
+	applied, err := appliedSequence(conn)
+	conn.Close()
+	if err != nil {
+		return err
+	}
+
+	entries, err := s.backend.Export()
+	if err != nil {
+		return err
+	}
+	state := make([]Entry, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Key != WRITE_BEHIND_SEQUENCE_KEY {
+			state = append(state, entry)
+		}
+	}
+	err = s.memory.Import(state)
+	if err != nil {
+		return err
+	}
+
+	s.nextSequence = applied + 1
+	return s.queue.Truncate(0)
+}
+
+// readWriteBehindQueue reads the batches of the queue file, a torn last line was never acknowledged and is skipped
+func readWriteBehindQueue(queue *os.File) ([]writeBehindBatch, error) {
+	_, err := queue.Seek(0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var lines [][]byte
+	scanner := bufio.NewScanner(queue)
+	scanner.Buffer(make([]byte, 64*1024), 1<<30)
+	for scanner.Scan() {
+		lines = append(lines, append([]byte{}, scanner.Bytes()...))
+	}
+	if scanner.Err() != nil {
+		return nil, scanner.Err()
+	}
+
+	batches := []writeBehindBatch{}
+	for i, line := range lines {
+		var batch writeBehindBatch
+		err = json.Unmarshal(line, &batch)
+		if err != nil && i == len(lines)-1 {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("write-behind queue: line %d: %v", i+1, err)
+		}
+		batches = append(batches, batch)
+	}
+	return batches, nil
+}
+
+func (s *WriteBehindStorage) Get() Conn {
+	return &writeBehindConn{storage: s, memory: s.memory.Get()}
+}
+
+// Export returns the state in memory, including the batches the backend has not applied yet
+func (s *WriteBehindStorage) Export() ([]Entry, error) {
+	return s.memory.Export()
+}
+
+/*
+		Close waits for the drainer to apply the queued batches, then closes the backend.
+		Once closed, a batch the backend fails to apply is not retried: it and the batches after it stay in the queue file,
+		which is fsync'd, and are applied by the next OpenWriteBehindStorage.
+*/
+func (s *WriteBehindStorage) Close() error {
+	s.queueLock.Lock()
+	s.closed = true
+	s.queueChanged.Broadcast()
+	s.queueLock.Unlock()
+
+	<-s.drained
+	s.queueLock.Lock()
+	unapplied := len(s.pending)
+	s.queueLock.Unlock()
+
+	s.queue.Close()
+	err := s.backend.Close()
+	if unapplied > 0 {
+		return fmt.Errorf("write-behind: %d batches are not applied, they stay in the queue for the next start", unapplied)
+	}
+	return err
+}
+
+// enqueue appends a batch to the queue file and fsyncs it. MUST hold s.lock.
+func (s *WriteBehindStorage) enqueue(commands []writeBehindCommand) error {
+	if len(commands) == 0 {
+		return nil
+	}
+
+	s.queueLock.Lock()
+	defer s.queueLock.Unlock()
+	if s.closed {
+		return fmt.Errorf("write-behind: storage is closed")
+	}
+
+	batch := writeBehindBatch{Sequence: s.nextSequence, Commands: commands}
+	line, err := json.Marshal(batch)
+	if err != nil {
+		return err
+	}
+	_, err = s.queue.Write(append(line, '\n'))
+	if err == nil {
+		err = s.queue.Sync()
+	}
+	if err != nil {
+		return fmt.Errorf("write-behind: can not queue batch %d: %v", batch.Sequence, err)
+	}
+
+	s.nextSequence++
+	s.pending = append(s.pending, batch)
+	s.queueChanged.Signal()
+	return nil
+}
+
+// drain applies the pending batches to the backend in order, and empties the queue file when all are applied.
+// A failed batch is retried until the storage is closed, then the drainer stops and leaves the queue file as it is.
+func (s *WriteBehindStorage) drain() {
+	defer close(s.drained)
+	for {
+		s.queueLock.Lock()
+		for len(s.pending) == 0 && !s.closed {
+			s.queueChanged.Wait()
+		}
+		if len(s.pending) == 0 {
+			s.queueLock.Unlock()
+			return
+		}
+		batch := s.pending[0]
+		s.queueLock.Unlock()
+
+		err := s.apply(batch)
+		if err != nil {
+			log.Println("write-behind: can not apply batch", batch.Sequence, err)
+			s.queueLock.Lock()
+			closed := s.closed
+			s.queueLock.Unlock()
+			if closed {
+				return
+			}
+			time.Sleep(WriteBehindRetryInterval)
+			continue
+		}
+
+		s.queueLock.Lock()
+		s.pending = s.pending[1:]
+		if len(s.pending) == 0 {
+			err = s.queue.Truncate(0)
+			if err != nil {
+				log.Println("write-behind: can not empty the queue", err)
+			}
+		}
+		s.queueLock.Unlock()
+	}
+}
+
+// apply applies a batch to the backend, unless the backend has already applied it
+func (s *WriteBehindStorage) apply(batch writeBehindBatch) error {
+	conn := s.backend.Get()
+	defer conn.Close()
+
+	applied, err := appliedSequence(conn)
+	if err != nil {
+		return err
+	}
+	if batch.Sequence <= applied {
+		return nil
+	}
+
+	return conn.Atomically(func(conn Conn) error {
+		for _, command := range batch.Commands {
+			err := applyWriteBehindCommand(conn, command)
+			if err != nil {
+				return err
+			}
+		}
+		return conn.Set(WRITE_BEHIND_SEQUENCE_KEY, strconv.FormatInt(batch.Sequence, 10))
+	})
+}
+
+// appliedSequence returns the sequence of the last batch the backend applied, 0 if none
+func appliedSequence(conn Conn) (int64, error) {
+	value, err := conn.Get(WRITE_BEHIND_SEQUENCE_KEY)
+	if err == ErrNil {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(value, 10, 64)
+}
+
+func applyWriteBehindCommand(conn Conn, command writeBehindCommand) error {
+	args := command.Args
+	argc := map[string]int{
+		"HSET": 3, "HDEL": 2, "SET": 2, "DEL": 1, "RENAME": 2, "EXPIRE": 2, "FLUSHALL": 0,
+		"ZADD": 3, "ZREM": 2, "ZREMRANGEBYSCORE": 3, "LPUSH": 2, "RPUSH": 2, "SADD": 2, "SREM": 2,
+	}
+	expected, known := argc[command.Name]
+	if command.Name == "HMSET" {
+		// key, then field value pairs
+		known, expected = true, len(args)
+		if len(args) < 3 || len(args)%2 == 0 {
+			expected = -1
+		}
+	}
+	if !known {
+		return fmt.Errorf("write-behind: unknown command %s", command.Name)
+	}
+	if len(args) != expected {
+		return fmt.Errorf("write-behind: wrong number of arguments for %s", command.Name)
+	}
+
+	switch command.Name {
+	case "HSET":
+		return conn.HSet(args[0], args[1], args[2])
+	case "HMSET":
+		fieldValueMap := map[string]interface{}{}
+		for i := 1; i+1 < len(args); i += 2 {
+			fieldValueMap[args[i]] = args[i+1]
+		}
+		return conn.HMSet(args[0], fieldValueMap)
+	case "HDEL":
+		return conn.HDel(args[0], args[1])
+	case "SET":
+		return conn.Set(args[0], args[1])
+	case "DEL":
+		return conn.Delete(args[0])
+	case "RENAME":
+		return conn.Rename(args[0], args[1])
+	case "EXPIRE":
+		seconds, err := strconv.Atoi(args[1])
+		if err != nil {
+			return err
+		}
+		return conn.Expire(args[0], seconds)
+	case "FLUSHALL":
+		return conn.FlushAll()
+	case "ZADD":
+		return conn.ZAdd(args[0], args[1], args[2])
+	case "ZREM":
+		return conn.ZRem(args[0], args[1])
+	case "ZREMRANGEBYSCORE":
+		return conn.ZRemRangeByScore(args[0], args[1], args[2])
+	case "LPUSH":
+		return conn.LPush(args[0], args[1])
+	case "RPUSH":
+		return conn.RPush(args[0], args[1])
+	case "SADD":
+		return conn.SAdd(args[0], args[1])
+	default:
+		return conn.SRem(args[0], args[1])
+	}
+}
+
+// writeBehindConn reads from memory, and writes to memory and the batch of its Atomically
+type writeBehindConn struct {
+	storage *WriteBehindStorage
+	memory  Conn
+	// the writes of the transaction, nil outside Atomically
+	batch *[]writeBehindCommand
+}
+
+// record adds a write which succeeded in memory to the batch
+func (c *writeBehindConn) record(name string, args ...interface{}) {
+	command := writeBehindCommand{Name: name, Args: make([]string, len(args))}
+	for i, arg := range args {
+		command.Args[i] = formatArg(arg)
+	}
+	*c.batch = append(*c.batch, command)
+}
+
+// write runs a write in memory and records it, in its own Atomically outside a transaction
+func (c *writeBehindConn) write(command func(c *writeBehindConn) error) error {
+	if c.batch != nil {
+		return command(c)
+	}
+	return c.Atomically(func(conn Conn) error {
+		return command(conn.(*writeBehindConn))
+	})
+}
+
+func (c *writeBehindConn) Ping() error {
+	return c.memory.Ping()
+}
+
+func (c *writeBehindConn) HSet(key string, field string, value interface{}) error {
+	return c.write(func(c *writeBehindConn) error {
+		err := c.memory.HSet(key, field, value)
+		if err == nil {
+			c.record("HSET", key, field, value)
+		}
+		return err
+	})
+}
+
+func (c *writeBehindConn) HMSet(key string, fieldValueMap map[string]interface{}) error {
+	return c.write(func(c *writeBehindConn) error {
+		err := c.memory.HMSet(key, fieldValueMap)
+		if err == nil && len(fieldValueMap) > 0 {
+			args := []interface{}{key}
+			for field, value := range fieldValueMap {
+				args = append(args, field, value)
+			}
+			c.record("HMSET", args...)
+		}
+		return err
+	})
+}
+
+func (c *writeBehindConn) HGet(key string, field string) (string, error) {
+	return c.memory.HGet(key, field)
+}
+
+func (c *writeBehindConn) HMGet(key string, fields []string) ([]string, error) {
+	return c.memory.HMGet(key, fields)
+}
+
+func (c *writeBehindConn) HExists(key string, field string) (bool, error) {
+	return c.memory.HExists(key, field)
+}
+
+// HIncrByFloat is recorded as HSET of the result, so the backend ends with exactly the value in memory
+func (c *writeBehindConn) HIncrByFloat(key string, field string, amount float64) (string, error) {
+	var result string
+	err := c.write(func(c *writeBehindConn) error {
+		var err error
+		result, err = c.memory.HIncrByFloat(key, field, amount)
+		if err == nil {
+			c.record("HSET", key, field, result)
+		}
+		return err
+	})
+	return result, err
+}
+
+func (c *writeBehindConn) HIncrBy(key string, field string, amount int) (int, error) {
+	var result int
+	err := c.write(func(c *writeBehindConn) error {
+		var err error
+		result, err = c.memory.HIncrBy(key, field, amount)
+		if err == nil {
+			c.record("HSET", key, field, result)
+		}
+		return err
+	})
+	return result, err
+}
+
+func (c *writeBehindConn) HDel(key string, field string) error {
+	return c.write(func(c *writeBehindConn) error {
+		err := c.memory.HDel(key, field)
+		if err == nil {
+			c.record("HDEL", key, field)
+		}
+		return err
+	})
+}
+
+func (c *writeBehindConn) Get(key string) (string, error) {
+	return c.memory.Get(key)
+}
+
+func (c *writeBehindConn) Set(key string, value string) error {
+	return c.write(func(c *writeBehindConn) error {
+		err := c.memory.Set(key, value)
+		if err == nil {
+			c.record("SET", key, value)
+		}
+		return err
+	})
+}
+
+func (c *writeBehindConn) Incr(key string) (int, error) {
+	var result int
+	err := c.write(func(c *writeBehindConn) error {
+		var err error
+		result, err = c.memory.Incr(key)
+		if err == nil {
+			c.record("SET", key, result)
+		}
+		return err
+	})
+	return result, err
+}
+
+// SetNXWithExpire is recorded as SET and EXPIRE, the key expires in the backend a little later than in memory
+func (c *writeBehindConn) SetNXWithExpire(key string, value string, seconds int) (bool, error) {
+	set := false
+	err := c.write(func(c *writeBehindConn) error {
+		var err error
+		set, err = c.memory.SetNXWithExpire(key, value, seconds)
+		if err == nil && set {
+			c.record("SET", key, value)
+			c.record("EXPIRE", key, seconds)
+		}
+		return err
+	})
+	return set, err
+}
+
+func (c *writeBehindConn) Exists(key string) (bool, error) {
+	return c.memory.Exists(key)
+}
+
+func (c *writeBehindConn) Rename(key string, newKey string) error {
+	return c.write(func(c *writeBehindConn) error {
+		err := c.memory.Rename(key, newKey)
+		if err == nil {
+			c.record("RENAME", key, newKey)
+		}
+		return err
+	})
+}
+
+func (c *writeBehindConn) Scan(pattern string) ([]string, error) {
+	return c.memory.Scan(pattern)
+}
+
+func (c *writeBehindConn) Delete(key string) error {
+	return c.write(func(c *writeBehindConn) error {
+		err := c.memory.Delete(key)
+		if err == nil {
+			c.record("DEL", key)
+		}
+		return err
+	})
+}
+
+func (c *writeBehindConn) Expire(key string, seconds int) error {
+	return c.write(func(c *writeBehindConn) error {
+		err := c.memory.Expire(key, seconds)
+		if err == nil {
+			c.record("EXPIRE", key, seconds)
+		}
+		return err
+	})
+}
+
+func (c *writeBehindConn) FlushAll() error {
+	return c.write(func(c *writeBehindConn) error {
+		err := c.memory.FlushAll()
+		if err == nil {
+			c.record("FLUSHALL")
+		}
+		return err
+	})
+}
+
+func (c *writeBehindConn) ZAdd(setName string, score interface{}, key string) error {
+	return c.write(func(c *writeBehindConn) error {
+		err := c.memory.ZAdd(setName, score, key)
+		if err == nil {
+			c.record("ZADD", setName, score, key)
+		}
+		return err
+	})
+}
+
+func (c *writeBehindConn) ZRem(setName string, key string) error {
+	return c.write(func(c *writeBehindConn) error {
+		err := c.memory.ZRem(setName, key)
+		if err == nil {
+			c.record("ZREM", setName, key)
+		}
+		return err
+	})
+}
+
+func (c *writeBehindConn) ZRange(setName string, start int, stop int, withScores bool) ([]string, error) {
+	return c.memory.ZRange(setName, start, stop, withScores)
+}
+
+func (c *writeBehindConn) ZRevRange(setName string, start int, stop int, withScores bool) ([]string, error) {
+	return c.memory.ZRevRange(setName, start, stop, withScores)
+}
+
+func (c *writeBehindConn) ZRangeByScore(setName string, min interface{}, max interface{}) ([]string, error) {
+	return c.memory.ZRangeByScore(setName, min, max)
+}
+
+func (c *writeBehindConn) ZRangeByScoreWithLimit(setName string, min interface{}, max interface{}, offset int, count int) ([]string, error) {
+	return c.memory.ZRangeByScoreWithLimit(setName, min, max, offset, count)
+}
+
+func (c *writeBehindConn) ZRevRangeByScoreWithLimit(setName string, max interface{}, min interface{}, offset int, count int) ([]string, error) {
+	return c.memory.ZRevRangeByScoreWithLimit(setName, max, min, offset, count)
+}
+
+func (c *writeBehindConn) ZRemRangeByScore(setName string, min interface{}, max interface{}) error {
+	return c.write(func(c *writeBehindConn) error {
+		err := c.memory.ZRemRangeByScore(setName, min, max)
+		if err == nil {
+			c.record("ZREMRANGEBYSCORE", setName, min, max)
+		}
+		return err
+	})
+}
+
+func (c *writeBehindConn) ZCard(setName string) (int, error) {
+	return c.memory.ZCard(setName)
+}
+
+func (c *writeBehindConn) LPush(listName string, node string) error {
+	return c.write(func(c *writeBehindConn) error {
+		err := c.memory.LPush(listName, node)
+		if err == nil {
+			c.record("LPUSH", listName, node)
+		}
+		return err
+	})
+}
+
+func (c *writeBehindConn) RPush(listName string, node string) error {
+	return c.write(func(c *writeBehindConn) error {
+		err := c.memory.RPush(listName, node)
+		if err == nil {
+			c.record("RPUSH", listName, node)
+		}
+		return err
+	})
+}
+
+func (c *writeBehindConn) LRange(listName string, start int, stop int) ([]string, error) {
+	return c.memory.LRange(listName, start, stop)
+}
+
+func (c *writeBehindConn) LLen(listName string) (int, error) {
+	return c.memory.LLen(listName)
+}
+
+func (c *writeBehindConn) SAdd(setName string, member string) error {
+	return c.write(func(c *writeBehindConn) error {
+		err := c.memory.SAdd(setName, member)
+		if err == nil {
+			c.record("SADD", setName, member)
+		}
+		return err
+	})
+}
+
+func (c *writeBehindConn) SRem(setName string, member string) error {
+	return c.write(func(c *writeBehindConn) error {
+		err := c.memory.SRem(setName, member)
+		if err == nil {
+			c.record("SREM", setName, member)
+		}
+		return err
+	})
+}
+
+func (c *writeBehindConn) SIsMember(setName string, member string) (bool, error) {
+	return c.memory.SIsMember(setName, member)
+}
+
+func (c *writeBehindConn) SMembers(setName string) ([]string, error) {
+	return c.memory.SMembers(setName)
+}
+
+// Atomically runs step in a transaction of memory, and queues its writes as one batch when it succeeds.
+// If the batch can not be queued, the writes are undone in memory and the error is returned.
+func (c *writeBehindConn) Atomically(step func(conn Conn) error) error {
+	if c.batch != nil {
+		return step(c)
+	}
+
+	c.storage.lock.Lock()
+	defer c.storage.lock.Unlock()
+	return c.memory.Atomically(func(memory Conn) error {
+		transaction := &writeBehindConn{storage: c.storage, memory: memory, batch: &[]writeBehindCommand{}}
+		err := step(transaction)
+		if err != nil {
+			return err
+		}
+		return c.storage.enqueue(*transaction.batch)
+	})
+}
+
+func (c *writeBehindConn) Close() error {
+	return c.memory.Close()
+}
@@ -1,19 +1,60 @@
 package uniqueKeyGenerator
 
 import (
-	redis "app/redis"
-
-	redigo "github.com/gomodule/redigo/redis"
+	"app/storage"
 )
 
 const (
-	DB_KEY_FOR_ORDER_ID_GENERATOR = "orderIdCounter"
+	DB_KEY_FOR_ORDER_ID_GENERATOR               = "orderIdCounter"
+	DB_KEY_FOR_ORDER_BOOK_SNAPSHOT_ID_GENERATOR = "orderBookSnapshotIdCounter"
+	DB_KEY_FOR_TRADE_ID_GENERATOR               = "tradeIdCounter"
+	DB_KEY_FOR_CASH_MOVEMENT_ID_GENERATOR       = "cashMovementIdCounter"
+	DB_KEY_FOR_JOURNAL_ENTRY_ID_GENERATOR       = "journalEntryIdCounter"
+	DB_KEY_FOR_TRANSFER_ID_GENERATOR            = "transferIdCounter"
+	DB_KEY_FOR_KILL_SWITCH_EVENT_ID_GENERATOR   = "killSwitchEventIdCounter"
+	DB_KEY_FOR_SYMBOL_DEPOSIT_ID_GENERATOR      = "symbolDepositIdCounter"
 )
 
-func GetNewOrderId(pool *redigo.Pool) (int, error) {
-	connection := pool.Get()
-	defer connection.Close()
-	conn := (&connection)
+func GetNewOrderId(store storage.Storage) (int, error) {
+	conn := store.Get()
+	defer conn.Close()
+
+	return conn.Incr(DB_KEY_FOR_ORDER_ID_GENERATOR)
+}
+
+// GetNewTradeId works on the caller's connection, since trades are generated in the middle of a match
+func GetNewTradeId(conn storage.Conn) (int, error) {
+	return conn.Incr(DB_KEY_FOR_TRADE_ID_GENERATOR)
+}
+
+// GetNewCashMovementId works on the caller's connection, since cash movements are recorded with the balance change
+func GetNewCashMovementId(conn storage.Conn) (int, error) {
+	return conn.Incr(DB_KEY_FOR_CASH_MOVEMENT_ID_GENERATOR)
+}
+
+// GetNewJournalEntryId works on the caller's connection, since journal entries are posted with the balance changes
+func GetNewJournalEntryId(conn storage.Conn) (int, error) {
+	return conn.Incr(DB_KEY_FOR_JOURNAL_ENTRY_ID_GENERATOR)
+}
+
+// GetNewTransferId works on the caller's connection, since transfers are recorded with the balance changes
+func GetNewTransferId(conn storage.Conn) (int, error) {
+	return conn.Incr(DB_KEY_FOR_TRANSFER_ID_GENERATOR)
+}
+
+// GetNewKillSwitchEventId works on the caller's connection, since kill switch events are recorded with the cancels
+func GetNewKillSwitchEventId(conn storage.Conn) (int, error) {
+	return conn.Incr(DB_KEY_FOR_KILL_SWITCH_EVENT_ID_GENERATOR)
+}
+
+// GetNewSymbolDepositId works on the caller's connection, since symbol deposits are recorded with the position change
+func GetNewSymbolDepositId(conn storage.Conn) (int, error) {
+	return conn.Incr(DB_KEY_FOR_SYMBOL_DEPOSIT_ID_GENERATOR)
+}
+
+func GetNewOrderBookSnapshotId(store storage.Storage) (int, error) {
+	conn := store.Get()
+	defer conn.Close()
 
-	return redis.Incr(conn, DB_KEY_FOR_ORDER_ID_GENERATOR)
+	return conn.Incr(DB_KEY_FOR_ORDER_BOOK_SNAPSHOT_ID_GENERATOR)
 }
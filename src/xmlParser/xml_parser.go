@@ -8,11 +8,27 @@ import (
 	"github.com/beevik/etree"
 )
 
+const (
+	DEFAULT_ORDER_BOOK_DEPTH    = 10
+	DEFAULT_SNAPSHOT_PAGE_LIMIT = 100
+	DEFAULT_TRADES_LIMIT        = 100
+	DEFAULT_ORDERS_LIMIT        = 100
+	DEFAULT_LEDGER_LIMIT        = 100
+	DEFAULT_JOURNAL_LIMIT       = 100
+	DEFAULT_TRANSFERS_LIMIT     = 100
+	DEFAULT_KILL_SWITCH_LIMIT   = 100
+)
+
 type Parser interface {
 	Parse(string) ([]cmd.Command, error)
 }
 
-type XmlParser struct{}
+// XmlParser parses a request signed by the api key of account Uid,
+// only admin keys can send <create> and <admin> requests
+type XmlParser struct {
+	Uid   string
+	Admin bool
+}
 
 func (parser *XmlParser) Parse(xml string) ([]cmd.Command, error) {
 	request := etree.NewDocument()
@@ -26,6 +42,10 @@ func (parser *XmlParser) Parse(xml string) ([]cmd.Command, error) {
 	createElement := request.SelectElement("create")
 	if createElement != nil {
 		// create
+		if !parser.Admin {
+			return []cmd.Command{}, fmt.Errorf("permission denied")
+		}
+
 		for _, req := range createElement.ChildElements() {
 			if req.Tag == "account" {
 				uid, balance_in_string := readElementWith2Attr(req, "id", "balance")
@@ -81,6 +101,9 @@ func (parser *XmlParser) Parse(xml string) ([]cmd.Command, error) {
 		if uid == "" {
 			return []cmd.Command{}, fmt.Errorf("xml format error")
 		}
+		if uid != parser.Uid {
+			return []cmd.Command{}, fmt.Errorf("permission denied")
+		}
 
 		for _, req := range transactionElement.ChildElements() {
 			if req.Tag == "order" {
@@ -105,6 +128,7 @@ func (parser *XmlParser) Parse(xml string) ([]cmd.Command, error) {
 				if amount < 0 {
 					commandList = append(commandList,
 						&cmd.SetSellOrderCommand{
+							ClOrdId:    readElementWith1Attr(req, "clOrdId"),
 							Uid:        uid,
 							SymbolName: symbolName,
 							LimitPrice: limitPrice,
@@ -114,36 +138,479 @@ func (parser *XmlParser) Parse(xml string) ([]cmd.Command, error) {
 				if amount > 0 {
 					commandList = append(commandList,
 						&cmd.SetBuyOrderCommand{
+							ClOrdId:    readElementWith1Attr(req, "clOrdId"),
 							Uid:        uid,
 							SymbolName: symbolName,
 							LimitPrice: limitPrice,
 							Amount:     amount})
 				}
+			} else if req.Tag == "orders" {
+				limit := DEFAULT_ORDERS_LIMIT
+				var from, to int64
+				var err error
+				if attrExists(req, "limit") {
+					limit, err = strconv.Atoi(readElementWith1Attr(req, "limit"))
+					if err != nil {
+						return []cmd.Command{}, fmt.Errorf("xml format error")
+					}
+				}
+				if attrExists(req, "from") {
+					from, err = strconv.ParseInt(readElementWith1Attr(req, "from"), 10, 64)
+					if err != nil {
+						return []cmd.Command{}, fmt.Errorf("xml format error")
+					}
+				}
+				if attrExists(req, "to") {
+					to, err = strconv.ParseInt(readElementWith1Attr(req, "to"), 10, 64)
+					if err != nil {
+						return []cmd.Command{}, fmt.Errorf("xml format error")
+					}
+				}
+
+				commandList = append(commandList,
+					&cmd.QueryAccountOrdersCommand{
+						Uid:        uid,
+						Status:     readElementWith1Attr(req, "status"),
+						SymbolName: readElementWith1Attr(req, "sym"),
+						OrderType:  readElementWith1Attr(req, "side"),
+						From:       from,
+						To:         to,
+						Cursor:     readElementWith1Attr(req, "cursor"),
+						Limit:      limit})
+			} else if req.Tag == "query" && attrExists(req, "account") {
+				commandList = append(commandList,
+					&cmd.QueryAccountCommand{
+						Uid:       uid,
+						AccountId: readElementWith1Attr(req, "account")})
 			} else if req.Tag == "query" {
-				orderId := readElementWith1Attr(req, "id")
-				if orderId == "" {
+				orderId, clOrdId := readElementWith1Attr(req, "id"), readElementWith1Attr(req, "clOrdId")
+				if orderId == "" && clOrdId == "" {
 					return []cmd.Command{}, fmt.Errorf("xml format error")
 				}
 
 				commandList = append(commandList,
 					&cmd.QueryOrderStatusAndHistoryCommand{
-						OrderId: orderId})
+						Uid:     uid,
+						OrderId: orderId,
+						ClOrdId: clOrdId})
 			} else if req.Tag == "cancel" {
-				orderId := readElementWith1Attr(req, "id")
-				if orderId == "" {
+				orderId, clOrdId := readElementWith1Attr(req, "id"), readElementWith1Attr(req, "clOrdId")
+				if orderId == "" && clOrdId == "" {
 					return []cmd.Command{}, fmt.Errorf("xml format error")
 				}
 
 				commandList = append(commandList,
 					&cmd.CancelOpenOrderCommand{
-						OrderId: orderId})
+						Uid:     uid,
+						OrderId: orderId,
+						ClOrdId: clOrdId})
+			} else if req.Tag == "book" {
+				symbolName := readElementWith1Attr(req, "sym")
+				if symbolName == "" {
+					return []cmd.Command{}, fmt.Errorf("xml format error")
+				}
+
+				depth := DEFAULT_ORDER_BOOK_DEPTH
+				if attrExists(req, "depth") {
+					var err error
+					depth, err = strconv.Atoi(readElementWith1Attr(req, "depth"))
+					if err != nil {
+						return []cmd.Command{}, fmt.Errorf("xml format error")
+					}
+				}
+
+				commandList = append(commandList,
+					&cmd.QueryOrderBookDepthCommand{
+						SymbolName: symbolName,
+						Depth:      depth})
+			} else if req.Tag == "ticker" {
+				symbolName := readElementWith1Attr(req, "sym")
+				if symbolName == "" {
+					return []cmd.Command{}, fmt.Errorf("xml format error")
+				}
+
+				commandList = append(commandList,
+					&cmd.QueryTickerCommand{
+						SymbolName: symbolName})
+			} else if req.Tag == "candles" {
+				symbolName, interval := readElementWith2Attr(req, "sym", "interval")
+				from_in_string, to_in_string := readElementWith2Attr(req, "from", "to")
+				if symbolName == "" || interval == "" || from_in_string == "" || to_in_string == "" {
+					return []cmd.Command{}, fmt.Errorf("xml format error")
+				}
+
+				var from, to int64
+				var err error
+				from, err = strconv.ParseInt(from_in_string, 10, 64)
+				if err != nil {
+					return []cmd.Command{}, fmt.Errorf("xml format error")
+				}
+
+				to, err = strconv.ParseInt(to_in_string, 10, 64)
+				if err != nil {
+					return []cmd.Command{}, fmt.Errorf("xml format error")
+				}
+
+				commandList = append(commandList,
+					&cmd.QueryCandlesCommand{
+						SymbolName: symbolName,
+						Interval:   interval,
+						From:       from,
+						To:         to})
+			} else if req.Tag == "trades" {
+				symbolName := readElementWith1Attr(req, "sym")
+				if symbolName == "" {
+					return []cmd.Command{}, fmt.Errorf("xml format error")
+				}
+
+				sinceTradeId := 0
+				limit := DEFAULT_TRADES_LIMIT
+				var err error
+				if attrExists(req, "since") {
+					sinceTradeId, err = strconv.Atoi(readElementWith1Attr(req, "since"))
+					if err != nil {
+						return []cmd.Command{}, fmt.Errorf("xml format error")
+					}
+				}
+				if attrExists(req, "limit") {
+					limit, err = strconv.Atoi(readElementWith1Attr(req, "limit"))
+					if err != nil {
+						return []cmd.Command{}, fmt.Errorf("xml format error")
+					}
+				}
+
+				commandList = append(commandList,
+					&cmd.QueryTradesCommand{
+						SymbolName:   symbolName,
+						SinceTradeId: sinceTradeId,
+						Limit:        limit})
+			} else if req.Tag == "withdraw" {
+				amount_in_string := readElementWith1Attr(req, "amount")
+				if amount_in_string == "" {
+					return []cmd.Command{}, fmt.Errorf("xml format error")
+				}
+
+				amount, err := strconv.ParseFloat(amount_in_string, 64)
+				if err != nil {
+					return []cmd.Command{}, fmt.Errorf("xml format error")
+				}
+
+				commandList = append(commandList,
+					&cmd.WithdrawCommand{
+						Uid:    uid,
+						Amount: amount,
+						Reason: readElementWith1Attr(req, "reason")})
+			} else if req.Tag == "ledger" || req.Tag == "journal" {
+				since := 0
+				limit := DEFAULT_LEDGER_LIMIT
+				if req.Tag == "journal" {
+					limit = DEFAULT_JOURNAL_LIMIT
+				}
+				var err error
+				if attrExists(req, "since") {
+					since, err = strconv.Atoi(readElementWith1Attr(req, "since"))
+					if err != nil {
+						return []cmd.Command{}, fmt.Errorf("xml format error")
+					}
+				}
+				if attrExists(req, "limit") {
+					limit, err = strconv.Atoi(readElementWith1Attr(req, "limit"))
+					if err != nil {
+						return []cmd.Command{}, fmt.Errorf("xml format error")
+					}
+				}
+
+				if req.Tag == "ledger" {
+					commandList = append(commandList,
+						&cmd.QueryCashLedgerCommand{
+							Uid:             uid,
+							SinceMovementId: since,
+							Limit:           limit})
+				} else {
+					commandList = append(commandList,
+						&cmd.QueryJournalCommand{
+							Uid:          uid,
+							SinceEntryId: since,
+							Limit:        limit})
+				}
+			} else {
+				return []cmd.Command{}, fmt.Errorf("xml format error")
+			}
+		}
+	}
+
+	adminElement := request.SelectElement("admin")
+	if adminElement != nil {
+		// admin
+		if len(adminElement.ChildElements()) == 0 {
+			return []cmd.Command{}, fmt.Errorf("xml format error")
+		}
+
+		adminUid := readElementWith1Attr(adminElement, "id")
+		if adminUid == "" {
+			return []cmd.Command{}, fmt.Errorf("xml format error")
+		}
+		if !parser.Admin || adminUid != parser.Uid {
+			return []cmd.Command{}, fmt.Errorf("permission denied")
+		}
+
+		for _, req := range adminElement.ChildElements() {
+			if req.Tag == "orderbook" {
+				symbolName := readElementWith1Attr(req, "sym")
+				if symbolName == "" {
+					return []cmd.Command{}, fmt.Errorf("xml format error")
+				}
+
+				limit := DEFAULT_SNAPSHOT_PAGE_LIMIT
+				if attrExists(req, "limit") {
+					var err error
+					limit, err = strconv.Atoi(readElementWith1Attr(req, "limit"))
+					if err != nil {
+						return []cmd.Command{}, fmt.Errorf("xml format error")
+					}
+				}
+
+				commandList = append(commandList,
+					&cmd.QueryOrderBookSnapshotCommand{
+						AdminUid:   adminUid,
+						SymbolName: symbolName,
+						Cursor:     readElementWith1Attr(req, "cursor"),
+						Limit:      limit})
+			} else if req.Tag == "reconcile" {
+				commandList = append(commandList,
+					&cmd.ReconcileCommand{
+						AdminUid: adminUid})
+			} else if req.Tag == "deposit" {
+				accountId, amount_in_string := readElementWith2Attr(req, "account", "amount")
+				if accountId == "" || amount_in_string == "" {
+					return []cmd.Command{}, fmt.Errorf("xml format error")
+				}
+
+				amount, err := strconv.ParseFloat(amount_in_string, 64)
+				if err != nil {
+					return []cmd.Command{}, fmt.Errorf("xml format error")
+				}
+
+				commandList = append(commandList,
+					&cmd.DepositCommand{
+						AdminUid: adminUid,
+						Uid:      accountId,
+						Amount:   amount,
+						Reason:   readElementWith1Attr(req, "reason")})
+			} else if req.Tag == "transfer" {
+				fromUid, toUid, amount_in_string := readElementWith3Attr(req, "from", "to", "amount")
+				if fromUid == "" || toUid == "" || amount_in_string == "" {
+					return []cmd.Command{}, fmt.Errorf("xml format error")
+				}
+
+				amount, err := strconv.ParseFloat(amount_in_string, 64)
+				if err != nil {
+					return []cmd.Command{}, fmt.Errorf("xml format error")
+				}
+
+				commandList = append(commandList,
+					&cmd.TransferCommand{
+						AdminUid:   adminUid,
+						FromUid:    fromUid,
+						ToUid:      toUid,
+						SymbolName: readElementWith1Attr(req, "sym"),
+						Amount:     amount,
+						Reason:     readElementWith1Attr(req, "reason")})
+			} else if req.Tag == "freeze" || req.Tag == "unfreeze" || req.Tag == "close" {
+				accountId := readElementWith1Attr(req, "account")
+				if accountId == "" {
+					return []cmd.Command{}, fmt.Errorf("xml format error")
+				}
+
+				if req.Tag == "freeze" {
+					commandList = append(commandList,
+						&cmd.FreezeAccountCommand{
+							AdminUid:     adminUid,
+							AccountId:    accountId,
+							CancelOrders: readElementWith1Attr(req, "cancel") == "true"})
+				} else if req.Tag == "unfreeze" {
+					commandList = append(commandList,
+						&cmd.UnfreezeAccountCommand{
+							AdminUid:  adminUid,
+							AccountId: accountId})
+				} else {
+					commandList = append(commandList,
+						&cmd.CloseAccountCommand{
+							AdminUid:  adminUid,
+							AccountId: accountId})
+				}
+			} else if req.Tag == "apikey" {
+				accountId := readElementWith1Attr(req, "account")
+				if accountId == "" {
+					return []cmd.Command{}, fmt.Errorf("xml format error")
+				}
+
+				commandList = append(commandList,
+					&cmd.CreateApiKeyCommand{
+						AdminUid:  adminUid,
+						AccountId: accountId})
+			} else if req.Tag == "revoke" {
+				keyId := readElementWith1Attr(req, "key")
+				if keyId == "" {
+					return []cmd.Command{}, fmt.Errorf("xml format error")
+				}
+
+				commandList = append(commandList,
+					&cmd.RevokeApiKeyCommand{
+						AdminUid: adminUid,
+						KeyId:    keyId})
+			} else if req.Tag == "ratelimit" {
+				accountId := readElementWith1Attr(req, "account")
+				if accountId == "" {
+					return []cmd.Command{}, fmt.Errorf("xml format error")
+				}
+
+				limits := map[string]int{}
+				for _, kind := range []string{"orders", "cancels", "messages"} {
+					if attrExists(req, kind) {
+						limit, err := strconv.Atoi(readElementWith1Attr(req, kind))
+						if err != nil {
+							return []cmd.Command{}, fmt.Errorf("xml format error")
+						}
+						limits[kind] = limit
+					}
+				}
+
+				commandList = append(commandList,
+					&cmd.SetRateLimitsCommand{
+						AdminUid:  adminUid,
+						AccountId: accountId,
+						Limits:    limits})
+			} else if req.Tag == "risklimit" {
+				accountId := readElementWith1Attr(req, "account")
+				symbolName := readElementWith1Attr(req, "sym")
+				if accountId == "" && symbolName == "" {
+					return []cmd.Command{}, fmt.Errorf("xml format error")
+				}
+
+				var limits [4]float64
+				for i, key := range []string{"maxAmount", "maxNotional", "maxGross", "maxNet"} {
+					if attrExists(req, key) {
+						var err error
+						limits[i], err = strconv.ParseFloat(readElementWith1Attr(req, key), 64)
+						if err != nil {
+							return []cmd.Command{}, fmt.Errorf("xml format error")
+						}
+					}
+				}
+				// a count of orders, "2.5" is rejected instead of truncated
+				maxOpenOrders := 0
+				if attrExists(req, "maxOpenOrders") {
+					var err error
+					maxOpenOrders, err = strconv.Atoi(readElementWith1Attr(req, "maxOpenOrders"))
+					if err != nil {
+						return []cmd.Command{}, fmt.Errorf("xml format error")
+					}
+				}
+
+				commandList = append(commandList,
+					&cmd.SetRiskLimitsCommand{
+						AdminUid:      adminUid,
+						AccountId:     accountId,
+						SymbolName:    symbolName,
+						MaxAmount:     limits[0],
+						MaxNotional:   limits[1],
+						MaxOpenOrders: maxOpenOrders,
+						MaxGross:      limits[2],
+						MaxNet:        limits[3]})
+			} else if req.Tag == "risklimits" {
+				accountId := readElementWith1Attr(req, "account")
+				symbolName := readElementWith1Attr(req, "sym")
+				if accountId == "" && symbolName == "" {
+					return []cmd.Command{}, fmt.Errorf("xml format error")
+				}
+
+				commandList = append(commandList,
+					&cmd.QueryRiskLimitsCommand{
+						AdminUid:   adminUid,
+						AccountId:  accountId,
+						SymbolName: symbolName})
+			} else if req.Tag == "group" {
+				accountId := readElementWith1Attr(req, "account")
+				if accountId == "" {
+					return []cmd.Command{}, fmt.Errorf("xml format error")
+				}
+
+				commandList = append(commandList,
+					&cmd.SetAccountGroupCommand{
+						AdminUid:  adminUid,
+						AccountId: accountId,
+						GroupName: readElementWith1Attr(req, "name")})
+			} else if req.Tag == "killswitch" || req.Tag == "release" {
+				accountId := readElementWith1Attr(req, "account")
+				groupName := readElementWith1Attr(req, "group")
+				if (accountId == "") == (groupName == "") {
+					return []cmd.Command{}, fmt.Errorf("xml format error")
+				}
+
+				commandList = append(commandList,
+					&cmd.KillSwitchCommand{
+						AdminUid:  adminUid,
+						AccountId: accountId,
+						GroupName: groupName,
+						Release:   req.Tag == "release",
+						Reason:    readElementWith1Attr(req, "reason")})
+			} else if req.Tag == "killswitches" {
+				sinceEventId := 0
+				limit := DEFAULT_KILL_SWITCH_LIMIT
+				var err error
+				if attrExists(req, "since") {
+					sinceEventId, err = strconv.Atoi(readElementWith1Attr(req, "since"))
+					if err != nil {
+						return []cmd.Command{}, fmt.Errorf("xml format error")
+					}
+				}
+				if attrExists(req, "limit") {
+					limit, err = strconv.Atoi(readElementWith1Attr(req, "limit"))
+					if err != nil {
+						return []cmd.Command{}, fmt.Errorf("xml format error")
+					}
+				}
+
+				commandList = append(commandList,
+					&cmd.QueryKillSwitchEventsCommand{
+						AdminUid:     adminUid,
+						SinceEventId: sinceEventId,
+						Limit:        limit})
+			} else if req.Tag == "throttles" {
+				commandList = append(commandList,
+					&cmd.QueryRateStatsCommand{
+						AdminUid:  adminUid,
+						AccountId: readElementWith1Attr(req, "account")})
+			} else if req.Tag == "transfers" {
+				sinceTransferId := 0
+				limit := DEFAULT_TRANSFERS_LIMIT
+				var err error
+				if attrExists(req, "since") {
+					sinceTransferId, err = strconv.Atoi(readElementWith1Attr(req, "since"))
+					if err != nil {
+						return []cmd.Command{}, fmt.Errorf("xml format error")
+					}
+				}
+				if attrExists(req, "limit") {
+					limit, err = strconv.Atoi(readElementWith1Attr(req, "limit"))
+					if err != nil {
+						return []cmd.Command{}, fmt.Errorf("xml format error")
+					}
+				}
+
+				commandList = append(commandList,
+					&cmd.QueryTransfersCommand{
+						AdminUid:        adminUid,
+						SinceTransferId: sinceTransferId,
+						Limit:           limit})
 			} else {
 				return []cmd.Command{}, fmt.Errorf("xml format error")
 			}
 		}
 	}
 
-	if createElement == nil && transactionElement == nil {
+	if createElement == nil && transactionElement == nil && adminElement == nil {
 		return []cmd.Command{}, fmt.Errorf("xml format error")
 	}
 
@@ -0,0 +1,75 @@
+package xmlParser
+
+import (
+	cmd "app/command"
+	"reflect"
+	"testing"
+)
+
+func TestParseDeposit(t *testing.T) {
+	tests := []struct {
+		name    string
+		parser  XmlParser
+		xml     string
+		wantErr string
+		want    []cmd.Command
+	}{
+		{
+			"admin deposit",
+			XmlParser{Uid: "1", Admin: true},
+			`<admin id="1"><deposit account="5" amount="500" reason="wire in"/></admin>`,
+			"",
+			[]cmd.Command{&cmd.DepositCommand{AdminUid: "1", Uid: "5", Amount: 500, Reason: "wire in"}},
+		},
+		{
+			"non-admin deposit",
+			XmlParser{Uid: "5"},
+			`<admin id="5"><deposit account="5" amount="500"/></admin>`,
+			"permission denied",
+			nil,
+		},
+		{
+			"deposit with the key of another admin",
+			XmlParser{Uid: "2", Admin: true},
+			`<admin id="1"><deposit account="5" amount="500"/></admin>`,
+			"permission denied",
+			nil,
+		},
+		{
+			"deposit inside transactions",
+			XmlParser{Uid: "5"},
+			`<transactions id="5"><deposit amount="500"/></transactions>`,
+			"xml format error",
+			nil,
+		},
+		{
+			"deposit without an account",
+			XmlParser{Uid: "1", Admin: true},
+			`<admin id="1"><deposit amount="500"/></admin>`,
+			"xml format error",
+			nil,
+		},
+		{
+			"withdraw inside transactions",
+			XmlParser{Uid: "5"},
+			`<transactions id="5"><withdraw amount="200" reason="wire out"/></transactions>`,
+			"",
+			[]cmd.Command{&cmd.WithdrawCommand{Uid: "5", Amount: 200, Reason: "wire out"}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			commands, err := test.parser.Parse(test.xml)
+			if test.wantErr == "" && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if test.wantErr != "" && (err == nil || err.Error() != test.wantErr) {
+				t.Fatalf("error %v, want %s", err, test.wantErr)
+			}
+			if test.wantErr == "" && !reflect.DeepEqual(commands, test.want) {
+				t.Fatalf("commands %+v, want %+v", commands, test.want)
+			}
+		})
+	}
+}